@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Network tells chains apart by the version byte and the Bech32 prefix of
+// their addresses, so coins can't be sent to an address of another network
+// by mistake.
+type Network struct {
+	Name           string
+	AddressVersion byte
+	Bech32HRP      string
+}
+
+var (
+	// mainnet keeps VERSION so addresses created before networks existed stay valid
+	MainNet = &Network{Name: "mainnet", AddressVersion: VERSION, Bech32HRP: "bk"}
+	TestNet = &Network{Name: "testnet", AddressVersion: 0x6f, Bech32HRP: "tbk"}
+	RegTest = &Network{Name: "regtest", AddressVersion: 0x3c, Bech32HRP: "bkrt"}
+
+	networks = []*Network{MainNet, TestNet, RegTest}
+
+	// the network addresses are created and validated for, picked with the
+	// BLOCKCHAIN_NETWORK environment variable
+	activeNetwork = MainNet
+)
+
+var (
+	ErrAddressEncoding = errors.New("address has an invalid encoding")
+	ErrAddressLength   = errors.New("address has an invalid length")
+	ErrAddressVersion  = errors.New("address has an unknown version")
+	ErrAddressChecksum = errors.New("address checksum mismatch")
+	ErrAddressNetwork  = errors.New("address belongs to another network")
+)
+
+func NetworkByName(name string) (*Network, error) {
+	for _, network := range networks {
+		if network.Name == name {
+			return network, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown network %q", name)
+}
+
+func networkByVersion(version byte) (*Network, bool) {
+	for _, network := range networks {
+		if network.AddressVersion == version {
+			return network, true
+		}
+	}
+	return nil, false
+}
+
+func networkByHRP(hrp string) (*Network, bool) {
+	for _, network := range networks {
+		if network.Bech32HRP == hrp {
+			return network, true
+		}
+	}
+	return nil, false
+}
+
+// networkFromEnv returns the network named by BLOCKCHAIN_NETWORK, mainnet if
+// it isn't set.
+func networkFromEnv() (*Network, error) {
+	name := os.Getenv("BLOCKCHAIN_NETWORK")
+	if name == "" {
+		return MainNet, nil
+	}
+	return NetworkByName(name)
+}
+
+type AddressFormat int
+
+// The Bech32 formats encode the public key hash like a segwit program, with
+// witness version 0 for Bech32 and 1 for Bech32m.
+const (
+	AddressBase58 AddressFormat = iota
+	AddressBech32
+	AddressBech32m
+)
+
+var addressFormatNames = []string{"base58", "bech32", "bech32m"}
+
+func ParseAddressFormat(name string) (AddressFormat, error) {
+	for i, formatName := range addressFormatNames {
+		if formatName == name {
+			return AddressFormat(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown address format %q", name)
+}
+
+func (f AddressFormat) String() string {
+	if int(f) < len(addressFormatNames) {
+		return addressFormatNames[f]
+	}
+	return fmt.Sprintf("AddressFormat(%d)", int(f))
+}
+
+// Address is a decoded address, the public key hash outputs are locked to
+// together with the network and the format it was written in.
+type Address struct {
+	Network    *Network
+	PubKeyHash []byte
+	Format     AddressFormat
+}
+
+// NewAddress returns the Base58 address of pubKeyHash on network.
+func NewAddress(pubKeyHash []byte, network *Network) *Address {
+	return &Address{Network: network, PubKeyHash: pubKeyHash}
+}
+
+func (a *Address) String() string {
+	switch a.Format {
+	case AddressBech32, AddressBech32m:
+		variant, witnessVersion := bech32, byte(0)
+		if a.Format == AddressBech32m {
+			variant, witnessVersion = bech32m, 1
+		}
+		program, _ := convertBits(a.PubKeyHash, 8, 5, true)
+		return bech32Encode(a.Network.Bech32HRP, append([]byte{witnessVersion}, program...), variant)
+	}
+
+	versionedPayload := append([]byte{a.Network.AddressVersion}, a.PubKeyHash...)
+	checksum := checksum(versionedPayload)
+
+	fullPayload := append(versionedPayload, checksum...)
+
+	return string(Base58Encode(fullPayload))
+}
+
+// DecodeAddress parses an address of any known network in any format. Errors
+// wrap one of the ErrAddress errors, Bech32 ones are a *Bech32Error that may
+// point at the mistyped character.
+func DecodeAddress(address string) (*Address, error) {
+	lower := strings.ToLower(address)
+	if sep := strings.LastIndexByte(lower, '1'); sep > 0 {
+		if _, ok := networkByHRP(lower[:sep]); ok {
+			return decodeBech32Address(address)
+		}
+	}
+
+	payload, err := Base58Decode([]byte(address))
+	if err != nil || len(payload) == 0 {
+		return nil, fmt.Errorf("%w: %q", ErrAddressEncoding, address)
+	}
+	if len(payload) != 1+ripemd160.Size+addressChecksumLen {
+		return nil, fmt.Errorf("%w: %q decodes to %d bytes", ErrAddressLength, address, len(payload))
+	}
+	network, ok := networkByVersion(payload[0])
+	if !ok {
+		return nil, fmt.Errorf("%w: %q has version %d", ErrAddressVersion, address, payload[0])
+	}
+	versionedPayload := payload[:len(payload)-addressChecksumLen]
+	actualChecksum := payload[len(payload)-addressChecksumLen:]
+	if !bytes.Equal(actualChecksum, checksum(versionedPayload)) {
+		return nil, fmt.Errorf("%w: %q", ErrAddressChecksum, address)
+	}
+
+	return NewAddress(versionedPayload[1:], network), nil
+}
+
+func decodeBech32Address(address string) (*Address, error) {
+	hrp, data, variant, err := bech32Decode(address)
+	if err != nil {
+		return nil, err
+	}
+	network, ok := networkByHRP(hrp)
+	if !ok {
+		return nil, &Bech32Error{ErrAddressVersion, fmt.Sprintf("unknown prefix %q", hrp), -1}
+	}
+	if len(data) == 0 {
+		return nil, &Bech32Error{ErrAddressLength, "missing witness version", -1}
+	}
+
+	format := AddressBech32
+	switch {
+	case data[0] == 0 && variant == bech32:
+	case data[0] == 1 && variant == bech32m:
+		format = AddressBech32m
+	case data[0] > 1:
+		return nil, &Bech32Error{ErrAddressVersion, fmt.Sprintf("unsupported witness version %d", data[0]), len(hrp) + 1}
+	default:
+		return nil, &Bech32Error{ErrAddressChecksum, fmt.Sprintf("witness version %d uses the wrong checksum", data[0]), -1}
+	}
+	program, err := convertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return nil, &Bech32Error{ErrAddressEncoding, err.Error(), -1}
+	}
+	if len(program) != ripemd160.Size {
+		return nil, &Bech32Error{ErrAddressLength, fmt.Sprintf("program has %d bytes", len(program)), -1}
+	}
+
+	return &Address{Network: network, PubKeyHash: program, Format: format}, nil
+}
+
+// ValidateAddress checks that address is well formed and belongs to the
+// active network.
+func ValidateAddress(address string) error {
+	_, err := AddressPubKeyHash(address)
+	return err
+}
+
+// AddressPubKeyHash returns the public key hash an address of the active
+// network locks outputs to.
+func AddressPubKeyHash(address string) ([]byte, error) {
+	decoded, err := DecodeAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if decoded.Network != activeNetwork {
+		return nil, fmt.Errorf("%w: %q is a %s address, expected %s", ErrAddressNetwork, address, decoded.Network.Name, activeNetwork.Name)
+	}
+	return decoded.PubKeyHash, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func useTestNetwork(t *testing.T, network *Network) {
+	previous := activeNetwork
+	activeNetwork = network
+	t.Cleanup(func() { activeNetwork = previous })
+}
+
+func TestValidateAddress(t *testing.T) {
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	assert.Nil(t, ValidateAddress(address))
+
+	pubKeyHash, err := AddressPubKeyHash(address)
+	assert.Nil(t, err)
+	assert.Equal(t, HashPubKey(wallet.PublicKey), pubKeyHash)
+
+	decoded, err := DecodeAddress(address)
+	assert.Nil(t, err)
+	assert.Equal(t, MainNet, decoded.Network)
+	assert.Equal(t, address, decoded.String())
+
+	// changing a single character breaks the checksum
+	tampered := []byte(address)
+	if tampered[5] == 'a' {
+		tampered[5] = 'b'
+	} else {
+		tampered[5] = 'a'
+	}
+	unknown := NewAddress(pubKeyHash, &Network{Name: "unknown", AddressVersion: 0xff}).String()
+	short := string(Base58Encode(bytes.Repeat([]byte{VERSION}, 10)))
+
+	cases := map[string]error{
+		"":                       ErrAddressEncoding,
+		"0OIl":                   ErrAddressEncoding,
+		"abc":                    ErrAddressLength,
+		short:                    ErrAddressLength,
+		string(tampered):         ErrAddressChecksum,
+		unknown:                  ErrAddressVersion,
+		address[:len(address)-1]: ErrAddressLength,
+	}
+	for invalid, expected := range cases {
+		assert.ErrorIs(t, ValidateAddress(invalid), expected, invalid)
+		_, err := DecodeAddress(invalid)
+		assert.ErrorIs(t, err, expected, invalid)
+	}
+}
+
+func TestAddressNetworks(t *testing.T) {
+	pubKeyHash := testPubKeyHash("alice")
+	addresses := make(map[string]bool)
+	for _, network := range networks {
+		address := NewAddress(pubKeyHash, network).String()
+		addresses[address] = true
+
+		decoded, err := DecodeAddress(address)
+		assert.Nil(t, err)
+		assert.Equal(t, network, decoded.Network)
+		assert.Equal(t, pubKeyHash, decoded.PubKeyHash)
+	}
+	assert.Len(t, addresses, len(networks))
+
+	testnet := NewAddress(pubKeyHash, TestNet).String()
+	assert.ErrorIs(t, ValidateAddress(testnet), ErrAddressNetwork)
+
+	useTestNetwork(t, TestNet)
+	assert.Nil(t, ValidateAddress(testnet))
+	assert.Equal(t, testnet, testAddress("alice"))
+	assert.ErrorIs(t, ValidateAddress(NewAddress(pubKeyHash, MainNet).String()), ErrAddressNetwork)
+
+	network, err := NetworkByName("regtest")
+	assert.Nil(t, err)
+	assert.Equal(t, RegTest, network)
+	_, err = NetworkByName("moon")
+	assert.NotNil(t, err)
+}
+
+func TestBech32Addresses(t *testing.T) {
+	wallet := NewWallet()
+	pubKeyHash := HashPubKey(wallet.PublicKey)
+
+	for _, format := range []AddressFormat{AddressBase58, AddressBech32, AddressBech32m} {
+		address := wallet.Address(format)
+		decoded, err := DecodeAddress(address)
+		assert.Nil(t, err, address)
+		assert.Equal(t, format, decoded.Format)
+		assert.Equal(t, pubKeyHash, decoded.PubKeyHash)
+
+		out, err := NewTxOutput(10, address)
+		assert.Nil(t, err)
+		assert.True(t, out.IsLockedWith(pubKeyHash))
+	}
+	assert.Equal(t, string(wallet.GetAddress()), wallet.Address(AddressBase58))
+	assert.Regexp(t, "^bk1q", wallet.Address(AddressBech32))
+	assert.Regexp(t, "^bk1p", wallet.Address(AddressBech32m))
+
+	upper := strings.ToUpper(wallet.Address(AddressBech32))
+	assert.Nil(t, ValidateAddress(upper))
+
+	// witness version 0 has to use the bech32 checksum
+	program, _ := convertBits(pubKeyHash, 8, 5, true)
+	wrong := bech32Encode(MainNet.Bech32HRP, append([]byte{0}, program...), bech32m)
+	assert.ErrorIs(t, ValidateAddress(wrong), ErrAddressChecksum)
+	short := bech32Encode(MainNet.Bech32HRP, append([]byte{0}, program[:16]...), bech32)
+	assert.ErrorIs(t, ValidateAddress(short), ErrAddressLength)
+
+	testnet := NewAddress(pubKeyHash, TestNet)
+	testnet.Format = AddressBech32
+	assert.Regexp(t, "^tbk1", testnet.String())
+	assert.ErrorIs(t, ValidateAddress(testnet.String()), ErrAddressNetwork)
+
+	format, err := ParseAddressFormat("bech32m")
+	assert.Nil(t, err)
+	assert.Equal(t, AddressBech32m, format)
+	_, err = ParseAddressFormat("hex")
+	assert.NotNil(t, err)
+}
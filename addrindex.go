@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	// public key hash, height and position of a main chain transaction that
+	// paid to or spent from it => what it received and sent. Only kept once
+	// reindex -addrindex created the bucket.
+	addrIndexBucket = "addrindex"
+
+	ErrNoAddrIndex = errors.New("the address index is off, build it with reindex -addrindex")
+)
+
+// addrIndexEntry is what a transaction moved for one public key hash.
+type addrIndexEntry struct {
+	TxID     []byte
+	Received int
+	Sent     int
+}
+
+func (e *addrIndexEntry) Serialize() []byte {
+	w := &serialWriter{}
+	w.writeUint8(SERIALIZATION_VERSION)
+	w.writeBytes(e.TxID)
+	w.writeInt64(int64(e.Received))
+	w.writeInt64(int64(e.Sent))
+	return w.Bytes()
+}
+
+func deserializeAddrIndexEntry(d []byte) (*addrIndexEntry, error) {
+	r := &serialReader{data: d}
+	r.readVersion("address index entry")
+	e := &addrIndexEntry{
+		TxID:     r.readBytes("transaction id"),
+		Received: int(r.readInt64("received")),
+		Sent:     int(r.readInt64("sent")),
+	}
+	if err := r.finish("address index entry"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// addrIndexPrefix is the length prefixed public key hash, so the keys of a
+// hash that is the prefix of another don't mix.
+func addrIndexPrefix(pubKeyHash []byte) []byte {
+	return append([]byte{byte(len(pubKeyHash))}, pubKeyHash...)
+}
+
+// addrIndexKey sorts the transactions of a public key hash chronologically.
+func addrIndexKey(pubKeyHash []byte, height, index int) []byte {
+	key := append(addrIndexPrefix(pubKeyHash), heightKey(height)...)
+	return binary.BigEndian.AppendUint32(key, uint32(index))
+}
+
+// addressEntries sums what every transaction of block received and sent per
+// public key hash. spent are the outputs the block's inputs spent, see
+// BlockUndo.
+func addressEntries(block *Block, spent []TxOutput) ([]map[string]*addrIndexEntry, error) {
+	entries := make([]map[string]*addrIndexEntry, len(block.TXs))
+	next := 0
+	for i, t := range block.TXs {
+		entries[i] = make(map[string]*addrIndexEntry)
+		entry := func(pubKeyHash []byte) *addrIndexEntry {
+			key := string(pubKeyHash)
+			if entries[i][key] == nil {
+				entries[i][key] = &addrIndexEntry{TxID: t.ID}
+			}
+			return entries[i][key]
+		}
+
+		if !t.IsCoinBase() {
+			for range t.VIn {
+				if next >= len(spent) {
+					return nil, fmt.Errorf("undo record of block %x is missing spent outputs", block.Hash)
+				}
+				out := spent[next]
+				entry(out.PubKeyHash).Sent += out.Value
+				next++
+			}
+		}
+		for _, out := range t.VOut {
+			entry(out.PubKeyHash).Received += out.Value
+		}
+	}
+	return entries, nil
+}
+
+func indexAddresses(tx *bolt.Tx, block *Block, undo *BlockUndo) error {
+	b := tx.Bucket([]byte(addrIndexBucket))
+	if b == nil {
+		return nil
+	}
+	entries, err := addressEntries(block, undo.Spent)
+	if err != nil {
+		return err
+	}
+	for i, byHash := range entries {
+		for pubKeyHash, entry := range byHash {
+			if err := b.Put(addrIndexKey([]byte(pubKeyHash), block.Height, i), entry.Serialize()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func unindexAddresses(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(addrIndexBucket))
+	if b == nil {
+		return nil
+	}
+	for i, t := range block.TXs {
+		var pubKeyHashes [][]byte
+		for _, out := range t.VOut {
+			pubKeyHashes = append(pubKeyHashes, out.PubKeyHash)
+		}
+		if !t.IsCoinBase() {
+			for _, in := range t.VIn {
+				pubKeyHashes = append(pubKeyHashes, HashPubKey(in.PubKey))
+			}
+		}
+		for _, pubKeyHash := range pubKeyHashes {
+			if err := b.Delete(addrIndexKey(pubKeyHash, block.Height, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (bc *Blockchain) HasAddrIndex() bool {
+	var found bool
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(addrIndexBucket)) != nil
+		return nil
+	})
+	must(err)
+
+	return found
+}
+
+// ReindexAddresses builds the address index from scratch, which also turns
+// it on, and returns the number of blocks indexed.
+func (bc *Blockchain) ReindexAddresses() (int, error) {
+	count := 0
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(addrIndexBucket)) != nil {
+			if err := tx.DeleteBucket([]byte(addrIndexBucket)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucket([]byte(addrIndexBucket)); err != nil {
+			return err
+		}
+
+		// the tip as of this transaction, so no block connected meanwhile is missed
+		blocks := tx.Bucket([]byte(blocksBucket))
+		for hash := blocks.Get([]byte("l")); len(hash) != 0; {
+			block, err := DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return err
+			}
+			undo, err := readBlockUndo(tx, block)
+			if err != nil {
+				return err
+			}
+			if err := indexAddresses(tx, block, undo); err != nil {
+				return err
+			}
+			count++
+			hash = block.PrevBlockHash
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// AddressTx is a main chain transaction in the history of an address.
+type AddressTx struct {
+	TxID      string `json:"txid"`
+	BlockHash string `json:"blockhash"`
+	Height    int    `json:"height"`
+	Time      int64  `json:"time"`
+	Received  int    `json:"received"`
+	Sent      int    `json:"sent"`
+	// Received minus Sent
+	Amount int `json:"amount"`
+	// senders of what was received, or recipients of what was sent
+	Counterparties []string `json:"counterparties"`
+	Coinbase       bool     `json:"coinbase,omitempty"`
+	// balance of the address after the transaction
+	Balance int `json:"balance"`
+}
+
+// AddressHistoryPage is a page of the history of an address.
+type AddressHistoryPage struct {
+	Address      string      `json:"address"`
+	Total        int         `json:"total"`
+	Skip         int         `json:"skip"`
+	Transactions []AddressTx `json:"transactions"`
+}
+
+// AddressHistory returns count transactions of pubKeyHash oldest first,
+// starting after the first skip ones, and how many there are in total.
+// count 0 returns them all.
+func (bc *Blockchain) AddressHistory(pubKeyHash []byte, skip, count int) ([]AddressTx, int, error) {
+	type located struct {
+		entry         *addrIndexEntry
+		height, index int
+		balance       int
+	}
+	var all []located
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(addrIndexBucket))
+		if b == nil {
+			return ErrNoAddrIndex
+		}
+		prefix := addrIndexPrefix(pubKeyHash)
+		balance := 0
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			suffix := k[len(prefix):]
+			if len(suffix) != 12 {
+				return fmt.Errorf("address index key %x is malformed", k)
+			}
+			entry, err := deserializeAddrIndexEntry(v)
+			if err != nil {
+				return err
+			}
+			balance += entry.Received - entry.Sent
+			all = append(all, located{
+				entry:   entry,
+				height:  int(binary.BigEndian.Uint64(suffix[:8])),
+				index:   int(binary.BigEndian.Uint32(suffix[8:])),
+				balance: balance,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := len(all)
+	if skip > total {
+		skip = total
+	}
+	page := all[skip:]
+	if count > 0 && count < len(page) {
+		page = page[:count]
+	}
+
+	history := []AddressTx{}
+	var block *Block
+	for _, l := range page {
+		if block == nil || block.Height != l.height {
+			if block, err = bc.BlockByHeight(l.height); err != nil {
+				return nil, 0, err
+			}
+		}
+		if l.index >= len(block.TXs) || !bytes.Equal(block.TXs[l.index].ID, l.entry.TxID) {
+			return nil, 0, fmt.Errorf("address index entry of %x is stale, run reindex -addrindex", l.entry.TxID)
+		}
+		t := block.TXs[l.index]
+
+		item := AddressTx{
+			TxID:           hex.EncodeToString(t.ID),
+			BlockHash:      hex.EncodeToString(block.Hash),
+			Height:         block.Height,
+			Time:           block.Timestamp,
+			Received:       l.entry.Received,
+			Sent:           l.entry.Sent,
+			Amount:         l.entry.Received - l.entry.Sent,
+			Counterparties: counterparties(t, pubKeyHash, l.entry.Received >= l.entry.Sent),
+			Coinbase:       t.IsCoinBase(),
+			Balance:        l.balance,
+		}
+		history = append(history, item)
+	}
+	return history, total, nil
+}
+
+// counterparties lists the addresses t received from, or sent to, other
+// than pubKeyHash's own, in the order they appear.
+func counterparties(t *Transaction, pubKeyHash []byte, received bool) []string {
+	var hashes [][]byte
+	if received {
+		if !t.IsCoinBase() {
+			for _, in := range t.VIn {
+				hashes = append(hashes, HashPubKey(in.PubKey))
+			}
+		}
+	} else {
+		for _, out := range t.VOut {
+			hashes = append(hashes, out.PubKeyHash)
+		}
+	}
+
+	addresses := []string{}
+	seen := map[string]bool{string(pubKeyHash): true}
+	for _, hash := range hashes {
+		if seen[string(hash)] {
+			continue
+		}
+		seen[string(hash)] = true
+		addresses = append(addresses, string(pubKeyHashAddress(hash)))
+	}
+	return addresses
+}
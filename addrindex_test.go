@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddrIndexEntrySerialization(t *testing.T) {
+	entry := &addrIndexEntry{TxID: []byte("tx"), Received: 20, Sent: 50}
+	decoded, err := deserializeAddrIndexEntry(entry.Serialize())
+	assert.Nil(t, err)
+	assert.Equal(t, entry, decoded)
+}
+
+func TestAddressHistory(t *testing.T) {
+	useTestGenesisBits(t)
+	alice, bob := NewWallet(), NewWallet()
+	alicePKH, bobPKH := HashPubKey(alice.PublicKey), HashPubKey(bob.PublicKey)
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	pay := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 30, PubKeyHash: bobPKH}, {Value: 20, PubKeyHash: alicePKH}})
+	second := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0), pay)
+	bc := newTestBlockchain(t, genesis, second)
+
+	_, _, err := bc.AddressHistory(alicePKH, 0, 0)
+	assert.ErrorIs(t, err, ErrNoAddrIndex)
+	count, err := bc.ReindexAddresses()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	assert.True(t, bc.HasAddrIndex())
+
+	history, total, err := bc.AddressHistory(alicePKH, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, 0, history[0].Height)
+	assert.True(t, history[0].Coinbase)
+	assert.Equal(t, 50, history[0].Amount)
+	assert.Equal(t, []string{}, history[0].Counterparties)
+	assert.Equal(t, 50, history[0].Balance)
+	assert.Equal(t, 1, history[1].Height)
+	assert.Equal(t, 50, history[1].Sent)
+	assert.Equal(t, 20, history[1].Received)
+	assert.Equal(t, -30, history[1].Amount)
+	assert.Equal(t, []string{string(bob.GetAddress())}, history[1].Counterparties)
+	assert.Equal(t, 20, history[1].Balance)
+
+	// blocks connected later are indexed, the running balance spans pages
+	back := newSignedTestTx(bob, pay, 0, []TxOutput{{Value: 30, PubKeyHash: alicePKH}})
+	third := mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 0), back)
+	assert.Nil(t, bc.connectTip(third, true))
+	history, total, err = bc.AddressHistory(alicePKH, 2, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, total)
+	assert.Len(t, history, 1)
+	assert.Equal(t, 30, history[0].Amount)
+	assert.Equal(t, []string{string(bob.GetAddress())}, history[0].Counterparties)
+	assert.Equal(t, 50, history[0].Balance)
+
+	history, _, err = bc.AddressHistory(bobPKH, 0, 0)
+	assert.Nil(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, 0, history[1].Balance)
+
+	history, total, err = bc.AddressHistory(alicePKH, 5, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, total)
+	assert.Empty(t, history)
+
+	// disconnected blocks leave the history
+	_, err = bc.DisconnectBlock()
+	assert.Nil(t, err)
+	_, total, err = bc.AddressHistory(alicePKH, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, total)
+	_, total, err = bc.AddressHistory(bobPKH, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, total)
+}
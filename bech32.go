@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Bech32 as specified in BIP173, and Bech32m from BIP350 whose checksum
+// constant fixes the insertion weakness of the original.
+const (
+	BECH32_CHARSET    = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	BECH32_MAX_LENGTH = 90
+	BECH32_CHECKSUM   = 6
+)
+
+type bech32Variant uint32
+
+const (
+	bech32  bech32Variant = 1
+	bech32m bech32Variant = 0x2bc830a3
+)
+
+var (
+	bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+)
+
+// Bech32Error points at the character that broke decoding where it can be
+// told, Position is -1 otherwise. Err is one of the ErrAddress errors.
+type Bech32Error struct {
+	Err      error
+	Reason   string
+	Position int
+}
+
+func (e *Bech32Error) Error() string {
+	if e.Position < 0 {
+		return fmt.Sprintf("%s: %s", e.Err, e.Reason)
+	}
+	return fmt.Sprintf("%s: %s at position %d", e.Err, e.Reason, e.Position)
+}
+
+func (e *Bech32Error) Unwrap() error {
+	return e.Err
+}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				chk ^= bech32Generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func bech32HRPExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+func bech32Checksum(hrp string, data []byte, variant bech32Variant) []byte {
+	values := append(bech32HRPExpand(hrp), data...)
+	values = append(values, make([]byte, BECH32_CHECKSUM)...)
+	polymod := bech32Polymod(values) ^ uint32(variant)
+
+	checksum := make([]byte, BECH32_CHECKSUM)
+	for i := range checksum {
+		checksum[i] = byte(polymod>>(5*(5-i))) & 31
+	}
+	return checksum
+}
+
+// bech32Encode encodes 5 bit values behind hrp.
+func bech32Encode(hrp string, data []byte, variant bech32Variant) string {
+	combined := append(append([]byte{}, data...), bech32Checksum(hrp, data, variant)...)
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, v := range combined {
+		sb.WriteByte(BECH32_CHARSET[v])
+	}
+	return sb.String()
+}
+
+// bech32Decode returns the lower case hrp and the 5 bit values without the
+// checksum. A failing checksum is checked against every single character
+// substitution, which bech32 is guaranteed to catch, to point at the typo.
+func bech32Decode(s string) (string, []byte, bech32Variant, error) {
+	if len(s) > BECH32_MAX_LENGTH {
+		return "", nil, 0, &Bech32Error{ErrAddressLength, fmt.Sprintf("longer than %d characters", BECH32_MAX_LENGTH), -1}
+	}
+	lower, upper := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 33 || c > 126 {
+			return "", nil, 0, &Bech32Error{ErrAddressEncoding, fmt.Sprintf("invalid character %q", c), i}
+		}
+		lower = lower || (c >= 'a' && c <= 'z')
+		upper = upper || (c >= 'A' && c <= 'Z')
+	}
+	if lower && upper {
+		return "", nil, 0, &Bech32Error{ErrAddressEncoding, "mixed upper and lower case", -1}
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 {
+		return "", nil, 0, &Bech32Error{ErrAddressEncoding, "missing human readable prefix", -1}
+	}
+	if sep+1+BECH32_CHECKSUM > len(s) {
+		return "", nil, 0, &Bech32Error{ErrAddressLength, "checksum is too short", -1}
+	}
+	hrp := s[:sep]
+	data := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		v := strings.IndexByte(BECH32_CHARSET, s[i])
+		if v < 0 {
+			return "", nil, 0, &Bech32Error{ErrAddressEncoding, fmt.Sprintf("invalid character %q", s[i]), i}
+		}
+		data = append(data, byte(v))
+	}
+
+	expanded := bech32HRPExpand(hrp)
+	polymod := bech32Polymod(append(expanded, data...))
+	variant := bech32Variant(polymod)
+	if variant != bech32 && variant != bech32m {
+		return "", nil, 0, &Bech32Error{ErrAddressChecksum, "likely typo", bech32LocateError(expanded, data, sep+1)}
+	}
+
+	return hrp, data[:len(data)-BECH32_CHECKSUM], variant, nil
+}
+
+// bech32LocateError returns the position of the only character whose
+// substitution makes the checksum valid, or -1.
+func bech32LocateError(expanded, data []byte, offset int) int {
+	position := -1
+	values := append(expanded, data...)
+	for i := range data {
+		original := values[len(expanded)+i]
+		for v := byte(0); v < 32; v++ {
+			if v == original {
+				continue
+			}
+			values[len(expanded)+i] = v
+			polymod := bech32Variant(bech32Polymod(values))
+			if polymod == bech32 || polymod == bech32m {
+				if position >= 0 && position != offset+i {
+					return -1
+				}
+				position = offset + i
+			}
+		}
+		values[len(expanded)+i] = original
+	}
+	return position
+}
+
+// convertBits regroups data from fromBits to toBits wide values.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	var out []byte
+	maxv := uint32(1)<<toBits - 1
+	for _, v := range data {
+		if uint32(v)>>fromBits != 0 {
+			return nil, errors.New("value out of range")
+		}
+		acc = acc<<fromBits | uint32(v)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxv))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
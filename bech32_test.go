@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBech32Vectors(t *testing.T) {
+	// valid strings from BIP173 and BIP350
+	valid := map[string]bech32Variant{
+		"A12UEL5L": bech32,
+		"a12uel5l": bech32,
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw":                bech32,
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w": bech32,
+		"?1ezyfcl": bech32,
+		"A1LQFN3A": bech32m,
+		"a1lqfn3a": bech32m,
+		"abcdef1l7aum6echk45nj3s0wdvt2fg8x9yrzpqzd3ryx": bech32m,
+		"?1v759aa": bech32m,
+	}
+	for s, expected := range valid {
+		hrp, data, variant, err := bech32Decode(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, variant, s)
+		assert.Equal(t, s, caseOf(s, bech32Encode(hrp, data, variant)))
+	}
+
+	invalid := map[string]error{
+		"x1b4n0q5v": ErrAddressEncoding,
+		"li1dgmt3":  ErrAddressLength,
+		"A1G7SGD8":  ErrAddressChecksum,
+		"1qzzfhee":  ErrAddressEncoding,
+		"a12UEL5L":  ErrAddressEncoding,
+		"an84characterslonghumanreadablepartthatcontainsthenumber1andtheexcludedcharactersbio1569pvx": ErrAddressLength,
+	}
+	for s, expected := range invalid {
+		_, _, _, err := bech32Decode(s)
+		assert.ErrorIs(t, err, expected, s)
+	}
+}
+
+// caseOf upper cases encoded when s is upper case, bech32Encode only writes
+// lower case.
+func caseOf(s, encoded string) string {
+	for _, c := range s {
+		if c >= 'A' && c <= 'Z' {
+			b := []byte(encoded)
+			for i := range b {
+				if b[i] >= 'a' && b[i] <= 'z' {
+					b[i] -= 'a' - 'A'
+				}
+			}
+			return string(b)
+		}
+	}
+	return encoded
+}
+
+func TestBech32LocatesTypo(t *testing.T) {
+	s := "abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw"
+	for _, position := range []int{7, 20, len(s) - 1} {
+		typo := []byte(s)
+		if typo[position] == 'q' {
+			typo[position] = 'p'
+		} else {
+			typo[position] = 'q'
+		}
+
+		_, _, _, err := bech32Decode(string(typo))
+		var bech32Err *Bech32Error
+		assert.True(t, errors.As(err, &bech32Err))
+		assert.ErrorIs(t, err, ErrAddressChecksum)
+		assert.Equal(t, position, bech32Err.Position)
+	}
+
+	_, _, _, err := bech32Decode("abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxb")
+	var bech32Err *Bech32Error
+	assert.True(t, errors.As(err, &bech32Err))
+	assert.ErrorIs(t, err, ErrAddressEncoding)
+	assert.Equal(t, 44, bech32Err.Position)
+}
+
+func TestConvertBits(t *testing.T) {
+	data := []byte{0xff, 0x00, 0x7a}
+	five, err := convertBits(data, 8, 5, true)
+	assert.Nil(t, err)
+	assert.Len(t, five, 5)
+	eight, err := convertBits(five, 5, 8, false)
+	assert.Nil(t, err)
+	assert.Equal(t, data, eight)
+
+	_, err = convertBits([]byte{32}, 5, 8, false)
+	assert.NotNil(t, err)
+}
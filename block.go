@@ -3,7 +3,6 @@ package main
 import (
 	"bytes"
 	"crypto/sha256"
-	"encoding/gob"
 	"strconv"
 	"time"
 )
@@ -14,18 +13,24 @@ type Block struct {
 	Hash          []byte
 	Version       float64
 	Nonce         int
+	Height        int
+	Bits          uint32
+	MerkleRoot    []byte
 
 	TXs []*Transaction
 }
 
-func NewBlock(txs []*Transaction, prevBlockHash []byte) *Block {
+func NewBlock(txs []*Transaction, prevBlockHash []byte, height int, bits uint32) *Block {
 	block := &Block{
 		TXs:           txs,
 		Version:       VERSION,
 		PrevBlockHash: prevBlockHash,
+		Height:        height,
+		Bits:          bits,
 		Timestamp:     time.Now().Unix(),
 		Hash:          []byte{},
 	}
+	block.MerkleRoot = block.HashTransactions()
 	pow := NewProofOfWork(block)
 	nonce, hash := pow.Run()
 
@@ -44,34 +49,34 @@ func (b *Block) SetHash() {
 	b.Hash = hash[:]
 }
 
+// Serialize encodes the block in the binary format described in serialize.go.
 func (b *Block) Serialize() ([]byte, error) {
-	var res bytes.Buffer
-	encoder := gob.NewEncoder(&res)
-	if err := encoder.Encode(b); err != nil {
-		return []byte{}, err
-	}
+	w := &serialWriter{}
+	b.encode(w)
 
-	return res.Bytes(), nil
+	return w.Bytes(), nil
 }
 
-func DeserializeBlock(d []byte) *Block {
-	var block Block
-	decoder := gob.NewDecoder(bytes.NewReader(d))
-	if err := decoder.Decode(&block); err != nil {
-		return nil
+func DeserializeBlock(d []byte) (*Block, error) {
+	r := &serialReader{data: d}
+	block := decodeBlock(r)
+	if err := r.finish("block"); err != nil {
+		return nil, err
 	}
-	return &block
+	return block, nil
 }
 
-func (b *Block) HashTransactions() []byte {
+func (b *Block) MerkleTree() *MerkleTree {
 	var txHashes [][]byte
-	var txHash [32]byte
 
 	for _, tx := range b.TXs {
 		txHashes = append(txHashes, tx.ID)
 	}
 
-	txHash = sha256.Sum256(bytes.Join(txHashes, []byte{}))
+	return NewMerkleTree(txHashes)
+}
 
-	return txHash[:]
+// HashTransactions returns the Merkle root of the block's transactions.
+func (b *Block) HashTransactions() []byte {
+	return b.MerkleTree().Root()
 }
@@ -9,16 +9,19 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// an easy target so the tests don't spend their time mining
+var testBits = BigToCompact(powLimit)
+
 func TestNewBlock(t *testing.T) {
-	block := NewBlock([]*Transction{}, []byte{})
-	assert.Equal(t, []*Transction{}, []*Transction{})
+	block := NewBlock([]*Transaction{}, []byte{}, 0, testBits)
+	assert.Equal(t, []*Transaction{}, []*Transaction{})
 	assert.Equal(t, []byte{}, block.PrevBlockHash)
-	assert.Equal(t, VERSION, block.Version)
+	assert.Equal(t, float64(VERSION), block.Version)
 }
 
 func TestSetHash(t *testing.T) {
 	prevHash := []byte("prevHash")
-	block := NewBlock([]*Transction{}, prevHash)
+	block := NewBlock([]*Transaction{}, prevHash, 0, testBits)
 
 	block.SetHash()
 
@@ -32,7 +35,7 @@ func TestSetHash(t *testing.T) {
 
 func TestSerialize(t *testing.T) {
 	prevHash := []byte("prevHash")
-	block := NewBlock([]*Transction{}, prevHash)
+	block := NewBlock([]*Transaction{}, prevHash, 0, testBits)
 
 	s, err := block.Serialize()
 
@@ -42,12 +45,13 @@ func TestSerialize(t *testing.T) {
 
 func TestDeserializeBlock(t *testing.T) {
 	prevHash := []byte("prevHash")
-	block := NewBlock([]*Transction{}, prevHash)
+	block := NewBlock([]*Transaction{}, prevHash, 0, testBits)
 
 	s, err := block.Serialize()
 	assert.Nil(t, err)
 	assert.NotEqual(t, []byte{}, s)
 
-	dBlock := DeserializeBlock(s)
+	dBlock, err := DeserializeBlock(s)
+	assert.Nil(t, err)
 	assert.Equal(t, block, dBlock)
 }
@@ -7,72 +7,244 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"github.com/boltdb/bolt"
 )
 
 type Blockchain struct {
+	// tipMu guards lastBlockHash, which the node moves while its servers
+	// read it, see Tip
+	tipMu         sync.RWMutex
 	lastBlockHash []byte
 	db            *bolt.DB
+
+	// mempool of the node the chain belongs to, if any. Connected blocks
+	// remove their transactions from it and disconnected blocks return
+	// theirs, and its entries tell how long confirmed transactions waited.
+	mempool *Mempool
 }
 
 var (
 	blocksBucket = "blocksBucket"
+
+	// wrapped by the lookups of blocks and transactions that don't exist
+	ErrNotFound = errors.New("not found")
 )
 
 func NewBlockchain(address, name string) *Blockchain {
+	return CreateBlockchain(address, name, HALVING_INTERVAL)
+}
+
+// CreateBlockchain is NewBlockchain for a chain whose subsidy halves every
+// halvingInterval blocks. An existing chain keeps the interval it was
+// created with.
+func CreateBlockchain(address, name string, halvingInterval int) *Blockchain {
 	var tip []byte
-	db, err := bolt.Open(name, 0600, nil)
-	must(err)
-	err = db.Update(func(tx *bolt.Tx) error {
+	db := openDB(name)
+	err := db.Update(func(tx *bolt.Tx) error {
 		bucket := tx.Bucket([]byte(blocksBucket))
-		if bucket == nil {
-			coinbaseTx := NewCoinbaseTx(address, "May The Force Be With You")
-			gBlock := NewGenesisBlock(coinbaseTx)
-			b, err := tx.CreateBucket([]byte(blocksBucket))
-			if err != nil {
+		if bucket == nil || bucket.Get([]byte("l")) == nil {
+			if err := writeHalvingInterval(tx, halvingInterval); err != nil {
 				return err
 			}
-			bBlock, err := gBlock.Serialize()
+			schedule, err := readSubsidySchedule(tx)
 			if err != nil {
 				return err
 			}
-			err = b.Put(gBlock.Hash, bBlock)
+			coinbaseTx, err := NewCoinbaseTx(address, "May The Force Be With You", 0, schedule.Subsidy(0))
 			if err != nil {
 				return err
 			}
-			err = b.Put([]byte("l"), gBlock.Hash)
-			if err != nil {
+			gBlock := NewGenesisBlock(coinbaseTx)
+			if _, err := tx.CreateBucketIfNotExists([]byte(blocksBucket)); err != nil {
+				return err
+			}
+			if err := connectBlock(tx, gBlock, nil); err != nil {
 				return err
 			}
 			tip = gBlock.Hash
 		} else {
-			tip = bucket.Get([]byte("l"))
+			tip = append([]byte{}, bucket.Get([]byte("l"))...)
+		}
+		return nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return newBlockchain(db, tip)
+}
+
+// OpenBlockchain opens the chain stored in name without creating a genesis
+// block, so a node can start empty and download the chain from its peers.
+func OpenBlockchain(name string) *Blockchain {
+	var tip []byte
+	db := openDB(name)
+	err := db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(blocksBucket))
+		if err != nil {
+			return err
+		}
+		// bolt's slices are only valid inside the transaction
+		if hash := b.Get([]byte("l")); hash != nil {
+			tip = append([]byte{}, hash...)
 		}
 		return nil
 	})
 	if err != nil {
 		panic(err)
 	}
-	return &Blockchain{
+
+	return newBlockchain(db, tip)
+}
+
+func openDB(name string) *bolt.DB {
+	// don't wait forever when another process, e.g. a running node, holds the file
+	db, err := bolt.Open(name, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		panic(fmt.Sprintf("unable to open blockchain %s: %s", name, err))
+	}
+	return db
+}
+
+func newBlockchain(db *bolt.DB, tip []byte) *Blockchain {
+	bc := &Blockchain{
 		lastBlockHash: tip,
 		db:            db,
 	}
+
+	// chains created before the UTXO index or the block indexes existed
+	// don't have their buckets yet
+	var indexed, blocksIndexed bool
+	err := db.View(func(tx *bolt.Tx) error {
+		indexed = tx.Bucket([]byte(utxoBucket)) != nil
+		blocksIndexed = tx.Bucket([]byte(blockIndexBucket)) != nil &&
+			tx.Bucket([]byte(heightIndexBucket)) != nil
+		return nil
+	})
+	must(err)
+	if !blocksIndexed && tip != nil {
+		must(reindexBlocks(db, tip))
+	}
+	if !indexed && tip != nil {
+		must(NewUTXOSet(bc).Reindex())
+	}
+
+	return bc
+}
+
+// connectBlock stores block as the new tip together with its undo record,
+// applies it to the UTXO set and updates the indexes within the caller's
+// bolt transaction. waits are the blocks its transactions spent in the
+// mempool, see Mempool.Waits.
+func connectBlock(tx *bolt.Tx, block *Block, waits map[string]int) error {
+	if err := recordFeeStats(tx, block, waits); err != nil {
+		return err
+	}
+	if err := applyBlock(tx, block); err != nil {
+		return err
+	}
+	return tx.Bucket([]byte(blocksBucket)).Put([]byte("l"), block.Hash)
+}
+
+// applyBlock is connectBlock without the fee statistics and the tip, which
+// is all MigrateChain needs to rebuild the chainstate and the indexes.
+func applyBlock(tx *bolt.Tx, block *Block) error {
+	undo, err := writeBlockUndo(tx, block)
+	if err != nil {
+		return err
+	}
+	if err := updateUTXOs(tx, block); err != nil {
+		return err
+	}
+	if _, err := storeBlock(tx, block); err != nil {
+		return err
+	}
+	if err := putHeight(tx, block); err != nil {
+		return err
+	}
+	if err := indexTransactions(tx, block); err != nil {
+		return err
+	}
+	return indexAddresses(tx, block, undo)
+}
+
+// disconnectBlock undoes connectBlock for the tip: the outputs block created
+// are removed, the ones its undo record says it spent are restored and its
+// parent becomes the tip. The block stays stored as a side branch.
+func disconnectBlock(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(utxoBucket))
+	if b == nil {
+		return fmt.Errorf("utxo bucket %s not exists", utxoBucket)
+	}
+	undo, err := readBlockUndo(tx, block)
+	if err != nil {
+		return err
+	}
+
+	// backwards, so outputs spent within the block are restored before the
+	// transaction that created them is removed
+	spent := len(undo.Spent)
+	for i := len(block.TXs) - 1; i >= 0; i-- {
+		t := block.TXs[i]
+		if err := b.Delete(t.ID); err != nil {
+			return err
+		}
+		if t.IsCoinBase() {
+			continue
+		}
+		for j := len(t.VIn) - 1; j >= 0; j-- {
+			spent--
+			if spent < 0 {
+				return fmt.Errorf("undo record of block %x is missing spent outputs", block.Hash)
+			}
+			vin := t.VIn[j]
+			if err := restoreOutput(b, vin.Txid, vin.Vout, undo.Spent[spent]); err != nil {
+				return err
+			}
+		}
+	}
+	if spent != 0 {
+		return fmt.Errorf("undo record of block %x has %d spent outputs too many", block.Hash, spent)
+	}
+	if err := deleteHeight(tx, block); err != nil {
+		return err
+	}
+	if err := unindexTransactions(tx, block); err != nil {
+		return err
+	}
+	if err := unindexAddresses(tx, block); err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(blocksBucket)).Put([]byte("l"), block.PrevBlockHash)
 }
 
 func NewGenesisBlock(coinbase *Transaction) *Block {
-	return NewBlock([]*Transaction{coinbase}, []byte{})
+	return NewBlock([]*Transaction{coinbase}, []byte{}, 0, genesisBits)
 }
 
+// AddBlock mines txs into a block on top of the tip and connects it. The
+// block is validated like one received from a peer.
 func (bc *Blockchain) AddBlock(txs []*Transaction) *Block {
 	var lastHash []byte
 
+	// fail before spending the proof of work on it
+	for _, tx := range txs {
+		if !bc.VerifyTransaction(tx) {
+			log.Printf("transaction %x has an invalid signature\n", tx.ID)
+			return nil
+		}
+	}
+
 	err := bc.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 		if b == nil {
 			return errors.New(fmt.Sprintf("blocks bucket %s not exists", blocksBucket))
 		}
-		lastHash = b.Get([]byte("l"))
+		lastHash = append([]byte{}, b.Get([]byte("l"))...)
 
 		return nil
 	})
@@ -80,123 +252,438 @@ func (bc *Blockchain) AddBlock(txs []*Transaction) *Block {
 		log.Println(err)
 		return nil
 	}
-	newBlock := NewBlock(txs, lastHash)
-	err = bc.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(blocksBucket))
-		bBlock, err := newBlock.Serialize()
+	prev, err := bc.BlockByHash(lastHash)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	bits, err := bc.NextTargetBits(prev)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	newBlock := NewBlock(txs, lastHash, prev.Height+1, bits)
+	if err := bc.connectTip(newBlock, true); err != nil {
+		log.Println(err)
+		return nil
+	}
+	return newBlock
+}
+
+// MineBlock mines txs into a new block whose coinbase pays the subsidy and
+// the fees of txs to minerAddress.
+func (bc *Blockchain) MineBlock(minerAddress string, txs []*Transaction) *Block {
+	if err := ValidateAddress(minerAddress); err != nil {
+		log.Println(err)
+		return nil
+	}
+	tip, err := bc.BlockByHash(bc.Tip())
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	fees, err := NewUTXOSet(bc).BlockFees(txs)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	height := tip.Height + 1
+	coinbase, err := NewCoinbaseTx(minerAddress, "", height, bc.SubsidySchedule().Subsidy(height)+fees)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return bc.AddBlock(append([]*Transaction{coinbase}, txs...))
+}
+
+// ReceiveBlock checks the header of a block mined elsewhere and stores it,
+// whether it extends the main chain or a side branch. Once a branch has more
+// work than the main chain the chain reorganizes onto it.
+func (bc *Blockchain) ReceiveBlock(block *Block) error {
+	if bc.HasBlock(block.Hash) {
+		return nil
+	}
+	if len(block.PrevBlockHash) == 0 {
+		if bc.Tip() != nil {
+			return fmt.Errorf("block %x is a second genesis block", block.Hash)
+		}
+	} else {
+		parent, err := bc.BlockIndex(block.PrevBlockHash)
 		if err != nil {
 			return err
 		}
-		err = b.Put(newBlock.Hash, bBlock)
+		if parent.Invalid {
+			return fmt.Errorf("block %x builds on the invalid block %x", block.Hash, block.PrevBlockHash)
+		}
+	}
+	if err := bc.ValidateHeader(block); err != nil {
+		return err
+	}
+
+	var entry *BlockIndexEntry
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = storeBlock(tx, block)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if tipHash := bc.Tip(); tipHash != nil {
+		tip, err := bc.BlockIndex(tipHash)
 		if err != nil {
 			return err
 		}
-		err = b.Put([]byte("l"), newBlock.Hash)
+		// on equal work the branch seen first stays
+		if entry.ChainWork.Cmp(tip.ChainWork) <= 0 {
+			return nil
+		}
+	}
+	return bc.reorganize(block)
+}
+
+// reorganize makes the branch ending in tip the main chain. The blocks of
+// the current branch are disconnected down to the fork and their
+// transactions go back to the mempool, then the new branch is validated and
+// connected block by block. When one of its blocks turns out invalid it is
+// marked so and the old branch is connected back.
+func (bc *Blockchain) reorganize(tip *Block) error {
+	disconnect, connect, err := bc.findFork(tip)
+	if err != nil {
+		return err
+	}
+
+	for range disconnect {
+		if _, err := bc.DisconnectBlock(); err != nil {
+			return err
+		}
+	}
+	for i, block := range connect {
+		err := bc.connectTip(block, true)
+		if err == nil {
+			continue
+		}
+		if err := bc.markInvalid(block.Hash); err != nil {
+			return err
+		}
+		var undone []*Block
+		for range connect[:i] {
+			block, err := bc.DisconnectBlock()
+			if err != nil {
+				return err
+			}
+			undone = append(undone, block)
+		}
+		for j := len(disconnect) - 1; j >= 0; j-- {
+			if err := bc.connectTip(disconnect[j], false); err != nil {
+				return err
+			}
+		}
+		bc.returnToMempool(undone)
+		return err
+	}
+
+	if len(disconnect) > 0 {
+		log.Printf("reorganized onto %x, %d blocks disconnected and %d connected\n", tip.Hash, len(disconnect), len(connect))
+	}
+	bc.returnToMempool(disconnect)
+	return nil
+}
+
+// findFork walks the main chain and the branch ending in tip back to the
+// block they share. It returns the main chain blocks above it from the tip
+// down and the branch blocks above it from the fork up.
+func (bc *Blockchain) findFork(tip *Block) ([]*Block, []*Block, error) {
+	var disconnect, connect []*Block
+	var current *Block
+	if tipHash := bc.Tip(); tipHash != nil {
+		var err error
+		if current, err = bc.BlockByHash(tipHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	branch := tip
+	for current == nil || !bytes.Equal(current.Hash, branch.Hash) {
+		if current != nil && current.Height >= branch.Height {
+			disconnect = append(disconnect, current)
+			if len(current.PrevBlockHash) == 0 {
+				current = nil
+				continue
+			}
+			parent, err := bc.BlockByHash(current.PrevBlockHash)
+			if err != nil {
+				return nil, nil, err
+			}
+			current = parent
+			continue
+		}
+
+		entry, err := bc.BlockIndex(branch.Hash)
 		if err != nil {
+			return nil, nil, err
+		}
+		if entry.Invalid {
+			return nil, nil, fmt.Errorf("branch of block %x contains the invalid block %x", tip.Hash, branch.Hash)
+		}
+		connect = append([]*Block{branch}, connect...)
+		if len(branch.PrevBlockHash) == 0 {
+			break
+		}
+		if branch, err = bc.BlockByHash(branch.PrevBlockHash); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return disconnect, connect, nil
+}
+
+// connectTip connects block on top of the tip, validating it first unless
+// it was part of the main chain before.
+func (bc *Blockchain) connectTip(block *Block, validate bool) error {
+	if validate {
+		if err := bc.ValidateBlock(block); err != nil {
 			return err
 		}
-		bc.lastBlockHash = newBlock.Hash
-		return nil
+	}
+	waits := bc.mempoolWaits(block)
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		return connectBlock(tx, block, waits)
+	})
+	if err != nil {
+		return err
+	}
+	bc.setTip(block.Hash)
+	if bc.mempool != nil {
+		bc.mempool.Remove(block.TXs)
+	}
+	return nil
+}
+
+// DisconnectBlock disconnects the tip, rolling the UTXO set back with its
+// undo record, and returns it. The block stays stored as a side branch and
+// its parent becomes the tip.
+func (bc *Blockchain) DisconnectBlock() (*Block, error) {
+	tipHash := bc.Tip()
+	if tipHash == nil {
+		return nil, errors.New("the chain is empty")
+	}
+	block, err := bc.BlockByHash(tipHash)
+	if err != nil {
+		return nil, err
+	}
+	if len(block.PrevBlockHash) == 0 {
+		return nil, errors.New("the genesis block can't be disconnected")
+	}
+
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return disconnectBlock(tx, block)
 	})
 	if err != nil {
+		return nil, err
+	}
+	bc.setTip(block.PrevBlockHash)
+	return block, nil
+}
+
+// returnToMempool offers the transactions of disconnected blocks, given tip
+// first, back to the mempool. Those confirmed on the new branch or spending
+// outputs it doesn't have are dropped.
+func (bc *Blockchain) returnToMempool(blocks []*Block) {
+	if bc.mempool == nil {
+		return
+	}
+	for i := len(blocks) - 1; i >= 0; i-- {
+		for _, tx := range blocks[i].TXs {
+			if tx.IsCoinBase() {
+				continue
+			}
+			if _, err := bc.mempool.Add(tx, bc); err != nil {
+				log.Printf("dropped transaction %x of a disconnected block: %s\n", tx.ID, err)
+			}
+		}
+	}
+}
+
+func (bc *Blockchain) mempoolWaits(block *Block) map[string]int {
+	if bc.mempool == nil {
 		return nil
 	}
-	return newBlock
+	return bc.mempool.Waits(block.Height, block.TXs)
 }
 
-func (bc *Blockchain) Iterator() *BlockchainInterator {
-	return &BlockchainInterator{
-		currentHash: bc.lastBlockHash,
-		db:          bc.db,
+func (bc *Blockchain) HasBlock(hash []byte) bool {
+	var found bool
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		found = b != nil && b.Get(hash) != nil
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
 	}
+
+	return found
+}
+
+// Tip returns the hash of the last block of the main chain, nil while the
+// chain is empty. It's safe to call while the node moves the tip.
+func (bc *Blockchain) Tip() []byte {
+	bc.tipMu.RLock()
+	defer bc.tipMu.RUnlock()
+
+	return bc.lastBlockHash
 }
 
-func (bc *Blockchain) FindUnspentTransations(address string) []Transaction {
+func (bc *Blockchain) setTip(hash []byte) {
+	bc.tipMu.Lock()
+	defer bc.tipMu.Unlock()
+
+	bc.lastBlockHash = hash
+}
+
+// BestHeight returns the height of the tip, or -1 while the chain is empty.
+func (bc *Blockchain) BestHeight() int {
+	tipHash := bc.Tip()
+	if tipHash == nil {
+		return -1
+	}
+	tip, err := bc.BlockByHash(tipHash)
+	if err != nil {
+		log.Println(err)
+		return -1
+	}
+
+	return tip.Height
+}
+
+// BlockHashes lists the hashes of the chain from the tip down to genesis.
+func (bc *Blockchain) BlockHashes() [][]byte {
+	var hashes [][]byte
 	bci := bc.Iterator()
-	spentTXs := make(map[string][]int)
-	var unspentTXs []Transaction
+	if bci.currentHash == nil {
+		return hashes
+	}
+
 	for {
 		block := bci.Next()
-
-		for _, tx := range block.TXs {
-			txID := hex.EncodeToString(tx.ID)
-		Outputs:
-			for outIdx, txOut := range tx.VOut {
-				if spentTXs[txID] != nil {
-					for _, spentOut := range spentTXs[txID] {
-						if spentOut == outIdx {
-							continue Outputs
-						}
-					}
-				}
-
-				if txOut.CanBeUnlockedWith([]byte(address)) {
-					unspentTXs = append(unspentTXs, *tx)
-				}
-			}
-			if !tx.IsCoinBase() {
-				for _, txin := range tx.VIn {
-					if txin.CanUnlockOutput([]byte(address)) {
-						inTxID := hex.EncodeToString(txin.Txid)
-						spentTXs[inTxID] = append(spentTXs[inTxID], txin.Vout)
-					}
-				}
-			}
+		if block == nil {
+			break
 		}
+		hashes = append(hashes, block.Hash)
 
 		if len(block.PrevBlockHash) == 0 {
 			break
 		}
 	}
-	return unspentTXs
+
+	return hashes
 }
 
-func (bc *Blockchain) FindUTXOs(address string) []TxOutput {
-	txs := bc.FindUnspentTransations(address)
-	var txOuts []TxOutput
+func (bc *Blockchain) BlockByHash(hash []byte) (*Block, error) {
+	var block *Block
 
-	for _, tx := range txs {
-		for _, out := range tx.VOut {
-			if out.CanBeUnlockedWith([]byte(address)) {
-				txOuts = append(txOuts, out)
-			}
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		if b == nil {
+			return fmt.Errorf("blocks bucket %s not exists", blocksBucket)
+		}
+		rawBlock := b.Get(hash)
+		if rawBlock == nil {
+			return fmt.Errorf("block %x is %w", hash, ErrNotFound)
+		}
+		var err error
+		block, err = DeserializeBlock(rawBlock)
+		if err != nil {
+			return fmt.Errorf("block %x can't be decoded, chains stored with gob need migratechain: %w", hash, err)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return txOuts
+	return block, nil
 }
 
-func (bc *Blockchain) FindSpendableUTXOs(address string, amout int) (int, map[string][]int) {
-	txOuts := make(map[string][]int)
+func (bc *Blockchain) Iterator() *BlockchainInterator {
+	return &BlockchainInterator{
+		currentHash: bc.Tip(),
+		db:          bc.db,
+	}
+}
 
-	txs := bc.FindUnspentTransations(address)
+// FindUTXO walks the whole chain and collects every unspent output keyed by
+// the hex encoded id of the transaction that created it.
+func (bc *Blockchain) FindUTXO() map[string]TxOutputs {
+	UTXOs := make(map[string]TxOutputs)
+	spentTXOs := make(map[string]map[int]bool)
+	bci := bc.Iterator()
 
-	accumulated := 0
+	for {
+		block := bci.Next()
 
-	for _, tx := range txs {
-		for outIdx, out := range tx.VOut {
+		// backwards, so spends within the block are seen before the outputs
+		for i := len(block.TXs) - 1; i >= 0; i-- {
+			tx := block.TXs[i]
 			txID := hex.EncodeToString(tx.ID)
-			if out.CanBeUnlockedWith([]byte(address)) && accumulated < amout {
-				accumulated += out.Value
-				txOuts[txID] = append(txOuts[txID], outIdx)
-				if accumulated >= amout {
-					return accumulated, txOuts
+
+			for outIdx, out := range tx.VOut {
+				if spentTXOs[txID][outIdx] {
+					continue
+				}
+				outs, ok := UTXOs[txID]
+				if !ok {
+					outs = TxOutputs{Outputs: make(map[int]TxOutput)}
+					UTXOs[txID] = outs
+				}
+				outs.Outputs[outIdx] = out
+			}
+
+			if !tx.IsCoinBase() {
+				for _, in := range tx.VIn {
+					inTxID := hex.EncodeToString(in.Txid)
+					if spentTXOs[inTxID] == nil {
+						spentTXOs[inTxID] = make(map[int]bool)
+					}
+					spentTXOs[inTxID][in.Vout] = true
 				}
 			}
 		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
 	}
-	return accumulated, txOuts
+	return UTXOs
 }
 
-func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
+// UsedPubKeyHashes collects the hex encoded hash of every public key that was
+// paid to or spent from anywhere on the chain.
+func (bc *Blockchain) UsedPubKeyHashes() map[string]bool {
+	used := make(map[string]bool)
 	bci := bc.Iterator()
+	if bci.currentHash == nil {
+		return used
+	}
 
 	for {
 		block := bci.Next()
 
 		for _, tx := range block.TXs {
-			if bytes.Compare(tx.ID, ID) == 0 {
-				return *tx, nil
+			for _, out := range tx.VOut {
+				if len(out.PubKeyHash) > 0 {
+					used[hex.EncodeToString(out.PubKeyHash)] = true
+				}
+			}
+			if tx.IsCoinBase() {
+				continue
+			}
+			for _, in := range tx.VIn {
+				used[hex.EncodeToString(HashPubKey(in.PubKey))] = true
 			}
 		}
 
@@ -204,19 +691,37 @@ func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
 			break
 		}
 	}
+	return used
+}
 
-	return Transaction{}, errors.New("Transaction is not found")
+// FindTransaction returns a transaction of the main chain, see
+// LocateTransaction.
+func (bc *Blockchain) FindTransaction(ID []byte) (Transaction, error) {
+	tx, _, err := bc.LocateTransaction(ID)
+	if err != nil {
+		return Transaction{}, err
+	}
+	return *tx, nil
 }
 
-func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) {
+// SignTransaction signs every input of tx. The key of a locked wallet has no
+// private part, which fails with ErrWalletLocked.
+func (bc *Blockchain) SignTransaction(tx *Transaction, privKey ecdsa.PrivateKey) error {
+	if privKey.D == nil {
+		return ErrWalletLocked
+	}
 	prevTXs := make(map[string]Transaction)
 
 	for _, vin := range tx.VIn {
-		prevTX, _ := bc.FindTransaction(vin.Txid)
+		prevTX, err := bc.FindTransaction(vin.Txid)
+		if err != nil {
+			return err
+		}
 		prevTXs[hex.EncodeToString(prevTX.ID)] = prevTX
 	}
 
 	tx.Sign(privKey, prevTXs)
+	return nil
 }
 
 func (bc *Blockchain) VerifyTransaction(tx *Transaction) bool {
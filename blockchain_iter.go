@@ -17,9 +17,10 @@ func (i *BlockchainInterator) Next() *Block {
 	err := i.db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(blocksBucket))
 		rawBlock := b.Get(i.currentHash)
-		block = DeserializeBlock(rawBlock)
+		var err error
+		block, err = DeserializeBlock(rawBlock)
 
-		return nil
+		return err
 	})
 	if err != nil {
 		log.Println(err)
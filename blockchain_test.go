@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+)
+
+// utxoSnapshot reads the whole chainstate bucket the way FindUTXO returns it.
+func utxoSnapshot(t *testing.T, bc *Blockchain) map[string]TxOutputs {
+	UTXOs := make(map[string]TxOutputs)
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(utxoBucket)).ForEach(func(k, v []byte) error {
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			UTXOs[hex.EncodeToString(k)] = outs
+			return nil
+		})
+	})
+	assert.Nil(t, err)
+	return UTXOs
+}
+
+func TestBlockWork(t *testing.T) {
+	// 2^256 / (target+1) rounds down
+	assert.Equal(t, big.NewInt(255), BlockWork(BigToCompact(powLimit)))
+	assert.Equal(t, big.NewInt(1<<24-1), BlockWork(BigToCompact(new(big.Int).Lsh(big.NewInt(1), 232))))
+}
+
+func TestReceiveBlockReorganizes(t *testing.T) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+	aliceHash := HashPubKey(alice.PublicKey)
+	bobHash := testPubKeyHash("bob")
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	bc := newTestBlockchain(t, genesis)
+	bc.mempool = NewMempool()
+	UTXOSet := NewUTXOSet(bc)
+
+	spend := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 40, PubKeyHash: bobHash}})
+	main := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "main", 1, 10), spend)
+	assert.Nil(t, bc.ReceiveBlock(main))
+	assert.Equal(t, main.Hash, bc.lastBlockHash)
+	assert.Equal(t, []TxOutput{{Value: 40, PubKeyHash: bobHash}}, UTXOSet.FindUTXOs(bobHash))
+
+	// a branch with as much work as the main chain is only stored
+	side := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "side", 1, 0))
+	assert.Nil(t, bc.ReceiveBlock(side))
+	assert.True(t, bc.HasBlock(side.Hash))
+	assert.Equal(t, main.Hash, bc.lastBlockHash)
+
+	sideTip := mineTestBlock(side, newTestCoinbase(testAddress("miner"), "side", 2, 0))
+	assert.Nil(t, bc.ReceiveBlock(sideTip))
+	assert.Equal(t, sideTip.Hash, bc.lastBlockHash)
+	assert.Equal(t, 2, bc.BestHeight())
+
+	entry, err := bc.BlockIndex(sideTip.Hash)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, entry.Height)
+	assert.Equal(t, new(big.Int).Mul(big.NewInt(3), BlockWork(testBits)), entry.ChainWork)
+
+	// the spend is undone and waits in the mempool again
+	assert.Empty(t, UTXOSet.FindUTXOs(bobHash))
+	assert.Equal(t, []TxOutput{{Value: 50, PubKeyHash: aliceHash}}, UTXOSet.FindUTXOs(aliceHash))
+	assert.True(t, bc.mempool.Has(spend.ID))
+	assert.Equal(t, bc.FindUTXO(), utxoSnapshot(t, bc))
+
+	// the old branch wins back once it is longer
+	mainTip := mineTestBlock(main, newTestCoinbase(testAddress("miner"), "main", 2, 0))
+	assert.Nil(t, bc.ReceiveBlock(mainTip))
+	assert.Equal(t, sideTip.Hash, bc.lastBlockHash)
+	assert.Nil(t, bc.ReceiveBlock(mineTestBlock(mainTip, newTestCoinbase(testAddress("miner"), "main", 3, 0))))
+	assert.Equal(t, 3, bc.BestHeight())
+	assert.Equal(t, []TxOutput{{Value: 40, PubKeyHash: bobHash}}, UTXOSet.FindUTXOs(bobHash))
+	assert.False(t, bc.mempool.Has(spend.ID))
+	assert.Equal(t, bc.FindUTXO(), utxoSnapshot(t, bc))
+}
+
+func TestReceiveBlockRejectsInvalidBranch(t *testing.T) {
+	useTestGenesisBits(t)
+
+	genesis := mineTestBlock(nil, newTestCoinbase(testAddress("alice"), "genesis", 0, 0))
+	main := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "main", 1, 0))
+	bc := newTestBlockchain(t, genesis, main)
+	before := utxoSnapshot(t, bc)
+
+	// the overpaying coinbase is only caught when the block is connected
+	invalid := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "invalid", 1, 5))
+	assert.Nil(t, bc.ReceiveBlock(invalid))
+	child := mineTestBlock(invalid, newTestCoinbase(testAddress("miner"), "invalid", 2, 0))
+	assert.NotNil(t, bc.ReceiveBlock(child))
+
+	assert.Equal(t, main.Hash, bc.lastBlockHash)
+	assert.Equal(t, before, utxoSnapshot(t, bc))
+	entry, err := bc.BlockIndex(invalid.Hash)
+	assert.Nil(t, err)
+	assert.True(t, entry.Invalid)
+
+	assert.NotNil(t, bc.ReceiveBlock(mineTestBlock(child, newTestCoinbase(testAddress("miner"), "invalid", 3, 0))))
+	assert.Equal(t, main.Hash, bc.lastBlockHash)
+
+	second := mineTestBlock(nil, newTestCoinbase(testAddress("bob"), "genesis", 0, 0))
+	assert.NotNil(t, bc.ReceiveBlock(second))
+}
+
+func TestTipFollowsConnectAndDisconnect(t *testing.T) {
+	useTestGenesisBits(t)
+	genesis := mineTestBlock(nil, newTestCoinbase(testAddress("alice"), "genesis", 0, 0))
+	bc := newTestBlockchain(t, genesis)
+	assert.Equal(t, genesis.Hash, bc.Tip())
+
+	second := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0))
+	assert.Nil(t, bc.connectTip(second, true))
+	assert.Equal(t, second.Hash, bc.Tip())
+
+	_, err := bc.DisconnectBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, genesis.Hash, bc.Tip())
+	assert.Nil(t, (&Blockchain{}).Tip())
+}
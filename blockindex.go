@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	blockIndexBucket = "blockindex"
+	// height => hash of the main chain block at that height
+	heightIndexBucket = "heightindex"
+)
+
+// BlockIndexEntry is what the chain knows about every stored block, whether
+// it is on the main chain or on a side branch.
+type BlockIndexEntry struct {
+	Height int
+	// total work of the chain ending in this block
+	ChainWork *big.Int
+	// set once connecting the block failed, its descendants are refused
+	Invalid bool
+}
+
+// BlockWork is the expected number of hashes needed to find a block meeting
+// the target bits encode, 2^256 / (target+1).
+func BlockWork(bits uint32) *big.Int {
+	target := CompactToBig(bits)
+	if target.Sign() < 0 {
+		return big.NewInt(0)
+	}
+	denominator := new(big.Int).Add(target, big.NewInt(1))
+	return new(big.Int).Div(new(big.Int).Lsh(big.NewInt(1), 256), denominator)
+}
+
+func (e *BlockIndexEntry) Serialize() []byte {
+	w := &serialWriter{}
+	w.writeUint8(SERIALIZATION_VERSION)
+	w.writeVarInt(uint64(e.Height))
+	w.writeBytes(e.ChainWork.Bytes())
+	if e.Invalid {
+		w.writeUint8(1)
+	} else {
+		w.writeUint8(0)
+	}
+	return w.Bytes()
+}
+
+func DeserializeBlockIndexEntry(d []byte) (*BlockIndexEntry, error) {
+	r := &serialReader{data: d}
+	r.readVersion("block index entry")
+	e := &BlockIndexEntry{
+		Height:    int(r.readVarInt("height")),
+		ChainWork: new(big.Int).SetBytes(r.readBytes("chain work")),
+		Invalid:   r.readUint8("status") != 0,
+	}
+	if err := r.finish("block index entry"); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func getBlockIndex(tx *bolt.Tx, hash []byte) (*BlockIndexEntry, error) {
+	b := tx.Bucket([]byte(blockIndexBucket))
+	if b == nil {
+		return nil, fmt.Errorf("block %x is not indexed", hash)
+	}
+	raw := b.Get(hash)
+	if raw == nil {
+		return nil, fmt.Errorf("block %x is not indexed", hash)
+	}
+	return DeserializeBlockIndexEntry(raw)
+}
+
+// storeBlock writes block and its index entry, which adds the block's work to
+// its parent's. The parent has to be indexed already.
+func storeBlock(tx *bolt.Tx, block *Block) (*BlockIndexEntry, error) {
+	entry := &BlockIndexEntry{Height: block.Height, ChainWork: BlockWork(block.Bits)}
+	if len(block.PrevBlockHash) != 0 {
+		parent, err := getBlockIndex(tx, block.PrevBlockHash)
+		if err != nil {
+			return nil, err
+		}
+		entry.ChainWork.Add(entry.ChainWork, parent.ChainWork)
+	}
+
+	bBlock, err := block.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Bucket([]byte(blocksBucket)).Put(block.Hash, bBlock); err != nil {
+		return nil, err
+	}
+	index, err := tx.CreateBucketIfNotExists([]byte(blockIndexBucket))
+	if err != nil {
+		return nil, err
+	}
+	return entry, index.Put(block.Hash, entry.Serialize())
+}
+
+// heightKey encodes height big endian so the keys sort by height.
+func heightKey(height int) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(height))
+}
+
+func putHeight(tx *bolt.Tx, block *Block) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(heightIndexBucket))
+	if err != nil {
+		return err
+	}
+	return b.Put(heightKey(block.Height), block.Hash)
+}
+
+func deleteHeight(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(heightIndexBucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete(heightKey(block.Height))
+}
+
+// BlockHashByHeight returns the hash of the main chain block at height.
+func (bc *Blockchain) BlockHashByHeight(height int) ([]byte, error) {
+	var hash []byte
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		if b := tx.Bucket([]byte(heightIndexBucket)); b != nil && height >= 0 {
+			hash = append(hash, b.Get(heightKey(height))...)
+		}
+		if len(hash) == 0 {
+			return fmt.Errorf("block at height %d is %w", height, ErrNotFound)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hash, nil
+}
+
+func (bc *Blockchain) BlockByHeight(height int) (*Block, error) {
+	hash, err := bc.BlockHashByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	return bc.BlockByHash(hash)
+}
+
+func (bc *Blockchain) BlockIndex(hash []byte) (*BlockIndexEntry, error) {
+	var entry *BlockIndexEntry
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		entry, err = getBlockIndex(tx, hash)
+		return err
+	})
+
+	return entry, err
+}
+
+func (bc *Blockchain) markInvalid(hash []byte) error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		entry, err := getBlockIndex(tx, hash)
+		if err != nil {
+			return err
+		}
+		entry.Invalid = true
+		return tx.Bucket([]byte(blockIndexBucket)).Put(hash, entry.Serialize())
+	})
+}
+
+// reindexBlocks builds the block and height indexes of a chain stored
+// before they existed, which only ever had its main chain.
+func reindexBlocks(db *bolt.DB, tip []byte) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		blocks := tx.Bucket([]byte(blocksBucket))
+
+		var chain []*Block
+		for hash := tip; len(hash) != 0; {
+			block, err := DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return fmt.Errorf("block %x can't be decoded, chains stored with gob need migratechain: %w", hash, err)
+			}
+			chain = append(chain, block)
+			hash = block.PrevBlockHash
+		}
+		for i := len(chain) - 1; i >= 0; i-- {
+			if _, err := storeBlock(tx, chain[i]); err != nil {
+				return err
+			}
+			if err := putHeight(tx, chain[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockByHeight(t *testing.T) {
+	useTestGenesisBits(t)
+
+	genesis := mineTestBlock(nil, newTestCoinbase(testAddress("alice"), "genesis", 0, 0))
+	first := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "main", 1, 0))
+	second := mineTestBlock(first, newTestCoinbase(testAddress("miner"), "main", 2, 0))
+	bc := newTestBlockchain(t, genesis, first, second)
+
+	block, err := bc.BlockByHeight(1)
+	assert.Nil(t, err)
+	assert.Equal(t, first.Hash, block.Hash)
+	for _, height := range []int{-1, 3} {
+		_, err = bc.BlockByHeight(height)
+		assert.NotNil(t, err)
+	}
+
+	_, err = bc.DisconnectBlock()
+	assert.Nil(t, err)
+	_, err = bc.BlockHashByHeight(2)
+	assert.NotNil(t, err)
+
+	// heights follow the main chain through a reorganization
+	sideFirst := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "side", 1, 0))
+	sideSecond := mineTestBlock(sideFirst, newTestCoinbase(testAddress("miner"), "side", 2, 0))
+	assert.Nil(t, bc.ReceiveBlock(sideFirst))
+	assert.Nil(t, bc.ReceiveBlock(sideSecond))
+	for height, want := range []*Block{genesis, sideFirst, sideSecond} {
+		hash, err := bc.BlockHashByHeight(height)
+		assert.Nil(t, err)
+		assert.Equal(t, want.Hash, hash)
+	}
+
+	// chains stored before the height index existed get it when opened
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(heightIndexBucket))
+	})
+	assert.Nil(t, err)
+	bc = newBlockchain(bc.db, bc.lastBlockHash)
+	hash, err := bc.BlockHashByHeight(2)
+	assert.Nil(t, err)
+	assert.Equal(t, sideSecond.Hash, hash)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+)
+
+// BlockInfo describes a block for people and JSON clients, hashes hex
+// encoded and outputs as addresses of the active network.
+type BlockInfo struct {
+	Hash   string `json:"hash"`
+	Height int    `json:"height"`
+	// blocks on top of it and itself, -1 for a block on a side branch
+	Confirmations int      `json:"confirmations"`
+	PrevBlockHash string   `json:"previousblockhash,omitempty"`
+	NextBlockHash string   `json:"nextblockhash,omitempty"`
+	MerkleRoot    string   `json:"merkleroot"`
+	Time          int64    `json:"time"`
+	Bits          string   `json:"bits"`
+	Nonce         int      `json:"nonce"`
+	ChainWork     string   `json:"chainwork"`
+	Transactions  []TxInfo `json:"tx"`
+}
+
+type TxInfo struct {
+	TxID    string         `json:"txid"`
+	Size    int            `json:"size"`
+	Inputs  []TxInputInfo  `json:"vin"`
+	Outputs []TxOutputInfo `json:"vout"`
+}
+
+// ConfirmedTxInfo is a main chain transaction and the block confirming it.
+type ConfirmedTxInfo struct {
+	TxInfo
+	BlockHash     string `json:"blockhash"`
+	Height        int    `json:"height"`
+	Confirmations int    `json:"confirmations"`
+}
+
+// TxInputInfo is the output an input spends, or the data of a coinbase.
+type TxInputInfo struct {
+	TxID     string `json:"txid,omitempty"`
+	Vout     int    `json:"vout"`
+	Address  string `json:"address,omitempty"`
+	Coinbase string `json:"coinbase,omitempty"`
+}
+
+type TxOutputInfo struct {
+	Value   int    `json:"value"`
+	Address string `json:"address"`
+}
+
+func NewTxInfo(tx *Transaction) (TxInfo, error) {
+	bTx, err := tx.Serialize()
+	if err != nil {
+		return TxInfo{}, err
+	}
+	info := TxInfo{
+		TxID:    hex.EncodeToString(tx.ID),
+		Size:    len(bTx),
+		Inputs:  []TxInputInfo{},
+		Outputs: []TxOutputInfo{},
+	}
+
+	for _, in := range tx.VIn {
+		if tx.IsCoinBase() {
+			info.Inputs = append(info.Inputs, TxInputInfo{Vout: in.Vout, Coinbase: hex.EncodeToString(in.PubKey)})
+			continue
+		}
+		info.Inputs = append(info.Inputs, TxInputInfo{
+			TxID:    hex.EncodeToString(in.Txid),
+			Vout:    in.Vout,
+			Address: string(pubKeyHashAddress(HashPubKey(in.PubKey))),
+		})
+	}
+	for _, out := range tx.VOut {
+		info.Outputs = append(info.Outputs, TxOutputInfo{
+			Value:   out.Value,
+			Address: string(pubKeyHashAddress(out.PubKeyHash)),
+		})
+	}
+	return info, nil
+}
+
+// BlockInfo describes block, which may be on a side branch, relative to the
+// current main chain.
+func (bc *Blockchain) BlockInfo(block *Block) (*BlockInfo, error) {
+	entry, err := bc.BlockIndex(block.Hash)
+	if err != nil {
+		return nil, err
+	}
+	info := &BlockInfo{
+		Hash:          hex.EncodeToString(block.Hash),
+		Height:        block.Height,
+		Confirmations: -1,
+		PrevBlockHash: hex.EncodeToString(block.PrevBlockHash),
+		MerkleRoot:    hex.EncodeToString(block.MerkleRoot),
+		Time:          block.Timestamp,
+		Bits:          fmt.Sprintf("%08x", block.Bits),
+		Nonce:         block.Nonce,
+		ChainWork:     fmt.Sprintf("%064x", entry.ChainWork),
+		Transactions:  []TxInfo{},
+	}
+
+	if hash, err := bc.BlockHashByHeight(block.Height); err == nil && bytes.Equal(hash, block.Hash) {
+		info.Confirmations = bc.BestHeight() - block.Height + 1
+		if next, err := bc.BlockHashByHeight(block.Height + 1); err == nil {
+			info.NextBlockHash = hex.EncodeToString(next)
+		}
+	}
+	for _, tx := range block.TXs {
+		txInfo, err := NewTxInfo(tx)
+		if err != nil {
+			return nil, err
+		}
+		info.Transactions = append(info.Transactions, txInfo)
+	}
+	return info, nil
+}
+
+func (bc *Blockchain) TransactionInfo(ID []byte) (*ConfirmedTxInfo, error) {
+	tx, block, err := bc.LocateTransaction(ID)
+	if err != nil {
+		return nil, err
+	}
+	txInfo, err := NewTxInfo(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &ConfirmedTxInfo{
+		TxInfo:        txInfo,
+		BlockHash:     hex.EncodeToString(block.Hash),
+		Height:        block.Height,
+		Confirmations: bc.BestHeight() - block.Height + 1,
+	}, nil
+}
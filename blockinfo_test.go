@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockInfo(t *testing.T) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	spend := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 50, PubKeyHash: testPubKeyHash("bob")}})
+	second := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0), spend)
+	bc := newTestBlockchain(t, genesis, second)
+
+	info, err := bc.BlockInfo(genesis)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, info.Confirmations)
+	assert.Equal(t, hex.EncodeToString(second.Hash), info.NextBlockHash)
+	assert.Equal(t, hex.EncodeToString(coinbase.ID), info.Transactions[0].TxID)
+	assert.Equal(t, []TxOutputInfo{{Value: 50, Address: string(alice.GetAddress())}}, info.Transactions[0].Outputs)
+
+	raw, err := json.Marshal(info)
+	assert.Nil(t, err)
+	var fields map[string]interface{}
+	assert.Nil(t, json.Unmarshal(raw, &fields))
+	assert.NotContains(t, fields, "previousblockhash")
+	assert.Equal(t, float64(0), fields["height"])
+
+	info, err = bc.BlockInfo(second)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, info.Confirmations)
+	assert.Empty(t, info.NextBlockHash)
+	assert.Equal(t, []TxInputInfo{{TxID: hex.EncodeToString(coinbase.ID), Vout: 0, Address: string(alice.GetAddress())}}, info.Transactions[1].Inputs)
+
+	side := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "side", 1, 0))
+	assert.Nil(t, bc.ReceiveBlock(side))
+	info, err = bc.BlockInfo(side)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, info.Confirmations)
+}
@@ -1,31 +1,67 @@
 package main
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
-type CLI struct {
-	bc *Blockchain
-}
+// CLI opens the chain named by each command itself, so running a command
+// doesn't lock a database that a node or another command needs.
+type CLI struct{}
 
-func NewCLI(bc *Blockchain) *CLI {
-	return &CLI{
-		bc: bc,
-	}
+func NewCLI() *CLI {
+	return &CLI{}
 }
 
 func (cli *CLI) Run() error {
+	network, err := networkFromEnv()
+	if err != nil {
+		return err
+	}
+	activeNetwork = network
+
 	addBlockCmd := flag.NewFlagSet("addblock", flag.ExitOnError)
 	printchainCmd := flag.NewFlagSet("printchain", flag.ExitOnError)
 	createBlockchainCmd := flag.NewFlagSet("createblockchain", flag.ExitOnError)
 	getBalanceCmd := flag.NewFlagSet("getbalance", flag.ExitOnError)
 	sendCmd := flag.NewFlagSet("send", flag.ExitOnError)
+	reindexUTXOCmd := flag.NewFlagSet("reindexutxo", flag.ExitOnError)
+	merkleProofCmd := flag.NewFlagSet("merkleproof", flag.ExitOnError)
+	verifyMerkleProofCmd := flag.NewFlagSet("verifymerkleproof", flag.ExitOnError)
+	verifyChainCmd := flag.NewFlagSet("verifychain", flag.ExitOnError)
+	startNodeCmd := flag.NewFlagSet("startnode", flag.ExitOnError)
+	mineCmd := flag.NewFlagSet("mine", flag.ExitOnError)
+	createWalletCmd := flag.NewFlagSet("createwallet", flag.ExitOnError)
+	listAddressesCmd := flag.NewFlagSet("listaddresses", flag.ExitOnError)
+	getAddressCmd := flag.NewFlagSet("getaddress", flag.ExitOnError)
+	encryptWalletCmd := flag.NewFlagSet("encryptwallet", flag.ExitOnError)
+	walletPassphraseChangeCmd := flag.NewFlagSet("walletpassphrasechange", flag.ExitOnError)
+	createHDWalletCmd := flag.NewFlagSet("createhdwallet", flag.ExitOnError)
+	restoreWalletCmd := flag.NewFlagSet("restorewallet", flag.ExitOnError)
+	rescanWalletCmd := flag.NewFlagSet("rescanwallet", flag.ExitOnError)
+	validateAddressCmd := flag.NewFlagSet("validateaddress", flag.ExitOnError)
+	migrateChainCmd := flag.NewFlagSet("migratechain", flag.ExitOnError)
+	estimateFeeCmd := flag.NewFlagSet("estimatefee", flag.ExitOnError)
+	getBlockCmd := flag.NewFlagSet("getblock", flag.ExitOnError)
+	getBlockHashCmd := flag.NewFlagSet("getblockhash", flag.ExitOnError)
+	getBlockCountCmd := flag.NewFlagSet("getblockcount", flag.ExitOnError)
+	reindexCmd := flag.NewFlagSet("reindex", flag.ExitOnError)
+	getTransactionCmd := flag.NewFlagSet("gettransaction", flag.ExitOnError)
+	listTransactionsCmd := flag.NewFlagSet("listtransactions", flag.ExitOnError)
+	restAPICmd := flag.NewFlagSet("restapi", flag.ExitOnError)
+	explorerCmd := flag.NewFlagSet("explorer", flag.ExitOnError)
 
 	createBlockchainAddress := createBlockchainCmd.String("address", "", "user wallet address")
 	createBlockchainName := createBlockchainCmd.String("name", "", "blockchain name")
+	createBlockchainHalvingInterval := createBlockchainCmd.Int("halvinginterval", HALVING_INTERVAL, "blocks after which the subsidy is cut in half, fixed once the chain is created")
 
 	printchainAddress := printchainCmd.String("address", "", "user wallet address")
 	printchainName := printchainCmd.String("name", "", "blockchain name")
@@ -37,6 +73,117 @@ func (cli *CLI) Run() error {
 	sendCmdTo := sendCmd.String("to", "", "blockchain name")
 	sendCmdName := sendCmd.String("name", "", "blockchain name")
 	sendCmdAmount := sendCmd.String("amount", "", "blockchain name")
+	sendCmdMempool := sendCmd.Bool("mempool", false, "submit the transaction to a node's mempool instead of mining it")
+	sendCmdNode := sendCmd.String("node", "localhost:3000", "node that receives the transaction with -mempool")
+	sendCmdPassphrase := sendCmd.String("passphrase", "", "passphrase that unlocks an encrypted wallet")
+	sendCmdFee := sendCmd.Int("fee", 0, "flat fee paid instead of -feerate")
+	sendCmdFeeRate := sendCmd.Float64("feerate", 0, "fee paid per byte of the transaction, estimated when not set")
+	sendCmdBlocks := sendCmd.Int("blocks", DEFAULT_CONFIRM_TARGET, "blocks the estimated fee rate should confirm the transaction within")
+	sendCmdSelection := sendCmd.String("selection", "bnb", "coin selection: largest, smallest or bnb")
+
+	reindexUTXOAddress := reindexUTXOCmd.String("address", "", "user wallet address")
+	reindexUTXOName := reindexUTXOCmd.String("name", "", "blockchain name")
+
+	merkleProofAddress := merkleProofCmd.String("address", "", "user wallet address")
+	merkleProofName := merkleProofCmd.String("name", "", "blockchain name")
+	merkleProofTxID := merkleProofCmd.String("txid", "", "hex encoded transaction id")
+
+	verifyMerkleProofRoot := verifyMerkleProofCmd.String("root", "", "hex encoded merkle root of the block")
+	verifyMerkleProofTxID := verifyMerkleProofCmd.String("txid", "", "hex encoded transaction id")
+	verifyMerkleProofIndex := verifyMerkleProofCmd.Int("index", 0, "position of the transaction in the block")
+	verifyMerkleProofHashes := verifyMerkleProofCmd.String("proof", "", "comma separated hex encoded sibling hashes")
+
+	verifyChainAddress := verifyChainCmd.String("address", "", "user wallet address")
+	verifyChainName := verifyChainCmd.String("name", "", "blockchain name")
+	verifyChainFromHeight := verifyChainCmd.Int("from-height", 0, "first block height to validate")
+
+	startNodePort := startNodeCmd.Int("port", 3000, "port the node listens on")
+	startNodeName := startNodeCmd.String("name", "", "blockchain name, defaults to blockchain_<port>")
+	startNodeMiner := startNodeCmd.String("miner", "", "mine relayed transactions and pay the rewards to this address")
+	startNodePeers := startNodeCmd.String("peers", "", "comma separated host:port of nodes to connect to")
+	startNodeRPCPort := startNodeCmd.Int("rpcport", 0, "serve JSON-RPC on this localhost port, off when 0")
+	startNodeRPCUser := startNodeCmd.String("rpcuser", "", "basic auth user of the JSON-RPC server")
+	startNodeRPCPassword := startNodeCmd.String("rpcpassword", "", "basic auth password of the JSON-RPC server")
+	startNodeRESTPort := startNodeCmd.Int("restport", 0, "serve the read-only REST API on this localhost port, off when 0")
+	startNodeExplorerPort := startNodeCmd.Int("explorerport", 0, "serve the web explorer on this localhost port, off when 0")
+	startNodeHalvingInterval := startNodeCmd.Int("halvinginterval", 0, "halving interval of the chain to download when the node starts empty, the chain's own when 0")
+
+	mineNode := mineCmd.String("node", "localhost:3000", "node whose mempool is mined")
+	mineMiner := mineCmd.String("miner", "", "address the block reward is paid to")
+	mineMaxTxs := mineCmd.Int("max", MAX_BLOCK_TXS, "maximum number of mempool transactions in the block")
+
+	createWalletName := createWalletCmd.String("name", "", "blockchain name")
+	createWalletPassphrase := createWalletCmd.String("passphrase", "", "passphrase that unlocks an encrypted wallet")
+	createWalletAccount := createWalletCmd.Uint("account", 0, "account the address is derived for in an HD wallet")
+	createWalletChange := createWalletCmd.Bool("change", false, "derive a change address instead of a receiving one")
+	createWalletFormat := createWalletCmd.String("format", "base58", "address format: base58, bech32 or bech32m")
+	listAddressesName := listAddressesCmd.String("name", "", "blockchain name")
+	listAddressesFormat := listAddressesCmd.String("format", "base58", "address format: base58, bech32 or bech32m")
+	getAddressName := getAddressCmd.String("name", "", "blockchain name")
+	getAddressAddress := getAddressCmd.String("address", "", "wallet address, defaults to the first one created")
+
+	encryptWalletName := encryptWalletCmd.String("name", "", "blockchain name")
+	encryptWalletPassphrase := encryptWalletCmd.String("passphrase", "", "passphrase the wallet is encrypted with")
+
+	walletPassphraseChangeName := walletPassphraseChangeCmd.String("name", "", "blockchain name")
+	walletPassphraseChangeOld := walletPassphraseChangeCmd.String("old", "", "current passphrase")
+	walletPassphraseChangeNew := walletPassphraseChangeCmd.String("new", "", "new passphrase")
+
+	createHDWalletName := createHDWalletCmd.String("name", "", "blockchain name")
+	createHDWalletPassphrase := createHDWalletCmd.String("passphrase", "", "passphrase that unlocks an encrypted wallet")
+	createHDWalletWords := createHDWalletCmd.Int("words", MNEMONIC_WORDS_DEFAULT, "number of mnemonic words, 12 to 24")
+	createHDWalletMnemonicPassphrase := createHDWalletCmd.String("mnemonic-passphrase", "", "optional passphrase extending the mnemonic")
+
+	restoreWalletName := restoreWalletCmd.String("name", "", "blockchain name")
+	restoreWalletPassphrase := restoreWalletCmd.String("passphrase", "", "passphrase that unlocks an encrypted wallet")
+	restoreWalletMnemonic := restoreWalletCmd.String("mnemonic", "", "space separated mnemonic words")
+	restoreWalletMnemonicPassphrase := restoreWalletCmd.String("mnemonic-passphrase", "", "passphrase the mnemonic was created with")
+	restoreWalletGap := restoreWalletCmd.Int("gap", ADDRESS_GAP_LIMIT, "unused addresses in a row after which the rescan stops")
+
+	rescanWalletName := rescanWalletCmd.String("name", "", "blockchain name")
+	rescanWalletPassphrase := rescanWalletCmd.String("passphrase", "", "passphrase that unlocks an encrypted wallet")
+	rescanWalletGap := rescanWalletCmd.Int("gap", ADDRESS_GAP_LIMIT, "unused addresses in a row after which the rescan stops")
+
+	validateAddressAddress := validateAddressCmd.String("address", "", "address to check")
+	validateAddressNetwork := validateAddressCmd.String("network", "", "network the address must belong to, defaults to BLOCKCHAIN_NETWORK or mainnet")
+
+	migrateChainName := migrateChainCmd.String("name", "", "blockchain name")
+
+	estimateFeeBlocks := estimateFeeCmd.Int("blocks", DEFAULT_CONFIRM_TARGET, "blocks the transaction should be confirmed within")
+	estimateFeeName := estimateFeeCmd.String("name", "", "blockchain name")
+	estimateFeeNode := estimateFeeCmd.String("node", "", "ask this node, which also knows its mempool, instead of reading the chain")
+
+	getBlockName := getBlockCmd.String("name", "", "blockchain name")
+	getBlockHash := getBlockCmd.String("hash", "", "hex encoded block hash")
+	getBlockHeight := getBlockCmd.Int("height", -1, "height of the main chain block, instead of -hash")
+	getBlockJSON := getBlockCmd.Bool("json", false, "print JSON")
+
+	getBlockHashName := getBlockHashCmd.String("name", "", "blockchain name")
+	getBlockHashHeight := getBlockHashCmd.Int("height", 0, "height of the main chain block")
+	getBlockHashJSON := getBlockHashCmd.Bool("json", false, "print JSON")
+
+	getBlockCountName := getBlockCountCmd.String("name", "", "blockchain name")
+	getBlockCountJSON := getBlockCountCmd.Bool("json", false, "print JSON")
+
+	reindexName := reindexCmd.String("name", "", "blockchain name")
+	reindexTxIndex := reindexCmd.Bool("txindex", false, "build the transaction index, which is kept up to date from then on")
+	reindexAddrIndex := reindexCmd.Bool("addrindex", false, "build the address index, which is kept up to date from then on")
+
+	getTransactionName := getTransactionCmd.String("name", "", "blockchain name")
+	getTransactionID := getTransactionCmd.String("id", "", "hex encoded transaction id")
+	getTransactionJSON := getTransactionCmd.Bool("json", false, "print JSON")
+
+	listTransactionsAddress := listTransactionsCmd.String("address", "", "address to list the history of")
+	listTransactionsName := listTransactionsCmd.String("name", "", "blockchain name")
+	listTransactionsSkip := listTransactionsCmd.Int("skip", 0, "number of oldest transactions to skip")
+	listTransactionsCount := listTransactionsCmd.Int("count", 10, "number of transactions to list, 0 for all")
+	listTransactionsJSON := listTransactionsCmd.Bool("json", false, "print JSON")
+
+	restAPIName := restAPICmd.String("name", "", "blockchain name")
+	restAPIPort := restAPICmd.Int("port", 8080, "localhost port the REST API listens on")
+
+	explorerName := explorerCmd.String("name", "", "blockchain name")
+	explorerPort := explorerCmd.Int("port", 8000, "localhost port the web explorer listens on")
 
 	switch os.Args[1] {
 	case "addblock":
@@ -64,6 +211,131 @@ func (cli *CLI) Run() error {
 		if err != nil {
 			return err
 		}
+	case "reindexutxo":
+		err := reindexUTXOCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "merkleproof":
+		err := merkleProofCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "verifymerkleproof":
+		err := verifyMerkleProofCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "verifychain":
+		err := verifyChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "startnode":
+		err := startNodeCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "mine":
+		err := mineCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "createwallet":
+		err := createWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "listaddresses":
+		err := listAddressesCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "getaddress":
+		err := getAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "encryptwallet":
+		err := encryptWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "walletpassphrasechange":
+		err := walletPassphraseChangeCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "createhdwallet":
+		err := createHDWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "restorewallet":
+		err := restoreWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "rescanwallet":
+		err := rescanWalletCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "validateaddress":
+		err := validateAddressCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "migratechain":
+		err := migrateChainCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "estimatefee":
+		err := estimateFeeCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "getblock":
+		err := getBlockCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "getblockhash":
+		err := getBlockHashCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "getblockcount":
+		err := getBlockCountCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "reindex":
+		err := reindexCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "gettransaction":
+		err := getTransactionCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "listtransactions":
+		err := listTransactionsCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "restapi":
+		err := restAPICmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
+	case "explorer":
+		err := explorerCmd.Parse(os.Args[2:])
+		if err != nil {
+			return err
+		}
 	default:
 		os.Exit(1)
 	}
@@ -75,7 +347,7 @@ func (cli *CLI) Run() error {
 		cli.printChain(*printchainAddress, *printchainName)
 	}
 	if createBlockchainCmd.Parsed() {
-		cli.createBlockchain(*createBlockchainAddress, *createBlockchainName)
+		cli.createBlockchain(*createBlockchainAddress, *createBlockchainName, *createBlockchainHalvingInterval)
 	}
 
 	if getBalanceCmd.Parsed() {
@@ -87,7 +359,137 @@ func (cli *CLI) Run() error {
 		if err != nil {
 			panic("invalid amount")
 		}
-		cli.send(*sendCmdFrom, *sendCmdTo, *sendCmdName, amount)
+		if *sendCmdFee < 0 || *sendCmdFeeRate < 0 {
+			return errors.New("fee and fee rate can't be negative")
+		}
+		// without -fee or -feerate send estimates the fee rate, -fee wins
+		// over -feerate
+		var fees FeePolicy
+		var flatFee bool
+		sendCmd.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "fee":
+				flatFee = true
+			case "feerate":
+				fees = FeeRate(*sendCmdFeeRate)
+			}
+		})
+		if flatFee {
+			fees = FlatFee(*sendCmdFee)
+		}
+		selector, err := ParseCoinSelector(*sendCmdSelection)
+		if err != nil {
+			return err
+		}
+		cli.send(*sendCmdFrom, *sendCmdTo, *sendCmdName, amount, fees, *sendCmdBlocks, selector, *sendCmdMempool, *sendCmdNode, *sendCmdPassphrase)
+	}
+
+	if reindexUTXOCmd.Parsed() {
+		cli.reindexUTXO(*reindexUTXOAddress, *reindexUTXOName)
+	}
+
+	if merkleProofCmd.Parsed() {
+		cli.merkleProof(*merkleProofAddress, *merkleProofName, *merkleProofTxID)
+	}
+
+	if verifyMerkleProofCmd.Parsed() {
+		cli.verifyMerkleProof(*verifyMerkleProofRoot, *verifyMerkleProofTxID, *verifyMerkleProofIndex, *verifyMerkleProofHashes)
+	}
+
+	if verifyChainCmd.Parsed() {
+		cli.verifyChain(*verifyChainAddress, *verifyChainName, *verifyChainFromHeight)
+	}
+
+	if startNodeCmd.Parsed() {
+		return cli.startNode(*startNodePort, *startNodeName, *startNodeMiner, *startNodePeers, *startNodeRPCPort, *startNodeRPCUser, *startNodeRPCPassword, *startNodeRESTPort, *startNodeExplorerPort, *startNodeHalvingInterval)
+	}
+
+	if mineCmd.Parsed() {
+		cli.mine(*mineNode, *mineMiner, *mineMaxTxs)
+	}
+
+	if createWalletCmd.Parsed() {
+		format, err := ParseAddressFormat(*createWalletFormat)
+		if err != nil {
+			return err
+		}
+		cli.createWallet(*createWalletName, *createWalletPassphrase, *createWalletAccount, *createWalletChange, format)
+	}
+
+	if listAddressesCmd.Parsed() {
+		format, err := ParseAddressFormat(*listAddressesFormat)
+		if err != nil {
+			return err
+		}
+		cli.listAddresses(*listAddressesName, format)
+	}
+
+	if getAddressCmd.Parsed() {
+		cli.getAddress(*getAddressName, *getAddressAddress)
+	}
+
+	if encryptWalletCmd.Parsed() {
+		cli.encryptWallet(*encryptWalletName, *encryptWalletPassphrase)
+	}
+
+	if walletPassphraseChangeCmd.Parsed() {
+		cli.walletPassphraseChange(*walletPassphraseChangeName, *walletPassphraseChangeOld, *walletPassphraseChangeNew)
+	}
+
+	if createHDWalletCmd.Parsed() {
+		cli.createHDWallet(*createHDWalletName, *createHDWalletPassphrase, *createHDWalletWords, *createHDWalletMnemonicPassphrase)
+	}
+
+	if restoreWalletCmd.Parsed() {
+		cli.restoreWallet(*restoreWalletName, *restoreWalletPassphrase, *restoreWalletMnemonic, *restoreWalletMnemonicPassphrase, *restoreWalletGap)
+	}
+
+	if rescanWalletCmd.Parsed() {
+		cli.rescanWallet(*rescanWalletName, *rescanWalletPassphrase, *rescanWalletGap)
+	}
+
+	if validateAddressCmd.Parsed() {
+		return cli.validateAddress(*validateAddressAddress, *validateAddressNetwork)
+	}
+
+	if migrateChainCmd.Parsed() {
+		return cli.migrateChain(*migrateChainName)
+	}
+
+	if estimateFeeCmd.Parsed() {
+		cli.estimateFee(*estimateFeeName, *estimateFeeNode, *estimateFeeBlocks)
+	}
+
+	if getBlockCmd.Parsed() {
+		return cli.getBlock(*getBlockName, *getBlockHash, *getBlockHeight, *getBlockJSON)
+	}
+
+	if getBlockHashCmd.Parsed() {
+		return cli.getBlockHash(*getBlockHashName, *getBlockHashHeight, *getBlockHashJSON)
+	}
+
+	if getBlockCountCmd.Parsed() {
+		return cli.getBlockCount(*getBlockCountName, *getBlockCountJSON)
+	}
+
+	if reindexCmd.Parsed() {
+		return cli.reindex(*reindexName, *reindexTxIndex, *reindexAddrIndex)
+	}
+
+	if getTransactionCmd.Parsed() {
+		return cli.getTransaction(*getTransactionName, *getTransactionID, *getTransactionJSON)
+	}
+
+	if listTransactionsCmd.Parsed() {
+		return cli.listTransactions(*listTransactionsAddress, *listTransactionsName, *listTransactionsSkip, *listTransactionsCount, *listTransactionsJSON)
+	}
+
+	if restAPICmd.Parsed() {
+		return cli.restAPI(*restAPIName, *restAPIPort)
+	}
+
+	if explorerCmd.Parsed() {
+		return cli.explorer(*explorerName, *explorerPort)
 	}
 	return nil
 }
@@ -110,8 +512,14 @@ func (cli *CLI) printChain(address, blockchainName string) {
 		fmt.Printf("Prev Block Hash: %x\n", block.PrevBlockHash)
 		// fmt.Printf("Data: %s\n", block.Data)
 		fmt.Printf("Block Hash: %x\n", block.Hash)
+		fmt.Printf("Height: %d\n", block.Height)
+		fmt.Printf("Bits: %08x\n", block.Bits)
+		bits, err := bc.ExpectedTargetBits(block)
+		if err != nil {
+			log.Println(err)
+		}
 		pow := NewProofOfWork(block)
-		fmt.Printf("POW: %s\n", strconv.FormatBool(pow.IsValid()))
+		fmt.Printf("POW: %s\n", strconv.FormatBool(pow.IsValid(bits)))
 		fmt.Println("Transactions: ")
 		for _, tx := range block.TXs {
 			fmt.Printf("TxID: %x\n", tx.ID)
@@ -136,10 +544,15 @@ func (cli *CLI) printChain(address, blockchainName string) {
 }
 
 func (cli *CLI) getBalance(address, blockchainName string) {
+	pubKeyHash, err := AddressPubKeyHash(address)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
 	bc := NewBlockchain(address, blockchainName)
 	defer bc.db.Close()
 
-	UTXOs := bc.FindUTXOs(address)
+	UTXOs := NewUTXOSet(bc).FindUTXOs(pubKeyHash)
 	balance := 0
 	for _, UTXO := range UTXOs {
 		balance += UTXO.Value
@@ -147,17 +560,723 @@ func (cli *CLI) getBalance(address, blockchainName string) {
 	fmt.Printf("Your Coin Balance is: %d\n", balance)
 }
 
-func (cli *CLI) send(from, to, blockchainName string, amount int) {
+func (cli *CLI) send(from, to, blockchainName string, amount int, fees FeePolicy, blocks int, selector CoinSelector, mempool bool, node, passphrase string) {
+	for _, address := range []string{from, to} {
+		if err := ValidateAddress(address); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
 	bc := NewBlockchain(from, blockchainName)
 	defer bc.db.Close()
 
-	tx := NewUTXOTransaction(from, to, amount, bc)
+	wallets, err := NewWallets(blockchainName)
+	must(err)
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer wallets.Lock()
+	wallet, err := wallets.GetWallet(from)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if fees == nil {
+		// the node's mempool knows more than the local chain
+		estimateFrom := ""
+		if mempool {
+			estimateFrom = node
+		}
+		fees = estimateFeeRate(bc, estimateFrom, blocks)
+	}
+	// coins the node's mempool already spends would make a conflicting
+	// transaction
+	var exclude map[string]bool
+	if mempool {
+		pending, err := RequestMempool(node)
+		if err != nil {
+			fmt.Printf("Unable to read the mempool of %s: %s\n", node, err)
+			return
+		}
+		exclude = spentOutpoints(pending)
+	}
+	UTXOSet := NewUTXOSet(bc)
+	tx, err := NewUTXOTransaction(wallet, to, amount, fees, selector, UTXOSet, exclude)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if fee, err := UTXOSet.BlockFees([]*Transaction{tx}); err == nil {
+		fmt.Printf("Transaction %x pays a fee of %d\n", tx.ID, fee)
+	}
 
-	bc.AddBlock([]*Transaction{tx})
+	if mempool {
+		if err := SendTransaction(node, tx); err != nil {
+			fmt.Printf("Transaction %x was rejected by %s: %s\n", tx.ID, node, err)
+			return
+		}
+		fmt.Printf("Transaction %x submitted to the mempool of %s\n", tx.ID, node)
+		return
+	}
+
+	if bc.MineBlock(from, []*Transaction{tx}) == nil {
+		fmt.Printf("Transfer %d from %s to %s failed, the block wasn't mined\n", amount, from, to)
+		return
+	}
 
 	fmt.Printf("Transfer %d from %s to %s completed successfully", amount, from, to)
 }
 
-func (cli *CLI) createBlockchain(address, name string) {
-	NewBlockchain(address, name)
+func (cli *CLI) createBlockchain(address, name string, halvingInterval int) {
+	if err := ValidateAddress(address); err != nil {
+		fmt.Println(err)
+		return
+	}
+	if halvingInterval <= 0 {
+		fmt.Printf("halving interval must be positive, not %d\n", halvingInterval)
+		return
+	}
+	bc := CreateBlockchain(address, name, halvingInterval)
+	defer bc.db.Close()
+
+	if interval := bc.SubsidySchedule().HalvingInterval; interval != halvingInterval {
+		fmt.Printf("Blockchain %s already exists and halves its subsidy every %d blocks\n", name, interval)
+	}
+}
+
+func (cli *CLI) reindexUTXO(address, blockchainName string) {
+	bc := NewBlockchain(address, blockchainName)
+	defer bc.db.Close()
+
+	UTXOSet := NewUTXOSet(bc)
+	must(UTXOSet.Reindex())
+
+	fmt.Printf("Done! There are %d transactions in the UTXO set.\n", UTXOSet.CountTransactions())
+}
+
+func (cli *CLI) merkleProof(address, blockchainName, txID string) {
+	bc := NewBlockchain(address, blockchainName)
+	defer bc.db.Close()
+
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		panic("invalid transaction id")
+	}
+	proof, block, err := bc.MerkleProof(id)
+	must(err)
+
+	hashes := make([]string, len(proof.Hashes))
+	for i, hash := range proof.Hashes {
+		hashes[i] = hex.EncodeToString(hash)
+	}
+	fmt.Printf("Block Hash: %x\n", block.Hash)
+	fmt.Printf("Merkle Root: %x\n", block.MerkleRoot)
+	fmt.Printf("TxID: %x\n", proof.TxID)
+	fmt.Printf("Index: %d\n", proof.Index)
+	fmt.Printf("Proof: %s\n", strings.Join(hashes, ","))
+	fmt.Printf("Valid: %s\n", strconv.FormatBool(proof.Verify(block.MerkleRoot)))
+}
+
+func (cli *CLI) verifyMerkleProof(root, txID string, index int, hashes string) {
+	rootHash, err := hex.DecodeString(root)
+	if err != nil {
+		panic("invalid merkle root")
+	}
+	id, err := hex.DecodeString(txID)
+	if err != nil {
+		panic("invalid transaction id")
+	}
+	proof := &MerkleProof{
+		TxID:  id,
+		Index: index,
+	}
+	if hashes != "" {
+		for _, h := range strings.Split(hashes, ",") {
+			hash, err := hex.DecodeString(h)
+			if err != nil {
+				panic("invalid proof hash")
+			}
+			proof.Hashes = append(proof.Hashes, hash)
+		}
+	}
+
+	fmt.Printf("Valid: %s\n", strconv.FormatBool(proof.Verify(rootHash)))
+}
+
+func (cli *CLI) verifyChain(address, blockchainName string, fromHeight int) {
+	bc := NewBlockchain(address, blockchainName)
+	defer bc.db.Close()
+
+	report, err := bc.VerifyChain(fromHeight)
+	must(err)
+
+	fmt.Printf("Checked Blocks: %d (heights %d to %d)\n", report.BlocksChecked, report.FromHeight, report.ToHeight)
+	if report.Failure == nil {
+		fmt.Println("Result: OK")
+		return
+	}
+	fmt.Println("Result: FAILED")
+	fmt.Printf("Height: %d\n", report.Failure.Height)
+	fmt.Printf("Block Hash: %x\n", report.Failure.Hash)
+	fmt.Printf("Reason: %s\n", report.Failure.Reason)
+}
+
+func (cli *CLI) startNode(port int, blockchainName, minerAddress, peers string, rpcPort int, rpcUser, rpcPassword string, restPort, explorerPort, halvingInterval int) error {
+	if blockchainName == "" {
+		blockchainName = fmt.Sprintf("blockchain_%d", port)
+	}
+	if minerAddress != "" {
+		if err := ValidateAddress(minerAddress); err != nil {
+			return fmt.Errorf("invalid miner address: %w", err)
+		}
+	}
+	if rpcPort != 0 && (rpcUser == "" || rpcPassword == "") {
+		return errors.New("the JSON-RPC server needs -rpcuser and -rpcpassword")
+	}
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+	if halvingInterval != 0 {
+		if err := bc.SetHalvingInterval(halvingInterval); err != nil {
+			return err
+		}
+	}
+
+	var peerList []string
+	if peers != "" {
+		peerList = strings.Split(peers, ",")
+	}
+	node := NewNode(fmt.Sprintf("localhost:%d", port), minerAddress, bc, peerList)
+
+	// the node and the servers next to it share the chain, the first one to
+	// fail stops them all
+	errs := make(chan error, 4)
+	go func() { errs <- node.Start() }()
+	if rpcPort != 0 {
+		rpc := NewRPCServer(node, blockchainName, rpcUser, rpcPassword)
+		go func() { errs <- rpc.Start(fmt.Sprintf("localhost:%d", rpcPort)) }()
+	}
+	if restPort != 0 {
+		rest := NewRESTServer(bc)
+		go func() { errs <- rest.Start(fmt.Sprintf("localhost:%d", restPort)) }()
+	}
+	if explorerPort != 0 {
+		explorer := NewExplorer(bc)
+		go func() { errs <- explorer.Start(fmt.Sprintf("localhost:%d", explorerPort)) }()
+	}
+	return <-errs
+}
+
+func (cli *CLI) mine(node, minerAddress string, maxTxs int) {
+	if err := ValidateAddress(minerAddress); err != nil {
+		fmt.Println(err)
+		return
+	}
+	hash, err := RequestMining(node, minerAddress, maxTxs)
+	if err != nil {
+		fmt.Printf("Mining failed: %s\n", err)
+		return
+	}
+	fmt.Printf("Block with hash %x mined\n", hash)
+}
+
+func (cli *CLI) createWallet(blockchainName, passphrase string, account uint, change bool, format AddressFormat) {
+	wallets, err := NewWallets(blockchainName)
+	must(err)
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer wallets.Lock()
+
+	var address string
+	if account != 0 || change {
+		address, err = wallets.DeriveAddress(uint32(account), change)
+	} else {
+		address, err = wallets.CreateWallet()
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	must(wallets.SaveToFile())
+
+	fmt.Printf("Your new address: %s\n", formatAddress(address, format))
+}
+
+func (cli *CLI) listAddresses(blockchainName string, format AddressFormat) {
+	wallets, err := NewWallets(blockchainName)
+	must(err)
+
+	for _, address := range wallets.GetAddresses() {
+		if path, ok := wallets.Path(address); ok {
+			fmt.Printf("%s %s\n", formatAddress(address, format), path)
+			continue
+		}
+		fmt.Println(formatAddress(address, format))
+	}
+}
+
+func (cli *CLI) getAddress(blockchainName, address string) {
+	wallets, err := NewWallets(blockchainName)
+	must(err)
+
+	if address == "" {
+		addresses := wallets.GetAddresses()
+		if len(addresses) == 0 {
+			fmt.Println("The wallet is empty, create an address with createwallet")
+			return
+		}
+		address = addresses[0]
+	}
+	pubKey, err := wallets.PublicKey(address)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Printf("Address: %s\n", address)
+	fmt.Printf("Bech32 Address: %s\n", formatAddress(address, AddressBech32))
+	fmt.Printf("Public Key: %x\n", pubKey)
+	fmt.Printf("Public Key Hash: %x\n", HashPubKey(pubKey))
+	if path, ok := wallets.Path(address); ok {
+		fmt.Printf("Path: %s\n", path)
+	}
+	fmt.Printf("Encrypted: %s\n", strconv.FormatBool(wallets.IsEncrypted()))
+}
+
+func (cli *CLI) encryptWallet(blockchainName, passphrase string) {
+	wallets, err := NewWallets(blockchainName)
+	must(err)
+
+	if err := wallets.EncryptWallet(passphrase); err != nil {
+		fmt.Println(err)
+		return
+	}
+	must(wallets.SaveToFile())
+
+	fmt.Println("Wallet encrypted, keep the passphrase safe: the keys can't be recovered without it")
+}
+
+func (cli *CLI) walletPassphraseChange(blockchainName, oldPassphrase, newPassphrase string) {
+	wallets, err := NewWallets(blockchainName)
+	must(err)
+
+	if err := wallets.ChangePassphrase(oldPassphrase, newPassphrase); err != nil {
+		fmt.Println(err)
+		return
+	}
+	must(wallets.SaveToFile())
+
+	fmt.Println("Wallet passphrase changed")
+}
+
+func (cli *CLI) createHDWallet(blockchainName, passphrase string, words int, mnemonicPassphrase string) {
+	wallets, err := NewWallets(blockchainName)
+	must(err)
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer wallets.Lock()
+
+	mnemonic, err := NewMnemonic(words)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	seed, err := MnemonicSeed(mnemonic, mnemonicPassphrase)
+	must(err)
+	if err := wallets.SetSeed(seed); err != nil {
+		fmt.Println(err)
+		return
+	}
+	address, err := wallets.CreateWallet()
+	must(err)
+	must(wallets.SaveToFile())
+
+	fmt.Printf("Mnemonic: %s\n", mnemonic)
+	fmt.Println("Write the mnemonic down, it restores every address of this wallet")
+	fmt.Printf("Your new address: %s\n", address)
+}
+
+func (cli *CLI) restoreWallet(blockchainName, passphrase, mnemonic, mnemonicPassphrase string, gapLimit int) {
+	wallets, err := NewWallets(blockchainName)
+	must(err)
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer wallets.Lock()
+
+	seed, err := MnemonicSeed(mnemonic, mnemonicPassphrase)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := wallets.SetSeed(seed); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	var added []string
+	if _, err := os.Stat(blockchainName); err == nil {
+		bc := OpenBlockchain(blockchainName)
+		added, err = wallets.Rescan(bc, gapLimit)
+		bc.db.Close()
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if len(wallets.GetAddresses()) == 0 {
+		address, err := wallets.CreateWallet()
+		must(err)
+		added = append(added, address)
+	}
+	must(wallets.SaveToFile())
+
+	fmt.Printf("Wallet restored with %d addresses\n", len(added))
+	for _, address := range added {
+		fmt.Println(address)
+	}
+}
+
+func (cli *CLI) rescanWallet(blockchainName, passphrase string, gapLimit int) {
+	wallets, err := NewWallets(blockchainName)
+	must(err)
+	if err := unlockWallets(wallets, passphrase); err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer wallets.Lock()
+
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+	added, err := wallets.Rescan(bc, gapLimit)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	must(wallets.SaveToFile())
+
+	fmt.Printf("Found %d new addresses\n", len(added))
+	for _, address := range added {
+		fmt.Println(address)
+	}
+}
+
+func (cli *CLI) validateAddress(address, networkName string) error {
+	if networkName != "" {
+		network, err := NetworkByName(networkName)
+		if err != nil {
+			return err
+		}
+		activeNetwork = network
+	}
+
+	fmt.Printf("Address: %s\n", address)
+	decoded, err := DecodeAddress(address)
+	if err == nil {
+		fmt.Printf("Format: %s\n", decoded.Format)
+		fmt.Printf("Network: %s\n", decoded.Network.Name)
+		fmt.Printf("Public Key Hash: %x\n", decoded.PubKeyHash)
+	}
+	if err := ValidateAddress(address); err != nil {
+		fmt.Println("Valid: false")
+		fmt.Printf("Error: %s\n", err)
+		var bech32Err *Bech32Error
+		if errors.As(err, &bech32Err) && bech32Err.Position >= 0 {
+			// point at the typo under the address printed above
+			fmt.Printf("         %s^\n", strings.Repeat(" ", bech32Err.Position))
+		}
+		return nil
+	}
+	fmt.Println("Valid: true")
+	return nil
+}
+
+// formatAddress rewrites a Base58 address of the wallet in format.
+func formatAddress(address string, format AddressFormat) string {
+	decoded, err := DecodeAddress(address)
+	if err != nil {
+		return address
+	}
+	decoded.Format = format
+	return decoded.String()
+}
+
+// unlockWallets unlocks an encrypted wallet for WALLET_UNLOCK_TIMEOUT at
+// most, callers Lock it once done.
+func unlockWallets(wallets *Wallets, passphrase string) error {
+	if !wallets.IsEncrypted() {
+		return nil
+	}
+	if passphrase == "" {
+		return fmt.Errorf("%w, pass it with -passphrase", ErrWalletLocked)
+	}
+	return wallets.Unlock(passphrase, WALLET_UNLOCK_TIMEOUT)
+}
+
+func (cli *CLI) migrateChain(blockchainName string) error {
+	db := openDB(blockchainName)
+	defer db.Close()
+
+	migrated, err := MigrateChain(db)
+	if err != nil {
+		return err
+	}
+	UTXOSet := NewUTXOSet(&Blockchain{db: db})
+	fmt.Printf("Migrated %d blocks. There are %d transactions in the UTXO set.\n", migrated, UTXOSet.CountTransactions())
+	return nil
+}
+
+func (cli *CLI) estimateFee(blockchainName, node string, blocks int) {
+	var rate FeeRate
+	var err error
+	if node != "" {
+		rate, err = RequestFeeEstimate(node, blocks)
+	} else {
+		bc := OpenBlockchain(blockchainName)
+		defer bc.db.Close()
+		rate, err = localFeeEstimate(bc, blocks)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Fee rate to confirm within %d blocks: %g\n", blocks, float64(rate))
+}
+
+func localFeeEstimate(bc *Blockchain, blocks int) (FeeRate, error) {
+	estimator, err := NewFeeEstimator(bc, nil)
+	if err != nil {
+		return 0, err
+	}
+	return estimator.EstimateFee(blocks)
+}
+
+// estimateFeeRate asks node, or reads the local chain when node is empty,
+// and falls back to DEFAULT_FEE_RATE when there is nothing to go by.
+func estimateFeeRate(bc *Blockchain, node string, blocks int) FeeRate {
+	var rate FeeRate
+	var err error
+	if node != "" {
+		rate, err = RequestFeeEstimate(node, blocks)
+	} else {
+		rate, err = localFeeEstimate(bc, blocks)
+	}
+	if err != nil {
+		fmt.Printf("Using the default fee rate %g: %s\n", float64(DEFAULT_FEE_RATE), err)
+		return DEFAULT_FEE_RATE
+	}
+	fmt.Printf("Using the estimated fee rate %g to confirm within %d blocks\n", float64(rate), blocks)
+	return rate
+}
+
+func printJSON(v interface{}) error {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func (cli *CLI) getBlock(blockchainName, hash string, height int, asJSON bool) error {
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+
+	var block *Block
+	var err error
+	switch {
+	case hash != "":
+		id, decodeErr := hex.DecodeString(hash)
+		if decodeErr != nil {
+			return fmt.Errorf("invalid block hash %q", hash)
+		}
+		block, err = bc.BlockByHash(id)
+	case height >= 0:
+		block, err = bc.BlockByHeight(height)
+	default:
+		return errors.New("pass the block's -hash or -height")
+	}
+	if err != nil {
+		return err
+	}
+	info, err := bc.BlockInfo(block)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(info)
+	}
+
+	fmt.Printf("Block Hash: %s\n", info.Hash)
+	fmt.Printf("Height: %d\n", info.Height)
+	fmt.Printf("Confirmations: %d\n", info.Confirmations)
+	fmt.Printf("Prev Block Hash: %s\n", info.PrevBlockHash)
+	fmt.Printf("Next Block Hash: %s\n", info.NextBlockHash)
+	fmt.Printf("Merkle Root: %s\n", info.MerkleRoot)
+	fmt.Printf("Time: %s\n", time.Unix(info.Time, 0).UTC().Format(time.RFC3339))
+	fmt.Printf("Bits: %s\n", info.Bits)
+	fmt.Printf("Nonce: %d\n", info.Nonce)
+	fmt.Printf("Chain Work: %s\n", info.ChainWork)
+	fmt.Printf("Transactions: %d\n", len(info.Transactions))
+	for _, tx := range info.Transactions {
+		printTxInfo(tx)
+	}
+	return nil
+}
+
+func printTxInfo(tx TxInfo) {
+	fmt.Printf("TxID: %s (%d bytes)\n", tx.TxID, tx.Size)
+	for _, in := range tx.Inputs {
+		if in.Coinbase != "" {
+			fmt.Printf("  Input: coinbase %s\n", in.Coinbase)
+			continue
+		}
+		fmt.Printf("  Input: %s:%d from %s\n", in.TxID, in.Vout, in.Address)
+	}
+	for _, out := range tx.Outputs {
+		fmt.Printf("  Output: %d to %s\n", out.Value, out.Address)
+	}
+}
+
+func (cli *CLI) getBlockHash(blockchainName string, height int, asJSON bool) error {
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+
+	hash, err := bc.BlockHashByHeight(height)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(hex.EncodeToString(hash))
+	}
+	fmt.Printf("%x\n", hash)
+	return nil
+}
+
+// getBlockCount prints the height of the tip like Bitcoin's getblockcount,
+// the genesis block isn't counted.
+func (cli *CLI) getBlockCount(blockchainName string, asJSON bool) error {
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+
+	height := bc.BestHeight()
+	if height < 0 {
+		return errors.New("the chain is empty")
+	}
+	if asJSON {
+		return printJSON(height)
+	}
+	fmt.Println(height)
+	return nil
+}
+
+func (cli *CLI) reindex(blockchainName string, txIndex, addrIndex bool) error {
+	if !txIndex && !addrIndex {
+		return errors.New("nothing to reindex, pass -txindex or -addrindex")
+	}
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+
+	if txIndex {
+		count, err := bc.ReindexTransactions()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Done! %d transactions are in the transaction index.\n", count)
+	}
+	if addrIndex {
+		count, err := bc.ReindexAddresses()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Done! %d blocks are in the address index.\n", count)
+	}
+	return nil
+}
+
+func (cli *CLI) getTransaction(blockchainName, txID string, asJSON bool) error {
+	id, err := hex.DecodeString(txID)
+	if err != nil || len(id) == 0 {
+		return fmt.Errorf("invalid transaction id %q", txID)
+	}
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+
+	info, err := bc.TransactionInfo(id)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(info)
+	}
+
+	printTxInfo(info.TxInfo)
+	fmt.Printf("Block Hash: %s\n", info.BlockHash)
+	fmt.Printf("Height: %d\n", info.Height)
+	fmt.Printf("Confirmations: %d\n", info.Confirmations)
+	return nil
+}
+
+func (cli *CLI) listTransactions(address, blockchainName string, skip, count int, asJSON bool) error {
+	pubKeyHash, err := AddressPubKeyHash(address)
+	if err != nil {
+		return err
+	}
+	if skip < 0 || count < 0 {
+		return errors.New("skip and count can't be negative")
+	}
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+
+	history, total, err := bc.AddressHistory(pubKeyHash, skip, count)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return printJSON(AddressHistoryPage{Address: address, Total: total, Skip: skip, Transactions: history})
+	}
+
+	for _, item := range history {
+		fmt.Printf("%s height %d %s\n", item.TxID, item.Height, time.Unix(item.Time, 0).Format(time.RFC3339))
+		direction := "from"
+		if item.Amount < 0 {
+			direction = "to"
+		}
+		counterparties := strings.Join(item.Counterparties, ", ")
+		if item.Coinbase {
+			counterparties = "coinbase"
+		} else if counterparties == "" {
+			counterparties = "self"
+		}
+		fmt.Printf("  %+d %s %s, balance %d\n", item.Amount, direction, counterparties, item.Balance)
+	}
+	if len(history) == 0 {
+		fmt.Printf("No transactions, %d in total\n", total)
+		return nil
+	}
+	fmt.Printf("Transactions %d to %d of %d\n", skip+1, skip+len(history), total)
+	return nil
+}
+
+// restAPI serves a chain no node is running on, startnode -restport serves
+// the chain of a node.
+func (cli *CLI) restAPI(blockchainName string, port int) error {
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+
+	return NewRESTServer(bc).Start(fmt.Sprintf("localhost:%d", port))
+}
+
+// explorer serves a chain no node is running on, startnode -explorerport
+// serves the chain of a node.
+func (cli *CLI) explorer(blockchainName string, port int) error {
+	bc := OpenBlockchain(blockchainName)
+	defer bc.db.Close()
+
+	return NewExplorer(bc).Start(fmt.Sprintf("localhost:%d", port))
 }
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Sizes of the binary encoding of a transaction spending P256 keyed outputs,
+// used to price a transaction before it is signed.
+const (
+	// version and the 32 byte ID
+	TX_BASE_SIZE = 1 + 1 + 32
+	// txid, vout, a 64 byte signature and a 64 byte public key
+	TX_INPUT_SIZE = 1 + 32 + 8 + 1 + 64 + 1 + 64
+	// value and a 20 byte public key hash
+	TX_OUTPUT_SIZE = 8 + 1 + 20
+	// searches of the branch and bound selector before it gives up
+	BNB_MAX_TRIES = 100000
+)
+
+const (
+	DEFAULT_FEE_RATE FeeRate = 0.01
+	// change the wallet can't spend for less than this rate is dust
+	DUST_FEE_RATE FeeRate = 0.01
+)
+
+var (
+	ErrInsufficientFunds = errors.New("not enough balance")
+)
+
+// FeePolicy prices a transaction by the size of its serialization.
+type FeePolicy interface {
+	Fee(size int) int
+}
+
+// FlatFee pays the same fee whatever the size of the transaction.
+type FlatFee int
+
+func (f FlatFee) Fee(size int) int {
+	return int(f)
+}
+
+// FeeRate pays a fee per byte, rounded up.
+type FeeRate float64
+
+func (r FeeRate) Fee(size int) int {
+	return int(math.Ceil(float64(r) * float64(size)))
+}
+
+// excludeCoins drops the coins whose outpoint is in exclude.
+func excludeCoins(coins []Coin, exclude map[string]bool) []Coin {
+	if len(exclude) == 0 {
+		return coins
+	}
+	var kept []Coin
+	for _, coin := range coins {
+		if !exclude[outpoint(coin.TxID, coin.Vout)] {
+			kept = append(kept, coin)
+		}
+	}
+	return kept
+}
+
+// EstimateTxSize returns the size of a signed transaction with the given
+// number of inputs and outputs.
+func EstimateTxSize(inputs, outputs int) int {
+	return TX_BASE_SIZE +
+		len(binary.AppendUvarint(nil, uint64(inputs))) + inputs*TX_INPUT_SIZE +
+		len(binary.AppendUvarint(nil, uint64(outputs))) + outputs*TX_OUTPUT_SIZE
+}
+
+// isDust reports whether an output worth value would cost more to spend
+// than it is worth.
+func isDust(value int, fees FeePolicy) bool {
+	spend := fees.Fee(TX_INPUT_SIZE)
+	if min := DUST_FEE_RATE.Fee(TX_INPUT_SIZE); spend < min {
+		spend = min
+	}
+	return value <= spend
+}
+
+// Coin is an unspent output the wallet can spend.
+type Coin struct {
+	TxID   []byte
+	Vout   int
+	Output TxOutput
+}
+
+// CoinSelection is the coins funding a payment, the fee it pays and the
+// change sent back. Change that would be dust is left to the miner instead.
+type CoinSelection struct {
+	Coins  []Coin
+	Fee    int
+	Change int
+}
+
+func (s *CoinSelection) Total() int {
+	total := 0
+	for _, coin := range s.Coins {
+		total += coin.Output.Value
+	}
+	return total
+}
+
+// CoinSelector picks the coins that pay amount plus the fee of the
+// transaction spending them.
+type CoinSelector interface {
+	Select(coins []Coin, amount int, fees FeePolicy) (*CoinSelection, error)
+}
+
+var coinSelectorNames = []string{"largest", "smallest", "bnb"}
+
+func ParseCoinSelector(name string) (CoinSelector, error) {
+	switch name {
+	case "largest":
+		return LargestFirst{}, nil
+	case "smallest":
+		return SmallestFirst{}, nil
+	case "bnb":
+		return BranchAndBound{}, nil
+	}
+	return nil, fmt.Errorf("unknown coin selection %q, expected one of %v", name, coinSelectorNames)
+}
+
+// completeSelection prices coins paying amount with one output, plus a change
+// output when the change isn't dust. It fails when the coins aren't enough.
+func completeSelection(coins []Coin, amount int, fees FeePolicy) (*CoinSelection, bool) {
+	selection := &CoinSelection{Coins: coins}
+	total := selection.Total()
+
+	fee := fees.Fee(EstimateTxSize(len(coins), 1))
+	if total < amount+fee {
+		return nil, false
+	}
+	feeWithChange := fees.Fee(EstimateTxSize(len(coins), 2))
+	if change := total - amount - feeWithChange; change > 0 && !isDust(change, fees) {
+		selection.Fee, selection.Change = feeWithChange, change
+	} else {
+		selection.Fee = total - amount
+	}
+	return selection, true
+}
+
+// sortCoins orders coins by value, ties by outpoint so the selection
+// doesn't depend on the order the UTXO set returned them in.
+func sortCoins(coins []Coin, descending bool) []Coin {
+	sorted := append([]Coin{}, coins...)
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Output.Value != b.Output.Value {
+			return (a.Output.Value > b.Output.Value) == descending
+		}
+		if c := bytes.Compare(a.TxID, b.TxID); c != 0 {
+			return c < 0
+		}
+		return a.Vout < b.Vout
+	})
+	return sorted
+}
+
+func accumulateCoins(coins []Coin, amount int, fees FeePolicy) (*CoinSelection, error) {
+	for i := range coins {
+		if selection, ok := completeSelection(coins[:i+1], amount, fees); ok {
+			return selection, nil
+		}
+	}
+	return nil, ErrInsufficientFunds
+}
+
+// LargestFirst spends the fewest coins, keeping fees low.
+type LargestFirst struct{}
+
+func (LargestFirst) Select(coins []Coin, amount int, fees FeePolicy) (*CoinSelection, error) {
+	return accumulateCoins(sortCoins(coins, true), amount, fees)
+}
+
+// SmallestFirst consolidates small coins at the price of a larger fee.
+type SmallestFirst struct{}
+
+func (SmallestFirst) Select(coins []Coin, amount int, fees FeePolicy) (*CoinSelection, error) {
+	return accumulateCoins(sortCoins(coins, false), amount, fees)
+}
+
+// BranchAndBound searches for the coins that pay amount and the fee without
+// change and waste the least, where waste is what is paid on top of the fee
+// because a change output would have been dust. Without such a match it
+// falls back to LargestFirst.
+type BranchAndBound struct{}
+
+func (BranchAndBound) Select(coins []Coin, amount int, fees FeePolicy) (*CoinSelection, error) {
+	// coins worth less than the fee they add only make things worse
+	inputFee := fees.Fee(EstimateTxSize(1, 1)) - fees.Fee(EstimateTxSize(0, 1))
+	var sorted []Coin
+	for _, coin := range sortCoins(coins, true) {
+		if coin.Output.Value > inputFee {
+			sorted = append(sorted, coin)
+		}
+	}
+	remaining := make([]int, len(sorted)+1)
+	for i := len(sorted) - 1; i >= 0; i-- {
+		remaining[i] = remaining[i+1] + sorted[i].Output.Value
+	}
+
+	var best *CoinSelection
+	bestWaste := 0
+	tries := 0
+	// search returns true once an exact match ends the search
+	var search func(i int, selected []Coin, total int) bool
+	search = func(i int, selected []Coin, total int) bool {
+		tries++
+		if tries > BNB_MAX_TRIES {
+			return true
+		}
+		if len(selected) > 0 {
+			if selection, ok := completeSelection(selected, amount, fees); ok {
+				// adding coins only adds to the change, don't go deeper
+				if selection.Change > 0 {
+					return false
+				}
+				waste := selection.Fee - fees.Fee(EstimateTxSize(len(selected), 1))
+				if best == nil || waste < bestWaste {
+					best, bestWaste = selection, waste
+					best.Coins = append([]Coin{}, selected...)
+				}
+				return waste == 0
+			}
+		}
+		if i == len(sorted) || total+remaining[i] < amount {
+			return false
+		}
+		return search(i+1, append(selected, sorted[i]), total+sorted[i].Output.Value) ||
+			search(i+1, selected, total)
+	}
+	search(0, nil, 0)
+	if best != nil {
+		return best, nil
+	}
+
+	return LargestFirst{}.Select(coins, amount, fees)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCoins(values ...int) []Coin {
+	var coins []Coin
+	for i, value := range values {
+		coins = append(coins, Coin{TxID: []byte{byte(i)}, Vout: 0, Output: TxOutput{Value: value}})
+	}
+	return coins
+}
+
+func coinValues(selection *CoinSelection) []int {
+	var values []int
+	for _, coin := range selection.Coins {
+		values = append(values, coin.Output.Value)
+	}
+	return values
+}
+
+func TestFeePolicies(t *testing.T) {
+	assert.Equal(t, 5, FlatFee(5).Fee(1000))
+	assert.Equal(t, 3, FeeRate(0.01).Fee(201))
+	assert.Equal(t, 0, FeeRate(0).Fee(201))
+
+	assert.Equal(t, TX_BASE_SIZE+1+TX_INPUT_SIZE+1+2*TX_OUTPUT_SIZE, EstimateTxSize(1, 2))
+	assert.Equal(t, EstimateTxSize(127, 1)+TX_INPUT_SIZE+1, EstimateTxSize(128, 1))
+
+	assert.True(t, isDust(2, FlatFee(0)))
+	assert.False(t, isDust(3, FlatFee(0)))
+	assert.True(t, isDust(5, FlatFee(5)))
+}
+
+func TestLargestAndSmallestFirst(t *testing.T) {
+	coins := testCoins(5, 40, 10, 20)
+
+	selection, err := LargestFirst{}.Select(coins, 45, FlatFee(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{40, 20}, coinValues(selection))
+	assert.Equal(t, 1, selection.Fee)
+	assert.Equal(t, 14, selection.Change)
+
+	selection, err = SmallestFirst{}.Select(coins, 30, FlatFee(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{5, 10, 20}, coinValues(selection))
+	assert.Equal(t, 4, selection.Change)
+
+	// change of 2 is dust and is paid as fee
+	selection, err = LargestFirst{}.Select(coins, 37, FlatFee(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{40}, coinValues(selection))
+	assert.Equal(t, 3, selection.Fee)
+	assert.Equal(t, 0, selection.Change)
+
+	_, err = LargestFirst{}.Select(coins, 75, FlatFee(1))
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+}
+
+func TestFeeRateGrowsWithInputs(t *testing.T) {
+	// one coin would pay 20 but not its fee as well
+	rate := FeeRate(0.05)
+	selection, err := SmallestFirst{}.Select(testCoins(30, 30, 30), 20, rate)
+	assert.Nil(t, err)
+	assert.Len(t, selection.Coins, 2)
+	assert.Equal(t, rate.Fee(EstimateTxSize(2, 2)), selection.Fee)
+	assert.Equal(t, 60-20-selection.Fee, selection.Change)
+}
+
+func TestBranchAndBound(t *testing.T) {
+	coins := testCoins(1, 2, 4, 8, 16, 32)
+
+	// 4 + 16 + 1 pay 20 and a flat fee of 1 exactly
+	selection, err := BranchAndBound{}.Select(coins, 20, FlatFee(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 21, selection.Total())
+	assert.Equal(t, 0, selection.Change)
+	assert.Equal(t, 1, selection.Fee)
+
+	// without a changeless match it falls back to largest first
+	selection, err = BranchAndBound{}.Select(testCoins(40, 50), 20, FlatFee(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []int{50}, coinValues(selection))
+	assert.Equal(t, 29, selection.Change)
+
+	_, err = BranchAndBound{}.Select(coins, 100, FlatFee(1))
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+}
+
+func TestParseCoinSelector(t *testing.T) {
+	selector, err := ParseCoinSelector("bnb")
+	assert.Nil(t, err)
+	assert.Equal(t, BranchAndBound{}, selector)
+	_, err = ParseCoinSelector("random")
+	assert.NotNil(t, err)
+}
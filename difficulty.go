@@ -1,7 +1,149 @@
 package main
 
-// fixed target bits
-// and there is no automatic target bits adjustment
+import (
+	"math/big"
+)
+
+// the target is stored in every block header in Bitcoin's compact "bits"
+// form and retargeted every RETARGET_INTERVAL blocks from the time it took
+// to mine the previous window
 const (
+	// leading zero bits required by the genesis block
 	TARGET_BITS = 24
+	// leading zero bits of the easiest target a block is ever allowed to have
+	MIN_TARGET_BITS = 8
+
+	// number of blocks between two target adjustments
+	RETARGET_INTERVAL = 10
+	// desired number of seconds between two blocks
+	TARGET_BLOCK_SPACING = 10
+	RETARGET_TIMESPAN    = RETARGET_INTERVAL * TARGET_BLOCK_SPACING
+	// a single adjustment can't move the target by more than this factor
+	MAX_ADJUSTMENT_FACTOR = 4
 )
+
+var (
+	powLimit    = new(big.Int).Lsh(big.NewInt(1), 256-MIN_TARGET_BITS)
+	genesisBits = BigToCompact(new(big.Int).Lsh(big.NewInt(1), 256-TARGET_BITS))
+)
+
+// CompactToBig expands the compact representation of a target: the high byte
+// is the length of the number in bytes and the low 23 bits are its most
+// significant bytes. Bit 24 is the sign bit.
+func CompactToBig(compact uint32) *big.Int {
+	mantissa := compact & 0x007fffff
+	isNegative := compact&0x00800000 != 0
+	exponent := uint(compact >> 24)
+
+	var n *big.Int
+	if exponent <= 3 {
+		mantissa >>= 8 * (3 - exponent)
+		n = big.NewInt(int64(mantissa))
+	} else {
+		n = big.NewInt(int64(mantissa))
+		n.Lsh(n, 8*(exponent-3))
+	}
+
+	if isNegative {
+		n = n.Neg(n)
+	}
+
+	return n
+}
+
+func BigToCompact(n *big.Int) uint32 {
+	if n.Sign() == 0 {
+		return 0
+	}
+
+	var mantissa uint32
+	exponent := uint(len(n.Bytes()))
+	if exponent <= 3 {
+		mantissa = uint32(n.Bits()[0])
+		mantissa <<= 8 * (3 - exponent)
+	} else {
+		tn := new(big.Int).Set(n)
+		mantissa = uint32(tn.Rsh(tn, 8*(exponent-3)).Bits()[0])
+	}
+
+	// the mantissa must not look negative, so move a byte into the exponent
+	if mantissa&0x00800000 != 0 {
+		mantissa >>= 8
+		exponent++
+	}
+
+	compact := uint32(exponent<<24) | mantissa
+	if n.Sign() < 0 {
+		compact |= 0x00800000
+	}
+
+	return compact
+}
+
+// retarget scales the target of the previous window by how long that window
+// actually took compared to RETARGET_TIMESPAN.
+func retarget(bits uint32, actualTimespan int64) uint32 {
+	minTimespan := int64(RETARGET_TIMESPAN / MAX_ADJUSTMENT_FACTOR)
+	maxTimespan := int64(RETARGET_TIMESPAN * MAX_ADJUSTMENT_FACTOR)
+	if actualTimespan < minTimespan {
+		actualTimespan = minTimespan
+	} else if actualTimespan > maxTimespan {
+		actualTimespan = maxTimespan
+	}
+
+	target := CompactToBig(bits)
+	target.Mul(target, big.NewInt(actualTimespan))
+	target.Div(target, big.NewInt(RETARGET_TIMESPAN))
+
+	if target.Cmp(powLimit) > 0 {
+		target.Set(powLimit)
+	}
+
+	return BigToCompact(target)
+}
+
+// NextTargetBits returns the bits a block built on top of prev must have.
+func (bc *Blockchain) NextTargetBits(prev *Block) (uint32, error) {
+	return nextTargetBits(prev, bc.BlockByHash)
+}
+
+// ExpectedTargetBits returns the bits block should have had given its parent.
+func (bc *Blockchain) ExpectedTargetBits(block *Block) (uint32, error) {
+	return expectedTargetBits(block, bc.BlockByHash)
+}
+
+// nextTargetBits is NextTargetBits reading the ancestors of prev with
+// blockByHash, so blocks that aren't stored yet can be checked too.
+func nextTargetBits(prev *Block, blockByHash func([]byte) (*Block, error)) (uint32, error) {
+	height := prev.Height + 1
+	if height%RETARGET_INTERVAL != 0 {
+		return prev.Bits, nil
+	}
+
+	// walk back to the last block of the previous window, so the window that
+	// just ended is measured over all of its RETARGET_INTERVAL spacings. The
+	// first window has none and is measured from the genesis block.
+	first := prev
+	for i := 0; i < RETARGET_INTERVAL && len(first.PrevBlockHash) != 0; i++ {
+		block, err := blockByHash(first.PrevBlockHash)
+		if err != nil {
+			return 0, err
+		}
+		first = block
+	}
+
+	return retarget(prev.Bits, prev.Timestamp-first.Timestamp), nil
+}
+
+func expectedTargetBits(block *Block, blockByHash func([]byte) (*Block, error)) (uint32, error) {
+	if len(block.PrevBlockHash) == 0 {
+		return genesisBits, nil
+	}
+
+	prev, err := blockByHash(block.PrevBlockHash)
+	if err != nil {
+		return 0, err
+	}
+
+	return nextTargetBits(prev, blockByHash)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompactRoundTrip(t *testing.T) {
+	for _, bits := range []uint32{genesisBits, 0x1d00ffff, 0x1b0404cb, 0x05009234} {
+		assert.Equal(t, bits, BigToCompact(CompactToBig(bits)))
+	}
+
+	target := new(big.Int).Lsh(big.NewInt(1), 256-TARGET_BITS)
+	assert.Equal(t, target, CompactToBig(genesisBits))
+}
+
+func TestRetarget(t *testing.T) {
+	target := CompactToBig(genesisBits)
+
+	// on schedule keeps the target
+	assert.Equal(t, genesisBits, retarget(genesisBits, RETARGET_TIMESPAN))
+
+	// twice as slow doubles the target
+	slower := new(big.Int).Mul(target, big.NewInt(2))
+	assert.Equal(t, BigToCompact(slower), retarget(genesisBits, RETARGET_TIMESPAN*2))
+
+	// adjustments are clamped to MAX_ADJUSTMENT_FACTOR in both directions
+	easiest := new(big.Int).Mul(target, big.NewInt(MAX_ADJUSTMENT_FACTOR))
+	assert.Equal(t, BigToCompact(easiest), retarget(genesisBits, RETARGET_TIMESPAN*100))
+	hardest := new(big.Int).Div(target, big.NewInt(MAX_ADJUSTMENT_FACTOR))
+	assert.Equal(t, BigToCompact(hardest), retarget(genesisBits, 0))
+
+	// the target never gets easier than powLimit
+	assert.Equal(t, BigToCompact(powLimit), retarget(BigToCompact(powLimit), RETARGET_TIMESPAN*2))
+}
+
+func TestNextTargetBits(t *testing.T) {
+	var blocks []*Block
+	prevHash := []byte{}
+	for height := 0; height < 2*RETARGET_INTERVAL; height++ {
+		block := &Block{
+			Hash:          []byte{byte(height + 1)},
+			PrevBlockHash: prevHash,
+			Height:        height,
+			Bits:          genesisBits,
+			Timestamp:     int64(height * TARGET_BLOCK_SPACING * 2),
+			TXs:           []*Transaction{newTestCoinbase(testAddress("miner"), "", height, 0)},
+		}
+		blocks = append(blocks, block)
+		prevHash = block.Hash
+	}
+	bc := newTestBlockchain(t, blocks...)
+
+	bits, err := bc.NextTargetBits(blocks[RETARGET_INTERVAL-3])
+	assert.Nil(t, err)
+	assert.Equal(t, genesisBits, bits)
+
+	// the window took twice as long as it should have
+	bits, err = bc.NextTargetBits(blocks[2*RETARGET_INTERVAL-1])
+	assert.Nil(t, err)
+	assert.Equal(t, retarget(genesisBits, RETARGET_TIMESPAN*2), bits)
+	assert.NotEqual(t, genesisBits, bits)
+
+	// the first window has no previous one and is measured from genesis
+	bits, err = bc.NextTargetBits(blocks[RETARGET_INTERVAL-1])
+	assert.Nil(t, err)
+	assert.Equal(t, retarget(genesisBits, int64((RETARGET_INTERVAL-1)*TARGET_BLOCK_SPACING*2)), bits)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	EXPLORER_BLOCKS_PAGE_SIZE  = 20
+	EXPLORER_HISTORY_PAGE_SIZE = 25
+)
+
+//go:embed explorer.tmpl
+var explorerTemplates string
+
+var explorerFuncs = template.FuncMap{
+	"time": func(unix int64) string {
+		return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+}
+
+// explorerPage is what every page template renders, Data depends on the page.
+type explorerPage struct {
+	Title string
+	// the search box keeps what was searched for
+	Query string
+	Data  interface{}
+}
+
+type BlockSummary struct {
+	Hash    string
+	Height  int
+	Time    int64
+	TxCount int
+}
+
+type explorerIndex struct {
+	Tip    *ChainTip
+	Blocks []BlockSummary
+	// height the next page of older blocks starts at, -1 for none
+	Older int
+}
+
+type explorerTx struct {
+	*ConfirmedTxInfo
+	// whether each output is spent
+	Spent []bool
+}
+
+type explorerAddress struct {
+	UTXOs *AddressUTXOs
+	// nil when the address index is off
+	History *AddressHistoryPage
+	// skip of the neighbouring history pages, -1 for none
+	Prev, Next int
+}
+
+// Explorer serves HTML pages of the chain for people, the REST API is for
+// programs. Pages are rendered on the server and need nothing from other
+// hosts.
+type Explorer struct {
+	bc        *Blockchain
+	api       *RESTServer
+	templates *template.Template
+}
+
+func NewExplorer(bc *Blockchain) *Explorer {
+	return &Explorer{
+		bc:        bc,
+		api:       NewRESTServer(bc),
+		templates: template.Must(template.New("explorer").Funcs(explorerFuncs).Parse(explorerTemplates)),
+	}
+}
+
+func (e *Explorer) Start(address string) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           e,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("explorer is listening on http://%s\n", address)
+	return server.ListenAndServe()
+}
+
+func (e *Explorer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		e.renderError(w, &HTTPError{Status: http.StatusMethodNotAllowed, Message: "the explorer is read-only"})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	var page *explorerPage
+	var name string
+	var err error
+	switch {
+	case r.URL.Path == "/":
+		name = "index"
+		page, err = e.index(query)
+	case len(parts) == 1 && parts[0] == "search":
+		e.search(w, r, strings.TrimSpace(query.Get("q")))
+		return
+	case len(parts) == 3 && parts[0] == "block" && parts[1] == "height":
+		var height int
+		if height, err = strconv.Atoi(parts[2]); err != nil || height < 0 {
+			err = badRequest("invalid block height %q", parts[2])
+			break
+		}
+		var hash []byte
+		if hash, err = e.bc.BlockHashByHeight(height); err == nil {
+			http.Redirect(w, r, "/block/"+hex.EncodeToString(hash), http.StatusFound)
+			return
+		}
+	case len(parts) == 2 && parts[0] == "block":
+		name = "block"
+		page, err = e.block(parts[1])
+	case len(parts) == 2 && parts[0] == "tx":
+		name = "tx"
+		page, err = e.transaction(parts[1])
+	case len(parts) == 2 && parts[0] == "address":
+		name = "address"
+		page, err = e.address(parts[1], query)
+	default:
+		err = &HTTPError{Status: http.StatusNotFound, Message: fmt.Sprintf("there is no page %s", r.URL.Path)}
+	}
+	if err != nil {
+		e.renderError(w, err)
+		return
+	}
+	e.render(w, http.StatusOK, name, page)
+}
+
+// render executes the template before writing anything, so a failing
+// template is served as an error instead of half a page.
+func (e *Explorer) render(w http.ResponseWriter, status int, name string, page *explorerPage) {
+	var out bytes.Buffer
+	if err := e.templates.ExecuteTemplate(&out, name, page); err != nil {
+		log.Printf("unable to render %s: %s\n", name, err)
+		http.Error(w, "unable to render the page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if _, err := w.Write(out.Bytes()); err != nil {
+		log.Println(err)
+	}
+}
+
+func (e *Explorer) renderError(w http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	e.render(w, status, "error", &explorerPage{Title: http.StatusText(status), Data: err.Error()})
+}
+
+func (e *Explorer) index(query url.Values) (*explorerPage, error) {
+	index := &explorerIndex{Older: -1}
+	page := &explorerPage{Title: "Latest blocks", Data: index}
+	if e.bc.Tip() == nil {
+		return page, nil
+	}
+
+	tip, err := e.api.chainTip()
+	if err != nil {
+		return nil, err
+	}
+	index.Tip = tip
+	from, err := queryInt(query, "from", tip.Height)
+	if err != nil {
+		return nil, err
+	}
+	if from > tip.Height {
+		from = tip.Height
+	}
+	for height := from; height >= 0 && height > from-EXPLORER_BLOCKS_PAGE_SIZE; height-- {
+		block, err := e.bc.BlockByHeight(height)
+		if err != nil {
+			return nil, err
+		}
+		index.Blocks = append(index.Blocks, BlockSummary{
+			Hash:    hex.EncodeToString(block.Hash),
+			Height:  block.Height,
+			Time:    block.Timestamp,
+			TxCount: len(block.TXs),
+		})
+	}
+	if older := from - EXPLORER_BLOCKS_PAGE_SIZE; older >= 0 {
+		index.Older = older
+	}
+	return page, nil
+}
+
+func (e *Explorer) block(hexHash string) (*explorerPage, error) {
+	info, err := e.api.blockByHash(hexHash)
+	if err != nil {
+		return nil, err
+	}
+	return &explorerPage{Title: fmt.Sprintf("Block %d", info.Height), Data: info}, nil
+}
+
+func (e *Explorer) transaction(txID string) (*explorerPage, error) {
+	info, err := e.api.transaction(txID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := hex.DecodeString(info.TxID)
+	if err != nil {
+		return nil, err
+	}
+	unspent, err := NewUTXOSet(e.bc).UnspentOutputs(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &explorerTx{ConfirmedTxInfo: info, Spent: make([]bool, len(info.Outputs))}
+	for i := range info.Outputs {
+		_, ok := unspent.Outputs[i]
+		tx.Spent[i] = !ok
+	}
+	return &explorerPage{Title: "Transaction", Data: tx}, nil
+}
+
+func (e *Explorer) address(address string, query url.Values) (*explorerPage, error) {
+	utxos, err := e.api.addressUTXOs(address)
+	if err != nil {
+		return nil, err
+	}
+	info := &explorerAddress{UTXOs: utxos, Prev: -1, Next: -1}
+	page := &explorerPage{Title: "Address", Query: address, Data: info}
+	if !e.bc.HasAddrIndex() {
+		return page, nil
+	}
+
+	skip, err := queryInt(query, "skip", 0)
+	if err != nil {
+		return nil, err
+	}
+	pubKeyHash, err := AddressPubKeyHash(address)
+	if err != nil {
+		return nil, err
+	}
+	history, total, err := e.bc.AddressHistory(pubKeyHash, skip, EXPLORER_HISTORY_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	info.History = &AddressHistoryPage{Address: address, Total: total, Skip: skip, Transactions: history}
+	if skip > 0 {
+		info.Prev = skip - EXPLORER_HISTORY_PAGE_SIZE
+		if info.Prev < 0 {
+			info.Prev = 0
+		}
+	}
+	if skip+EXPLORER_HISTORY_PAGE_SIZE < total {
+		info.Next = skip + EXPLORER_HISTORY_PAGE_SIZE
+	}
+	return page, nil
+}
+
+// search redirects to the block, transaction or address q names: a height,
+// a block hash, a transaction id or an address.
+func (e *Explorer) search(w http.ResponseWriter, r *http.Request, q string) {
+	if q == "" {
+		http.Redirect(w, r, "/", http.StatusFound)
+		return
+	}
+	target := ""
+	if height, err := strconv.Atoi(q); err == nil && height >= 0 {
+		if hash, err := e.bc.BlockHashByHeight(height); err == nil {
+			target = "/block/" + hex.EncodeToString(hash)
+		}
+	} else if ValidateAddress(q) == nil {
+		target = "/address/" + url.PathEscape(q)
+	} else if id, err := hex.DecodeString(q); err == nil && len(id) > 0 {
+		if e.bc.HasBlock(id) {
+			target = "/block/" + hex.EncodeToString(id)
+		} else if _, _, err := e.bc.LocateTransaction(id); err == nil {
+			target = "/tx/" + hex.EncodeToString(id)
+		}
+	}
+	if target == "" {
+		status := http.StatusNotFound
+		page := &explorerPage{Title: http.StatusText(status), Query: q, Data: fmt.Sprintf("Nothing matches %q.", q)}
+		e.render(w, status, "error", page)
+		return
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getPage fetches path without following redirects.
+func getPage(t *testing.T, server *httptest.Server, path string) (*http.Response, string) {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(server.URL + path)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp, string(body)
+}
+
+func TestExplorerPages(t *testing.T) {
+	bc, alice, split := newTestMempoolChain(t)
+	server := httptest.NewServer(NewExplorer(bc))
+	defer server.Close()
+	tipHash := hex.EncodeToString(bc.lastBlockHash)
+	splitID := hex.EncodeToString(split.ID)
+	address := string(alice.GetAddress())
+
+	resp, body := getPage(t, server, "/")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, body, `href="/block/`+tipHash+`"`)
+	assert.NotContains(t, body, "http://", "pages don't load anything from other hosts")
+
+	_, body = getPage(t, server, "/block/"+tipHash)
+	assert.Contains(t, body, `href="/tx/`+splitID+`"`)
+	assert.Contains(t, body, "2 transactions")
+
+	// the genesis coinbase output is spent by split, split's are unspent
+	_, body = getPage(t, server, "/tx/"+splitID)
+	assert.Contains(t, body, `href="/tx/`+hex.EncodeToString(split.VIn[0].Txid)+`#vout-0"`)
+	assert.Contains(t, body, `href="/address/`+address+`"`)
+	assert.Contains(t, body, "unspent")
+	_, body = getPage(t, server, "/tx/"+hex.EncodeToString(split.VIn[0].Txid))
+	assert.Contains(t, body, ">spent<")
+
+	_, body = getPage(t, server, "/address/"+address)
+	assert.Contains(t, body, "reindex -addrindex")
+	_, err := bc.ReindexAddresses()
+	assert.Nil(t, err)
+	_, body = getPage(t, server, "/address/"+address)
+	assert.Contains(t, body, "2 transactions, oldest first")
+
+	resp, _ = getPage(t, server, "/block/"+hex.EncodeToString([]byte("nope")))
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, body = getPage(t, server, "/nowhere/<script>")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.NotContains(t, body, "<script>")
+}
+
+func TestExplorerSearch(t *testing.T) {
+	bc, alice, split := newTestMempoolChain(t)
+	server := httptest.NewServer(NewExplorer(bc))
+	defer server.Close()
+	tipHash := hex.EncodeToString(bc.lastBlockHash)
+	splitID := hex.EncodeToString(split.ID)
+	address := string(alice.GetAddress())
+
+	for q, target := range map[string]string{
+		"1":           "/block/" + tipHash,
+		tipHash:       "/block/" + tipHash,
+		splitID:       "/tx/" + splitID,
+		address:       "/address/" + address,
+		"":            "/",
+		" " + tipHash: "/block/" + tipHash,
+	} {
+		resp, _ := getPage(t, server, "/search?q="+url.QueryEscape(q))
+		assert.Equal(t, http.StatusFound, resp.StatusCode, q)
+		assert.Equal(t, target, resp.Header.Get("Location"), q)
+	}
+
+	resp, body := getPage(t, server, "/search?q=nothing")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Contains(t, body, `value="nothing"`)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	// recent blocks whose confirmed transactions the estimator learns from
+	FEE_ESTIMATE_BLOCKS = 100
+	// longest confirmation target an estimate can be asked for
+	MAX_CONFIRM_TARGET = 25
+	// target send estimates its fee rate for
+	DEFAULT_CONFIRM_TARGET = 6
+	// share of the transactions paying at least the estimate that must have
+	// confirmed within the target
+	FEE_ESTIMATE_SUCCESS = 0.85
+	// transactions a fee rate range needs before it is judged
+	FEE_ESTIMATE_MIN_TXS = 3
+)
+
+var (
+	feeStatsBucket = "feestats"
+
+	ErrNoFeeEstimate = errors.New("not enough transactions to estimate a fee")
+)
+
+// FeeSample is a transaction the estimator has seen, either confirmed after
+// waiting Wait blocks or still in the mempool after Wait blocks.
+type FeeSample struct {
+	FeeRate   float64
+	Wait      int
+	Confirmed bool
+}
+
+// FeeEstimator answers which fee rate got transactions confirmed within a
+// number of blocks lately.
+type FeeEstimator struct {
+	samples []FeeSample
+}
+
+// NewFeeEstimator learns from the fee stats of the last FEE_ESTIMATE_BLOCKS
+// blocks of bc and, when mempool isn't nil, from the entries still waiting.
+func NewFeeEstimator(bc *Blockchain, mempool *Mempool) (*FeeEstimator, error) {
+	e := &FeeEstimator{}
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		stats := tx.Bucket([]byte(feeStatsBucket))
+		if stats == nil {
+			return nil
+		}
+		// the tip as of this transaction, nil while the chain is empty
+		blocks := tx.Bucket([]byte(blocksBucket))
+		hash := blocks.Get([]byte("l"))
+		for i := 0; i < FEE_ESTIMATE_BLOCKS && len(hash) > 0; i++ {
+			if raw := stats.Get(hash); raw != nil {
+				samples, err := deserializeFeeStats(raw)
+				if err != nil {
+					return err
+				}
+				e.samples = append(e.samples, samples...)
+			}
+			block, err := DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return err
+			}
+			hash = block.PrevBlockHash
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if mempool != nil {
+		height := bc.BestHeight()
+		for _, entry := range mempool.Sorted() {
+			e.AddPending(entry.FeeRate(), height-entry.Height)
+		}
+	}
+	return e, nil
+}
+
+func (e *FeeEstimator) AddConfirmed(feeRate float64, wait int) {
+	e.samples = append(e.samples, FeeSample{FeeRate: feeRate, Wait: wait, Confirmed: true})
+}
+
+func (e *FeeEstimator) AddPending(feeRate float64, waiting int) {
+	e.samples = append(e.samples, FeeSample{FeeRate: feeRate, Wait: waiting})
+}
+
+// EstimateFee returns the lowest fee rate at which transactions were
+// confirmed within target blocks. Rates are judged in ranges from the
+// highest down, each range needs FEE_ESTIMATE_MIN_TXS transactions of which
+// FEE_ESTIMATE_SUCCESS made it in time, and the walk stops at the first range
+// that failed. Pending transactions count as failed once they waited target
+// blocks.
+func (e *FeeEstimator) EstimateFee(target int) (FeeRate, error) {
+	if target < 1 || target > MAX_CONFIRM_TARGET {
+		return 0, fmt.Errorf("confirmation target must be between 1 and %d blocks, not %d", MAX_CONFIRM_TARGET, target)
+	}
+
+	var samples []FeeSample
+	for _, sample := range e.samples {
+		if sample.Confirmed || sample.Wait >= target {
+			samples = append(samples, sample)
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].FeeRate > samples[j].FeeRate
+	})
+
+	estimate, found := 0.0, false
+	total, succeeded := 0, 0
+	for i, sample := range samples {
+		total++
+		if sample.Confirmed && sample.Wait <= target {
+			succeeded++
+		}
+		// equal rates always fall in the same range
+		if total < FEE_ESTIMATE_MIN_TXS || (i+1 < len(samples) && samples[i+1].FeeRate == sample.FeeRate) {
+			continue
+		}
+		if float64(succeeded) < FEE_ESTIMATE_SUCCESS*float64(total) {
+			break
+		}
+		estimate, found = sample.FeeRate, true
+		total, succeeded = 0, 0
+	}
+	if !found {
+		return 0, ErrNoFeeEstimate
+	}
+	return FeeRate(estimate), nil
+}
+
+// recordFeeStats stores the fee rate of every transaction of block and the
+// blocks it waited in the mempool, 1 for transactions that never went
+// through the mempool. It has to run before the block spends its inputs
+// from the chainstate.
+func recordFeeStats(tx *bolt.Tx, block *Block, waits map[string]int) error {
+	utxos, err := tx.CreateBucketIfNotExists([]byte(utxoBucket))
+	if err != nil {
+		return err
+	}
+	fees, err := txFees(utxos, block.TXs)
+	if err != nil {
+		return err
+	}
+
+	var samples []FeeSample
+	for i, t := range block.TXs {
+		if t.IsCoinBase() {
+			continue
+		}
+		bTx, err := t.Serialize()
+		if err != nil {
+			return err
+		}
+		wait, ok := waits[hex.EncodeToString(t.ID)]
+		if !ok || wait < 1 {
+			wait = 1
+		}
+		samples = append(samples, FeeSample{FeeRate: float64(fees[i]) / float64(len(bTx)), Wait: wait, Confirmed: true})
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	b, err := tx.CreateBucketIfNotExists([]byte(feeStatsBucket))
+	if err != nil {
+		return err
+	}
+	return b.Put(block.Hash, serializeFeeStats(samples))
+}
+
+func serializeFeeStats(samples []FeeSample) []byte {
+	w := &serialWriter{}
+	w.writeUint8(SERIALIZATION_VERSION)
+	w.writeVarInt(uint64(len(samples)))
+	for _, sample := range samples {
+		w.writeFloat64(sample.FeeRate)
+		w.writeVarInt(uint64(sample.Wait))
+	}
+	return w.Bytes()
+}
+
+func deserializeFeeStats(d []byte) ([]FeeSample, error) {
+	r := &serialReader{data: d}
+	r.readVersion("fee stats")
+	count := r.readCount("fee stats count", 9)
+	samples := make([]FeeSample, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		samples = append(samples, FeeSample{
+			FeeRate:   r.readFloat64("fee rate"),
+			Wait:      int(r.readVarInt("wait")),
+			Confirmed: true,
+		})
+	}
+	if err := r.finish("fee stats"); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateFee(t *testing.T) {
+	e := &FeeEstimator{}
+	_, err := e.EstimateFee(1)
+	assert.ErrorIs(t, err, ErrNoFeeEstimate)
+	_, err = e.EstimateFee(0)
+	assert.NotNil(t, err)
+	_, err = e.EstimateFee(MAX_CONFIRM_TARGET + 1)
+	assert.NotNil(t, err)
+
+	// the best payers make the next block, cheaper ones wait longer
+	for i := 0; i < 6; i++ {
+		e.AddConfirmed(0.05, 1)
+		e.AddConfirmed(0.02, 3)
+		e.AddConfirmed(0.005, 10)
+	}
+
+	rate, err := e.EstimateFee(1)
+	assert.Nil(t, err)
+	assert.Equal(t, FeeRate(0.05), rate)
+	rate, err = e.EstimateFee(3)
+	assert.Nil(t, err)
+	assert.Equal(t, FeeRate(0.02), rate)
+	rate, err = e.EstimateFee(12)
+	assert.Nil(t, err)
+	assert.Equal(t, FeeRate(0.005), rate)
+
+	// transactions stuck in the mempool show 0.02 isn't enough anymore
+	for i := 0; i < 6; i++ {
+		e.AddPending(0.03, 4)
+	}
+	rate, err = e.EstimateFee(3)
+	assert.Nil(t, err)
+	assert.Equal(t, FeeRate(0.05), rate)
+	// but they don't count against targets they haven't missed yet
+	rate, err = e.EstimateFee(5)
+	assert.Nil(t, err)
+	assert.Equal(t, FeeRate(0.02), rate)
+}
+
+func TestFeeEstimatorReadsChainAndMempool(t *testing.T) {
+	bc, alice, split := newTestMempoolChain(t)
+	mp := NewMempool()
+	bc.mempool = mp
+
+	cheap := newSignedTestTx(alice, split, 0, []TxOutput{{Value: 9}})
+	rich := newSignedTestTx(alice, split, 1, []TxOutput{{Value: 5}})
+	for _, tx := range []*Transaction{cheap, rich} {
+		_, err := mp.Add(tx, bc)
+		assert.Nil(t, err)
+	}
+	assert.NotNil(t, bc.AddBlock([]*Transaction{newTestCoinbase(testAddress("miner"), "", 2, 5), rich}))
+	assert.NotNil(t, bc.AddBlock([]*Transaction{newTestCoinbase(testAddress("miner"), "", 3, 0)}))
+	mp.Remove([]*Transaction{rich})
+
+	e, err := NewFeeEstimator(bc, mp)
+	assert.Nil(t, err)
+	size := func(tx *Transaction) float64 {
+		bTx, _ := tx.Serialize()
+		return float64(len(bTx))
+	}
+	assert.ElementsMatch(t, []FeeSample{
+		{FeeRate: 5 / size(rich), Wait: 1, Confirmed: true},
+		{FeeRate: 20 / size(split), Wait: 1, Confirmed: true},
+		{FeeRate: 1 / size(cheap), Wait: 2},
+	}, e.samples)
+}
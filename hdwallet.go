@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Keys are derived as in BIP32, with the SLIP-0010 rules for the P256 curve
+// the wallet uses, along m/44'/coin'/account'/change/index paths.
+const (
+	HD_HARDENED       = 0x80000000
+	HD_PURPOSE        = 44
+	HD_COIN_TYPE      = 0
+	HD_CHAIN_EXTERNAL = 0
+	HD_CHAIN_CHANGE   = 1
+	// consecutive unused addresses after which a rescan stops looking
+	ADDRESS_GAP_LIMIT = 20
+)
+
+var (
+	hdMasterKey = []byte("Nist256p1 seed")
+)
+
+// ExtendedKey is a private key together with the chain code its children are
+// derived with.
+type ExtendedKey struct {
+	Key       []byte
+	ChainCode []byte
+	Depth     int
+	Index     uint32
+}
+
+// NewMasterKey derives the root of the key tree from a seed.
+func NewMasterKey(seed []byte) (*ExtendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, fmt.Errorf("seed must be between 16 and 64 bytes, not %d", len(seed))
+	}
+	data := seed
+	for {
+		i := hmacSHA512(hdMasterKey, data)
+		if validScalar(i[:32]) {
+			return &ExtendedKey{Key: i[:32], ChainCode: i[32:]}, nil
+		}
+		data = i
+	}
+}
+
+// Child derives the child at index, indexes from HD_HARDENED on are hardened
+// and can't be derived from the parent's public key alone.
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if len(k.Key) != 32 {
+		return nil, errors.New("extended key has no private key")
+	}
+	curve := elliptic.P256()
+
+	var data []byte
+	if index >= HD_HARDENED {
+		data = append([]byte{0}, k.Key...)
+	} else {
+		x, y := curve.ScalarBaseMult(k.Key)
+		data = elliptic.MarshalCompressed(curve, x, y)
+	}
+	data = binary.BigEndian.AppendUint32(data, index)
+
+	for {
+		i := hmacSHA512(k.ChainCode, data)
+		if validScalar(i[:32]) {
+			key := new(big.Int).SetBytes(i[:32])
+			key.Add(key, new(big.Int).SetBytes(k.Key))
+			key.Mod(key, curve.Params().N)
+			if key.Sign() != 0 {
+				child := &ExtendedKey{
+					Key:       key.FillBytes(make([]byte, 32)),
+					ChainCode: i[32:],
+					Depth:     k.Depth + 1,
+					Index:     index,
+				}
+				return child, nil
+			}
+		}
+		// SLIP-0010 retries with the right half instead of skipping the index
+		data = binary.BigEndian.AppendUint32(append([]byte{1}, i[32:]...), index)
+	}
+}
+
+// Derive follows path from k, e.g. m/44'/0'/0'/0/3.
+func (k *ExtendedKey) Derive(path HDPath) (*ExtendedKey, error) {
+	key := k
+	for _, index := range path {
+		child, err := key.Child(index)
+		if err != nil {
+			return nil, err
+		}
+		key = child
+	}
+	return key, nil
+}
+
+// PrivateKey returns the ecdsa key, so the wallet built from it works like any
+// other.
+func (k *ExtendedKey) PrivateKey() *ecdsa.PrivateKey {
+	curve := elliptic.P256()
+	private := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(k.Key)}
+	private.PublicKey.Curve = curve
+	private.PublicKey.X, private.PublicKey.Y = curve.ScalarBaseMult(k.Key)
+
+	return private
+}
+
+func (k *ExtendedKey) Wallet() *Wallet {
+	private := k.PrivateKey()
+	return &Wallet{
+		PrivateKey: *private,
+		PublicKey:  pubKeyBytes(private.PublicKey),
+	}
+}
+
+func hmacSHA512(key, data []byte) []byte {
+	mac := hmac.New(sha512.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func validScalar(b []byte) bool {
+	n := new(big.Int).SetBytes(b)
+	return n.Sign() != 0 && n.Cmp(elliptic.P256().Params().N) < 0
+}
+
+// HDPath is a list of child indexes starting at the master key.
+type HDPath []uint32
+
+// NewAddressPath is the path of the index-th address of an account's external
+// or change chain.
+func NewAddressPath(account uint32, change bool, index uint32) HDPath {
+	chain := uint32(HD_CHAIN_EXTERNAL)
+	if change {
+		chain = HD_CHAIN_CHANGE
+	}
+	return HDPath{
+		HD_PURPOSE + HD_HARDENED,
+		HD_COIN_TYPE + HD_HARDENED,
+		account + HD_HARDENED,
+		chain,
+		index,
+	}
+}
+
+func ParseHDPath(s string) (HDPath, error) {
+	parts := strings.Split(s, "/")
+	if parts[0] != "m" {
+		return nil, fmt.Errorf("derivation path %q doesn't start with m", s)
+	}
+	var path HDPath
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 32)
+		if err != nil || index >= HD_HARDENED {
+			return nil, fmt.Errorf("derivation path %q has an invalid index %q", s, part)
+		}
+		if hardened {
+			index += HD_HARDENED
+		}
+		path = append(path, uint32(index))
+	}
+	return path, nil
+}
+
+func (p HDPath) String() string {
+	var sb strings.Builder
+	sb.WriteString("m")
+	for _, index := range p {
+		if index >= HD_HARDENED {
+			fmt.Fprintf(&sb, "/%d'", index-HD_HARDENED)
+		} else {
+			fmt.Fprintf(&sb, "/%d", index)
+		}
+	}
+	return sb.String()
+}
+
+// AddressParts reports whether p is an account/change/index address path, and
+// returns its parts.
+func (p HDPath) AddressParts() (account uint32, change bool, index uint32, ok bool) {
+	if len(p) != 5 || p[0] != HD_PURPOSE+HD_HARDENED || p[1] != HD_COIN_TYPE+HD_HARDENED ||
+		p[2] < HD_HARDENED || p[3] > HD_CHAIN_CHANGE || p[4] >= HD_HARDENED {
+		return 0, false, 0, false
+	}
+	return p[2] - HD_HARDENED, p[3] == HD_CHAIN_CHANGE, p[4], true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// first test vector of SLIP-0010 for the nist256p1 curve
+func TestExtendedKeyVectors(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := NewMasterKey(seed)
+	assert.Nil(t, err)
+	assert.Equal(t, "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea", hex.EncodeToString(master.ChainCode))
+	assert.Equal(t, "612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2", hex.EncodeToString(master.Key))
+
+	path, err := ParseHDPath("m/0'/1")
+	assert.Nil(t, err)
+	key, err := master.Derive(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, key.Depth)
+	assert.Equal(t, "4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c", hex.EncodeToString(key.ChainCode))
+	assert.Equal(t, "284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129", hex.EncodeToString(key.Key))
+
+	hardened, err := master.Child(HD_HARDENED)
+	assert.Nil(t, err)
+	assert.Equal(t, "6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c", hex.EncodeToString(hardened.Key))
+}
+
+func TestDerivedWallet(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, _ := NewMasterKey(seed)
+	key, err := master.Derive(NewAddressPath(0, false, 0))
+	assert.Nil(t, err)
+
+	wallet := key.Wallet()
+	assert.True(t, wallet.PrivateKey.PublicKey.Curve.IsOnCurve(wallet.PrivateKey.X, wallet.PrivateKey.Y))
+	assert.Equal(t, pubKeyBytes(wallet.PrivateKey.PublicKey), wallet.PublicKey)
+	assert.NotEmpty(t, wallet.GetAddress())
+
+	again, _ := master.Derive(NewAddressPath(0, false, 0))
+	assert.Equal(t, wallet.GetAddress(), again.Wallet().GetAddress())
+	change, _ := master.Derive(NewAddressPath(0, true, 0))
+	assert.NotEqual(t, wallet.GetAddress(), change.Wallet().GetAddress())
+}
+
+func TestHDPath(t *testing.T) {
+	path := NewAddressPath(2, true, 7)
+	assert.Equal(t, "m/44'/0'/2'/1/7", path.String())
+
+	parsed, err := ParseHDPath("m/44h/0'/2'/1/7")
+	assert.Nil(t, err)
+	assert.Equal(t, path, parsed)
+
+	account, change, index, ok := parsed.AddressParts()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(2), account)
+	assert.True(t, change)
+	assert.Equal(t, uint32(7), index)
+
+	_, _, _, ok = HDPath{HD_HARDENED}.AddressParts()
+	assert.False(t, ok)
+
+	for _, invalid := range []string{"", "44'/0'", "m/", "m/x", "m/2147483648"} {
+		_, err := ParseHDPath(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
@@ -1,9 +1,7 @@
 package main
 
 func main() {
-	bc := NewBlockchain("default_address", "BTC")
-
-	cli := NewCLI(bc)
+	cli := NewCLI()
 
 	if err := cli.Run(); err != nil {
 		panic(err)
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// transactions a block template takes from the pool, coinbase excluded
+	MAX_BLOCK_TXS = 1000
+)
+
+var (
+	ErrMempoolKnown    = errors.New("transaction is already in the mempool")
+	ErrMempoolConflict = errors.New("transaction spends an output another mempool transaction spends")
+)
+
+type MempoolEntry struct {
+	Tx    Transaction
+	Fee   int
+	Size  int
+	Added time.Time
+	// best height of the chain when the entry was added
+	Height int
+}
+
+// FeeRate is the fee paid per byte of the serialized transaction.
+func (e *MempoolEntry) FeeRate() float64 {
+	if e.Size == 0 {
+		return 0
+	}
+	return float64(e.Fee) / float64(e.Size)
+}
+
+// Mempool holds validated transactions waiting to be mined. Every output is
+// spent by at most one entry and every entry spends outputs of the UTXO set.
+type Mempool struct {
+	mu      sync.Mutex
+	entries map[string]*MempoolEntry
+	// outpoint => id of the entry spending it
+	spent map[string]string
+}
+
+func NewMempool() *Mempool {
+	return &Mempool{
+		entries: make(map[string]*MempoolEntry),
+		spent:   make(map[string]string),
+	}
+}
+
+func outpoint(txID []byte, vout int) string {
+	return fmt.Sprintf("%x:%d", txID, vout)
+}
+
+// Add validates tx against the chain and the other entries before adding it.
+func (mp *Mempool) Add(tx *Transaction, bc *Blockchain) (*MempoolEntry, error) {
+	if tx.IsCoinBase() {
+		return nil, errors.New("coinbase transactions can't be added to the mempool")
+	}
+	if !bytes.Equal(tx.ID, tx.Hash()) {
+		return nil, errors.New("transaction doesn't hash to its ID")
+	}
+	if _, err := checkOutputValues(tx); err != nil {
+		return nil, err
+	}
+	txID := hex.EncodeToString(tx.ID)
+
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	if _, ok := mp.entries[txID]; ok {
+		return nil, ErrMempoolKnown
+	}
+	for _, vin := range tx.VIn {
+		if other, ok := mp.spent[outpoint(vin.Txid, vin.Vout)]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrMempoolConflict, other)
+		}
+	}
+
+	fee, err := NewUTXOSet(bc).BlockFees([]*Transaction{tx})
+	if err != nil {
+		return nil, err
+	}
+	if !bc.VerifyTransaction(tx) {
+		return nil, errors.New("transaction has an invalid signature")
+	}
+	bTx, err := tx.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &MempoolEntry{
+		Tx:    *tx,
+		Fee:   fee,
+		Size:  len(bTx),
+		Added: time.Now(),
+
+		Height: bc.BestHeight(),
+	}
+	mp.entries[txID] = entry
+	for _, vin := range tx.VIn {
+		mp.spent[outpoint(vin.Txid, vin.Vout)] = txID
+	}
+
+	return entry, nil
+}
+
+func (mp *Mempool) Has(txID []byte) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	_, ok := mp.entries[hex.EncodeToString(txID)]
+	return ok
+}
+
+func (mp *Mempool) Get(txID []byte) (Transaction, bool) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	entry, ok := mp.entries[hex.EncodeToString(txID)]
+	if !ok {
+		return Transaction{}, false
+	}
+	return entry.Tx, true
+}
+
+// SpentOutpoints returns the outpoints the entries spend, see outpoint.
+func (mp *Mempool) SpentOutpoints() map[string]bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	spent := make(map[string]bool, len(mp.spent))
+	for op := range mp.spent {
+		spent[op] = true
+	}
+	return spent
+}
+
+// spentOutpoints returns the outpoints txs spend, see outpoint.
+func spentOutpoints(txs []*Transaction) map[string]bool {
+	spent := make(map[string]bool)
+	for _, tx := range txs {
+		for _, vin := range tx.VIn {
+			spent[outpoint(vin.Txid, vin.Vout)] = true
+		}
+	}
+	return spent
+}
+
+func (mp *Mempool) Count() int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	return len(mp.entries)
+}
+
+// Remove drops the transactions of a connected block together with every
+// entry that spends one of the outputs they spent.
+func (mp *Mempool) Remove(txs []*Transaction) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	for _, tx := range txs {
+		mp.remove(hex.EncodeToString(tx.ID))
+		if tx.IsCoinBase() {
+			continue
+		}
+		for _, vin := range tx.VIn {
+			if other, ok := mp.spent[outpoint(vin.Txid, vin.Vout)]; ok {
+				mp.remove(other)
+			}
+		}
+	}
+}
+
+func (mp *Mempool) remove(txID string) {
+	entry, ok := mp.entries[txID]
+	if !ok {
+		return
+	}
+	for _, vin := range entry.Tx.VIn {
+		delete(mp.spent, outpoint(vin.Txid, vin.Vout))
+	}
+	delete(mp.entries, txID)
+}
+
+// Waits returns how many blocks the entries among txs waited to be confirmed
+// in a block at height, keyed by hex encoded transaction id.
+func (mp *Mempool) Waits(height int, txs []*Transaction) map[string]int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	waits := make(map[string]int)
+	for _, tx := range txs {
+		txID := hex.EncodeToString(tx.ID)
+		if entry, ok := mp.entries[txID]; ok {
+			waits[txID] = height - entry.Height
+		}
+	}
+	return waits
+}
+
+// Sorted returns the entries with the best fee rate first, older entries
+// first among equal rates.
+func (mp *Mempool) Sorted() []*MempoolEntry {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	entries := make([]*MempoolEntry, 0, len(mp.entries))
+	for _, entry := range mp.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].FeeRate() != entries[j].FeeRate() {
+			return entries[i].FeeRate() > entries[j].FeeRate()
+		}
+		return entries[i].Added.Before(entries[j].Added)
+	})
+
+	return entries
+}
+
+// BlockTemplate picks the best maxTxs transactions that are still valid on
+// top of the current tip and prepends a coinbase paying their fees to
+// minerAddress. Entries that became invalid are dropped from the pool.
+func (mp *Mempool) BlockTemplate(bc *Blockchain, minerAddress string, maxTxs int) ([]*Transaction, error) {
+	if bc.BestHeight() < 0 {
+		return nil, errors.New("can't build a block template on an empty chain")
+	}
+	if err := ValidateAddress(minerAddress); err != nil {
+		return nil, fmt.Errorf("invalid miner address: %w", err)
+	}
+	UTXOSet := NewUTXOSet(bc)
+	var txs []*Transaction
+	fees := 0
+
+	for _, entry := range mp.Sorted() {
+		if len(txs) >= maxTxs {
+			break
+		}
+		tx := entry.Tx
+		fee, err := UTXOSet.BlockFees([]*Transaction{&tx})
+		if err != nil {
+			mp.Remove([]*Transaction{&tx})
+			continue
+		}
+		txs = append(txs, &tx)
+		fees += fee
+	}
+
+	height := bc.BestHeight() + 1
+	coinbase, err := NewCoinbaseTx(minerAddress, "", height, bc.SubsidySchedule().Subsidy(height)+fees)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]*Transaction{coinbase}, txs...), nil
+}
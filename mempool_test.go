@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestMempoolChain gives alice three unspent outputs of 10 each.
+func newTestMempoolChain(t *testing.T) (*Blockchain, *Wallet, *Transaction) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+	aliceHash := HashPubKey(alice.PublicKey)
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+
+	split := newSignedTestTx(alice, coinbase, 0, []TxOutput{
+		{Value: 10, PubKeyHash: aliceHash},
+		{Value: 10, PubKeyHash: aliceHash},
+		{Value: 10, PubKeyHash: aliceHash},
+	})
+	second := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 20), split)
+
+	return newTestBlockchain(t, genesis, second), alice, split
+}
+
+func TestMempoolAdd(t *testing.T) {
+	bc, alice, split := newTestMempoolChain(t)
+	mp := NewMempool()
+
+	tx := newSignedTestTx(alice, split, 0, []TxOutput{{Value: 9}})
+	entry, err := mp.Add(tx, bc)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, entry.Fee)
+	assert.True(t, mp.Has(tx.ID))
+
+	_, err = mp.Add(tx, bc)
+	assert.True(t, errors.Is(err, ErrMempoolKnown))
+
+	conflict := newSignedTestTx(alice, split, 0, []TxOutput{{Value: 8}})
+	_, err = mp.Add(conflict, bc)
+	assert.True(t, errors.Is(err, ErrMempoolConflict))
+
+	overspend := newSignedTestTx(alice, split, 1, []TxOutput{{Value: 11}})
+	_, err = mp.Add(overspend, bc)
+	assert.NotNil(t, err)
+
+	stolen := newSignedTestTx(NewWallet(), split, 2, []TxOutput{{Value: 10}})
+	_, err = mp.Add(stolen, bc)
+	assert.NotNil(t, err)
+
+	negative := newSignedTestTx(alice, split, 2, []TxOutput{{Value: -1000}, {Value: 1010}})
+	_, err = mp.Add(negative, bc)
+	assert.NotNil(t, err)
+	assert.False(t, mp.Has(negative.ID))
+
+	assert.Equal(t, 1, mp.Count())
+}
+
+func TestMempoolBlockTemplate(t *testing.T) {
+	bc, alice, split := newTestMempoolChain(t)
+	mp := NewMempool()
+
+	cheap := newSignedTestTx(alice, split, 0, []TxOutput{{Value: 9}})
+	rich := newSignedTestTx(alice, split, 1, []TxOutput{{Value: 5}})
+	middle := newSignedTestTx(alice, split, 2, []TxOutput{{Value: 7}})
+	for _, tx := range []*Transaction{cheap, rich, middle} {
+		_, err := mp.Add(tx, bc)
+		assert.Nil(t, err)
+	}
+
+	sorted := mp.Sorted()
+	assert.Equal(t, rich.ID, sorted[0].Tx.ID)
+	assert.Equal(t, middle.ID, sorted[1].Tx.ID)
+	assert.Equal(t, cheap.ID, sorted[2].Tx.ID)
+
+	txs, err := mp.BlockTemplate(bc, testAddress("miner"), 2)
+	assert.Nil(t, err)
+	assert.Len(t, txs, 3)
+	assert.True(t, txs[0].IsCoinBase())
+	assert.Equal(t, defaultSubsidySchedule.Subsidy(2)+5+3, txs[0].VOut[0].Value)
+	assert.Equal(t, rich.ID, txs[1].ID)
+	assert.Equal(t, middle.ID, txs[2].ID)
+
+	mp.Remove(txs)
+	assert.Equal(t, 1, mp.Count())
+	assert.True(t, mp.Has(cheap.ID))
+}
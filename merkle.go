@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// MerkleTree keeps every level of the tree, leaves first, so inclusion proofs
+// can be read off without rebuilding it. The leaves are the transaction IDs
+// and a level with an odd number of nodes pairs its last node with itself.
+type MerkleTree struct {
+	levels [][][]byte
+}
+
+type MerkleProof struct {
+	TxID []byte
+	// position of the transaction in the block
+	Index int
+	// sibling hashes from the leaf level up to just below the root
+	Hashes [][]byte
+}
+
+func NewMerkleTree(leaves [][]byte) *MerkleTree {
+	if len(leaves) == 0 {
+		empty := sha256.Sum256([]byte{})
+		return &MerkleTree{levels: [][][]byte{{empty[:]}}}
+	}
+
+	level := make([][]byte, len(leaves))
+	copy(level, leaves)
+	levels := [][][]byte{level}
+
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			right := level[i]
+			if i+1 < len(level) {
+				right = level[i+1]
+			}
+			next = append(next, hashMerkleNodes(level[i], right))
+		}
+		levels = append(levels, next)
+		level = next
+	}
+
+	return &MerkleTree{levels: levels}
+}
+
+// duplicateLeaf returns a leaf that appears more than once, nil if there is
+// none. As an odd last node is paired with itself, leaves ending in a copy of
+// their odd tail have the same root as the leaves without it, so a block may
+// only be accepted when its transaction IDs are unique.
+func duplicateLeaf(leaves [][]byte) []byte {
+	seen := make(map[string]bool)
+	for _, leaf := range leaves {
+		if seen[string(leaf)] {
+			return leaf
+		}
+		seen[string(leaf)] = true
+	}
+	return nil
+}
+
+func hashMerkleNodes(left, right []byte) []byte {
+	hash := sha256.Sum256(bytes.Join([][]byte{left, right}, []byte{}))
+	return hash[:]
+}
+
+func (t *MerkleTree) Root() []byte {
+	return t.levels[len(t.levels)-1][0]
+}
+
+func (t *MerkleTree) Proof(txID []byte) (*MerkleProof, error) {
+	index := -1
+	for i, leaf := range t.levels[0] {
+		if bytes.Equal(leaf, txID) {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return nil, fmt.Errorf("transaction %x is not in the tree", txID)
+	}
+
+	proof := &MerkleProof{
+		TxID:  txID,
+		Index: index,
+	}
+	pos := index
+	for _, level := range t.levels[:len(t.levels)-1] {
+		sibling := pos ^ 1
+		if sibling >= len(level) {
+			sibling = pos
+		}
+		proof.Hashes = append(proof.Hashes, level[sibling])
+		pos /= 2
+	}
+
+	return proof, nil
+}
+
+// Verify recomputes the root from the transaction and its siblings. Every
+// hash has to be a full sha256 digest, so an inner node can't be passed off
+// as a transaction ID.
+func (p *MerkleProof) Verify(root []byte) bool {
+	if p.Index < 0 || len(p.Hashes) >= 63 || p.Index >= 1<<uint(len(p.Hashes)) {
+		return false
+	}
+	if len(p.TxID) != sha256.Size || len(root) != sha256.Size {
+		return false
+	}
+	for _, sibling := range p.Hashes {
+		if len(sibling) != sha256.Size {
+			return false
+		}
+	}
+
+	hash := p.TxID
+	pos := p.Index
+	for _, sibling := range p.Hashes {
+		if pos%2 == 0 {
+			hash = hashMerkleNodes(hash, sibling)
+		} else {
+			hash = hashMerkleNodes(sibling, hash)
+		}
+		pos /= 2
+	}
+
+	return bytes.Equal(hash, root)
+}
+
+// MerkleProof builds an inclusion proof for the transaction against the
+// Merkle root of the block that contains it.
+func (bc *Blockchain) MerkleProof(txID []byte) (*MerkleProof, *Block, error) {
+	bci := bc.Iterator()
+
+	for {
+		block := bci.Next()
+		if block == nil {
+			return nil, nil, errors.New("unable to read the chain")
+		}
+
+		for _, tx := range block.TXs {
+			if bytes.Equal(tx.ID, txID) {
+				proof, err := block.MerkleTree().Proof(txID)
+				if err != nil {
+					return nil, nil, err
+				}
+				return proof, block, nil
+			}
+		}
+
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	return nil, nil, errors.New("Transaction is not found")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testLeaves(n int) [][]byte {
+	var leaves [][]byte
+	for i := 0; i < n; i++ {
+		hash := sha256.Sum256([]byte{byte(i)})
+		leaves = append(leaves, hash[:])
+	}
+	return leaves
+}
+
+func TestMerkleTreeRoot(t *testing.T) {
+	leaves := testLeaves(3)
+	left := hashMerkleNodes(leaves[0], leaves[1])
+	right := hashMerkleNodes(leaves[2], leaves[2])
+
+	assert.Equal(t, hashMerkleNodes(left, right), NewMerkleTree(leaves).Root())
+	assert.Equal(t, leaves[0], NewMerkleTree(leaves[:1]).Root())
+}
+
+func TestMerkleProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		leaves := testLeaves(n)
+		tree := NewMerkleTree(leaves)
+
+		for i, leaf := range leaves {
+			proof, err := tree.Proof(leaf)
+			assert.Nil(t, err)
+			assert.Equal(t, i, proof.Index)
+			assert.True(t, proof.Verify(tree.Root()))
+
+			proof.TxID = testLeaves(n + 1)[n]
+			assert.False(t, proof.Verify(tree.Root()))
+		}
+	}
+
+	_, err := NewMerkleTree(testLeaves(4)).Proof([]byte("missing"))
+	assert.NotNil(t, err)
+
+	// an inner node is no transaction
+	tree := NewMerkleTree(testLeaves(4))
+	proof, err := tree.Proof(testLeaves(4)[0])
+	assert.Nil(t, err)
+	inner := &MerkleProof{TxID: append(proof.TxID, proof.Hashes[0]...), Index: 0, Hashes: proof.Hashes[1:]}
+	assert.False(t, inner.Verify(tree.Root()))
+	proof.Hashes[0] = proof.Hashes[0][:16]
+	assert.False(t, proof.Verify(tree.Root()))
+}
+
+func TestMerkleDuplicateLeaf(t *testing.T) {
+	leaves := testLeaves(3)
+	mutated := append(leaves, leaves[2])
+	assert.Equal(t, NewMerkleTree(leaves).Root(), NewMerkleTree(mutated).Root())
+
+	assert.Nil(t, duplicateLeaf(leaves))
+	assert.Equal(t, leaves[2], duplicateLeaf(mutated))
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	// blocks written before the current consensus rules, e.g. without heights,
+	// target bits or transaction IDs, can't be rewritten without mining them
+	// again
+	ErrNotMigratable = errors.New("the chain doesn't meet the current consensus rules and can't be migrated, create a new one")
+)
+
+// deserializeGobBlock decodes a block the way chains stored them before the
+// binary format existed.
+func deserializeGobBlock(d []byte) (*Block, error) {
+	var block Block
+	decoder := gob.NewDecoder(bytes.NewReader(d))
+	if err := decoder.Decode(&block); err != nil {
+		return nil, err
+	}
+	return &block, nil
+}
+
+// MigrateChain rewrites the gob encoded blocks of db in the binary format and
+// rebuilds the UTXO set, the undo records and the indexes, which were gob
+// encoded as well. The main chain is validated from genesis first and db is
+// only changed once every block passed, in a single transaction. Chains
+// without gob blocks are left alone, so migrating twice is harmless. It
+// returns the number of blocks rewritten.
+func MigrateChain(db *bolt.DB) (int, error) {
+	var tip []byte
+	blocks := make(map[string]*Block)
+	legacy := make(map[string]bool)
+
+	err := db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		if b == nil {
+			return fmt.Errorf("blocks bucket %s not exists", blocksBucket)
+		}
+		if hash := b.Get([]byte("l")); hash != nil {
+			tip = append([]byte{}, hash...)
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if string(k) == "l" {
+				return nil
+			}
+			block, err := DeserializeBlock(v)
+			if err != nil {
+				if block, err = deserializeGobBlock(v); err != nil {
+					return fmt.Errorf("block %x is neither binary nor gob encoded: %w", k, err)
+				}
+				legacy[string(k)] = true
+			}
+			if !bytes.Equal(block.Hash, k) {
+				return fmt.Errorf("%w: block stored under %x has hash %x", ErrNotMigratable, k, block.Hash)
+			}
+			blocks[string(k)] = block
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(legacy) == 0 {
+		return 0, nil
+	}
+
+	chain, err := migratedChain(db, tip, blocks)
+	if err != nil {
+		return 0, err
+	}
+	onChain := make(map[string]bool)
+	for _, block := range chain {
+		onChain[string(block.Hash)] = true
+	}
+	var side []*Block
+	for hash, block := range blocks {
+		if onChain[hash] {
+			continue
+		}
+		if legacy[hash] {
+			return 0, fmt.Errorf("%w: gob encoded block %x is not on the main chain", ErrNotMigratable, block.Hash)
+		}
+		side = append(side, block)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range []string{utxoBucket, undoBucket, blockIndexBucket, heightIndexBucket, txIndexBucket, addrIndexBucket} {
+			if tx.Bucket([]byte(name)) == nil {
+				continue
+			}
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+			// the optional indexes stay on
+			if name == txIndexBucket || name == addrIndexBucket {
+				if _, err := tx.CreateBucket([]byte(name)); err != nil {
+					return err
+				}
+			}
+		}
+
+		// applyBlock stores every block again in the binary format
+		for _, block := range chain {
+			if err := applyBlock(tx, block); err != nil {
+				return fmt.Errorf("block %x: %w", block.Hash, err)
+			}
+		}
+		// side branches are indexed once their parent is
+		for len(side) > 0 {
+			var left []*Block
+			for _, block := range side {
+				if _, err := getBlockIndex(tx, block.PrevBlockHash); err != nil {
+					left = append(left, block)
+					continue
+				}
+				if _, err := storeBlock(tx, block); err != nil {
+					return err
+				}
+			}
+			if len(left) == len(side) {
+				return fmt.Errorf("block %x doesn't connect to the chain", left[0].Hash)
+			}
+			side = left
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(legacy), nil
+}
+
+// migratedChain returns the main chain of blocks from genesis to tip once
+// every block of it passed a ChainValidator.
+func migratedChain(db *bolt.DB, tip []byte, blocks map[string]*Block) ([]*Block, error) {
+	var chain []*Block
+	for hash := tip; len(hash) != 0; {
+		block, ok := blocks[string(hash)]
+		if !ok {
+			return nil, fmt.Errorf("block %x of the main chain is missing", hash)
+		}
+		chain = append(chain, block)
+		hash = block.PrevBlockHash
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+
+	v := NewChainValidator(&Blockchain{db: db})
+	v.blockByHash = func(hash []byte) (*Block, error) {
+		if block, ok := blocks[string(hash)]; ok {
+			return block, nil
+		}
+		return nil, fmt.Errorf("block %x is %w", hash, ErrNotFound)
+	}
+	for _, block := range chain {
+		if err := v.ConnectBlock(block, true); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrNotMigratable, err)
+		}
+	}
+	return chain, nil
+}
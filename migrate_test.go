@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+)
+
+// baselineBlock and baselineTransaction are the layout the first version of
+// the chain stored with gob: no heights, target bits or merkle roots, and
+// coinbases without an ID.
+type baselineBlock struct {
+	Timestamp     int64
+	PrevBlockHash []byte
+	Hash          []byte
+	Version       float64
+	Nonce         int
+
+	TXs []*baselineTransaction
+}
+
+type baselineTransaction struct {
+	ID   []byte
+	VIn  []TxInput
+	VOut []TxOutput
+}
+
+func putGob(b *bolt.Bucket, key []byte, v interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return err
+	}
+	return b.Put(key, buf.Bytes())
+}
+
+func TestMigrateChain(t *testing.T) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	spend := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 20, PubKeyHash: testPubKeyHash("bob")}, {Value: 30, PubKeyHash: HashPubKey(alice.PublicKey)}})
+	block := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0), spend)
+	bc := newTestBlockchain(t, genesis, block)
+
+	// store the blocks the way older versions did and leave a gob chainstate
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(blocksBucket))
+		for _, block := range []*Block{genesis, block} {
+			if err := putGob(b, block.Hash, block); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket([]byte(utxoBucket)).Put([]byte("stale"), []byte("gob"))
+	})
+	assert.Nil(t, err)
+	_, err = bc.BlockByHash(block.Hash)
+	assert.NotNil(t, err)
+
+	migrated, err := MigrateChain(bc.db)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, migrated)
+
+	stored, err := bc.BlockByHeight(1)
+	assert.Nil(t, err)
+	assert.Equal(t, spend, stored.TXs[1])
+	UTXOSet := NewUTXOSet(bc)
+	assert.Equal(t, 2, UTXOSet.CountTransactions())
+	assert.Equal(t, []TxOutput{{Value: 20, PubKeyHash: testPubKeyHash("bob")}}, UTXOSet.FindUTXOs(testPubKeyHash("bob")))
+	report, err := bc.VerifyChain(0)
+	assert.Nil(t, err)
+	assert.Nil(t, report.Failure)
+	assert.Equal(t, 2, report.BlocksChecked)
+
+	migrated, err = MigrateChain(bc.db)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, migrated)
+}
+
+func TestMigrateChainRefusesBaselineBlocks(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "BTC")
+	db, err := bolt.Open(name, 0600, nil)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	// what the baseline createblockchain and send stored
+	coinbase := &baselineTransaction{
+		VIn:  []TxInput{{Txid: []byte{}, Vout: -1, PubKey: []byte{}}},
+		VOut: []TxOutput{{Value: REWARD, PubKeyHash: []byte{}}},
+	}
+	genesis := &baselineBlock{Timestamp: 1, PrevBlockHash: []byte{}, Version: VERSION, TXs: []*baselineTransaction{coinbase}}
+	spend := &baselineTransaction{
+		ID:   []byte("spend"),
+		VIn:  []TxInput{{Vout: 0, PubKey: []byte{}}},
+		VOut: []TxOutput{{Value: 10, PubKeyHash: []byte{}}, {Value: REWARD - 10, PubKeyHash: []byte{}}},
+	}
+	second := &baselineBlock{Timestamp: 2, Version: VERSION, TXs: []*baselineTransaction{spend}}
+	prev := []byte{}
+	for _, block := range []*baselineBlock{genesis, second} {
+		block.PrevBlockHash = prev
+		hash := sha256.Sum256(append(append([]byte{}, prev...), strconv.FormatInt(block.Timestamp, 10)...))
+		block.Hash = hash[:]
+		prev = block.Hash
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(blocksBucket))
+		if err != nil {
+			return err
+		}
+		for _, block := range []*baselineBlock{genesis, second} {
+			if err := putGob(b, block.Hash, block); err != nil {
+				return err
+			}
+		}
+		return b.Put([]byte("l"), second.Hash)
+	})
+	assert.Nil(t, err)
+
+	before, err := os.ReadFile(name)
+	assert.Nil(t, err)
+	_, err = MigrateChain(db)
+	assert.ErrorIs(t, err, ErrNotMigratable)
+	after, err := os.ReadFile(name)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(before, after), "a refused migration changed the file")
+}
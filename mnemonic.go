@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// BIP39 parameters, the seed is what the HD master key is derived from
+const (
+	MNEMONIC_WORDS_DEFAULT = 12
+	MNEMONIC_SEED_ROUNDS   = 2048
+	MNEMONIC_SEED_LEN      = 64
+)
+
+var (
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+)
+
+// the BIP39 english word list, sha256 2f5eed53a4727b4bf8880d8f3f199efc90e58503646d9ff8eff3a2ed3b24dbda
+//
+//go:embed mnemonic_english.txt
+var mnemonicEnglish string
+
+var (
+	mnemonicWords   = strings.Fields(mnemonicEnglish)
+	mnemonicIndexes = func() map[string]int {
+		indexes := make(map[string]int, len(mnemonicWords))
+		for i, word := range mnemonicWords {
+			indexes[word] = i
+		}
+		return indexes
+	}()
+)
+
+// NewMnemonic returns a random mnemonic of words words, which has to be one of
+// 12, 15, 18, 21 or 24.
+func NewMnemonic(words int) (string, error) {
+	if words < 12 || words > 24 || words%3 != 0 {
+		return "", fmt.Errorf("a mnemonic has 12, 15, 18, 21 or 24 words, not %d", words)
+	}
+	// every 3 words carry 32 bits of entropy and 1 checksum bit
+	entropy, err := randomBytes(words / 3 * 4)
+	if err != nil {
+		return "", err
+	}
+	return EntropyToMnemonic(entropy)
+}
+
+// EntropyToMnemonic appends the checksum to entropy and splits the result in
+// groups of 11 bits, each one picking a word.
+func EntropyToMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", fmt.Errorf("entropy of %d bits can't be turned into a mnemonic", bits)
+	}
+	checksumBits := bits / 32
+	hash := sha256.Sum256(entropy)
+
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, uint(checksumBits))
+	data.Or(data, big.NewInt(int64(hash[0]>>(8-checksumBits))))
+
+	count := (bits + checksumBits) / 11
+	words := make([]string, count)
+	mask := big.NewInt(2047)
+	for i := count - 1; i >= 0; i-- {
+		index := new(big.Int).And(data, mask)
+		words[i] = mnemonicWords[index.Int64()]
+		data.Rsh(data, 11)
+	}
+
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy is the reverse of EntropyToMnemonic and fails with
+// ErrInvalidMnemonic on unknown words or a wrong checksum.
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("%w: it has %d words", ErrInvalidMnemonic, len(words))
+	}
+
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := mnemonicIndexes[strings.ToLower(word)]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+
+	checksumBits := len(words) / 3
+	checksum := new(big.Int).And(data, big.NewInt(int64(1)<<checksumBits-1))
+	data.Rsh(data, uint(checksumBits))
+	entropy := make([]byte, len(words)/3*4)
+	data.FillBytes(entropy)
+
+	hash := sha256.Sum256(entropy)
+	if checksum.Int64() != int64(hash[0]>>(8-checksumBits)) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidMnemonic)
+	}
+
+	return entropy, nil
+}
+
+// MnemonicSeed checks mnemonic and stretches it into the seed of an HD
+// wallet. The optional passphrase yields a completely different seed.
+func MnemonicSeed(mnemonic, passphrase string) ([]byte, error) {
+	if _, err := MnemonicToEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+	normalized := strings.ToLower(strings.Join(strings.Fields(mnemonic), " "))
+
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), MNEMONIC_SEED_ROUNDS, MNEMONIC_SEED_LEN, sha512.New), nil
+}
@@ -0,0 +1,652 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// bumped whenever the wire format of a message changes
+	PROTOCOL_VERSION = 3
+	COMMAND_LENGTH   = 12
+	DIAL_TIMEOUT     = 5 * time.Second
+	// messages are read whole before they are decoded, so their size and
+	// the time a peer may take to send one are capped
+	MAX_MESSAGE_SIZE = 32 << 20
+	READ_TIMEOUT     = 30 * time.Second
+)
+
+// every message is sent on its own connection as a fixed size command
+// followed by the gob encoded payload, blocks and transactions inside it are
+// in the binary format of serialize.go
+type versionMsg struct {
+	Version    int
+	BestHeight int
+	AddrFrom   string
+}
+
+type getBlocksMsg struct {
+	AddrFrom string
+}
+
+type invMsg struct {
+	AddrFrom string
+	Type     string
+	Items    [][]byte
+}
+
+type getDataMsg struct {
+	AddrFrom string
+	Type     string
+	ID       []byte
+}
+
+type blockMsg struct {
+	AddrFrom string
+	Block    []byte
+}
+
+type txMsg struct {
+	AddrFrom    string
+	Transaction []byte
+}
+
+// mineMsg asks a node to mine a block from its mempool. Only accepted from
+// the local machine.
+type mineMsg struct {
+	MinerAddress string
+	MaxTxs       int
+}
+
+// estimateFeeMsg asks a node for the fee rate that confirms a transaction
+// within Blocks blocks.
+type estimateFeeMsg struct {
+	Blocks int
+}
+
+// mempoolMsg asks a node for the transactions in its mempool.
+type mempoolMsg struct{}
+
+// replyMsg is written back on the connection of a tx, mine, estimatefee or
+// mempool request.
+type replyMsg struct {
+	Error        string
+	Hash         []byte
+	FeeRate      float64
+	Transactions [][]byte
+}
+
+type Node struct {
+	address      string
+	minerAddress string
+	bc           *Blockchain
+
+	// chainMu serializes everything that moves the tip
+	chainMu sync.Mutex
+
+	mu              sync.Mutex
+	knownNodes      map[string]bool
+	blocksInTransit [][]byte
+	// whether a block is being mined in the background and whether another
+	// one was asked for meanwhile, see mineInBackground
+	mining, mineAgain bool
+
+	mempool *Mempool
+}
+
+func NewNode(address, minerAddress string, bc *Blockchain, peers []string) *Node {
+	n := &Node{
+		address:      address,
+		minerAddress: minerAddress,
+		bc:           bc,
+		knownNodes:   make(map[string]bool),
+		mempool:      NewMempool(),
+	}
+	bc.mempool = n.mempool
+	for _, peer := range peers {
+		if peer != "" && peer != address {
+			n.knownNodes[peer] = true
+		}
+	}
+	return n
+}
+
+// Start listens for peers and announces the node to the ones it already knows.
+func (n *Node) Start() error {
+	ln, err := net.Listen("tcp", n.address)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	log.Printf("node %s is listening, best height %d\n", n.address, n.bc.BestHeight())
+	for _, peer := range n.peers("") {
+		n.sendVersion(peer)
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go n.handleConnection(conn)
+	}
+}
+
+func (n *Node) peers(except string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var peers []string
+	for peer := range n.knownNodes {
+		if peer != except {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+func (n *Node) addPeer(addr string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if addr != "" && addr != n.address {
+		n.knownNodes[addr] = true
+	}
+}
+
+func commandToBytes(command string) []byte {
+	var b [COMMAND_LENGTH]byte
+	copy(b[:], command)
+	return b[:]
+}
+
+func bytesToCommand(b []byte) string {
+	return string(bytes.TrimRight(b, "\x00"))
+}
+
+func encodeMessage(command string, payload interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(commandToBytes(command))
+	if err := gob.NewEncoder(&buf).Encode(payload); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// sendMessage delivers a message to addr. Peers that can't be reached are
+// forgotten.
+func (n *Node) sendMessage(addr, command string, payload interface{}) {
+	msg, err := encodeMessage(command, payload)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := sendMessage(addr, msg); err != nil {
+		log.Printf("%s is not available: %s\n", addr, err)
+		n.mu.Lock()
+		delete(n.knownNodes, addr)
+		n.mu.Unlock()
+	}
+}
+
+func sendMessage(addr string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, DIAL_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(msg)
+	return err
+}
+
+// requestMessage sends a message and waits for the node's reply.
+func requestMessage(addr string, msg []byte) (*replyMsg, error) {
+	conn, err := net.DialTimeout("tcp", addr, DIAL_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		return nil, err
+	}
+
+	var reply replyMsg
+	if err := gob.NewDecoder(conn).Decode(&reply); err != nil {
+		return nil, err
+	}
+	if reply.Error != "" {
+		return nil, errors.New(reply.Error)
+	}
+	return &reply, nil
+}
+
+// SendTransaction hands a transaction to the mempool of the node listening
+// on addr, which relays it to its peers.
+func SendTransaction(addr string, tx *Transaction) error {
+	bTx, err := tx.Serialize()
+	if err != nil {
+		return err
+	}
+	msg, err := encodeMessage("tx", txMsg{Transaction: bTx})
+	if err != nil {
+		return err
+	}
+	_, err = requestMessage(addr, msg)
+	return err
+}
+
+// RequestMining asks the node listening on addr to mine a block from its
+// mempool and returns the hash of the mined block.
+func RequestMining(addr, minerAddress string, maxTxs int) ([]byte, error) {
+	msg, err := encodeMessage("mine", mineMsg{MinerAddress: minerAddress, MaxTxs: maxTxs})
+	if err != nil {
+		return nil, err
+	}
+	reply, err := requestMessage(addr, msg)
+	if err != nil {
+		return nil, err
+	}
+	return reply.Hash, nil
+}
+
+// RequestFeeEstimate asks the node listening on addr for the fee rate that
+// confirms a transaction within blocks blocks, judged by its chain and
+// mempool.
+func RequestFeeEstimate(addr string, blocks int) (FeeRate, error) {
+	msg, err := encodeMessage("estimatefee", estimateFeeMsg{Blocks: blocks})
+	if err != nil {
+		return 0, err
+	}
+	reply, err := requestMessage(addr, msg)
+	if err != nil {
+		return 0, err
+	}
+	return FeeRate(reply.FeeRate), nil
+}
+
+// RequestMempool returns the transactions waiting in the mempool of the
+// node listening on addr.
+func RequestMempool(addr string) ([]*Transaction, error) {
+	msg, err := encodeMessage("mempool", mempoolMsg{})
+	if err != nil {
+		return nil, err
+	}
+	reply, err := requestMessage(addr, msg)
+	if err != nil {
+		return nil, err
+	}
+	var txs []*Transaction
+	for _, raw := range reply.Transactions {
+		tx, err := DeserializeTransaction(raw)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+func (n *Node) sendVersion(addr string) {
+	n.sendMessage(addr, "version", versionMsg{
+		Version:    PROTOCOL_VERSION,
+		BestHeight: n.bc.BestHeight(),
+		AddrFrom:   n.address,
+	})
+}
+
+func (n *Node) sendGetBlocks(addr string) {
+	n.sendMessage(addr, "getblocks", getBlocksMsg{AddrFrom: n.address})
+}
+
+func (n *Node) sendInv(addr, kind string, items [][]byte) {
+	n.sendMessage(addr, "inv", invMsg{AddrFrom: n.address, Type: kind, Items: items})
+}
+
+func (n *Node) sendGetData(addr, kind string, id []byte) {
+	n.sendMessage(addr, "getdata", getDataMsg{AddrFrom: n.address, Type: kind, ID: id})
+}
+
+func (n *Node) sendBlock(addr string, block *Block) {
+	bBlock, err := block.Serialize()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	n.sendMessage(addr, "block", blockMsg{AddrFrom: n.address, Block: bBlock})
+}
+
+func (n *Node) sendTx(addr string, tx Transaction) {
+	bTx, err := tx.Serialize()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	n.sendMessage(addr, "tx", txMsg{AddrFrom: n.address, Transaction: bTx})
+}
+
+func (n *Node) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	if err := conn.SetReadDeadline(time.Now().Add(READ_TIMEOUT)); err != nil {
+		log.Println(err)
+		return
+	}
+	request, err := io.ReadAll(io.LimitReader(conn, MAX_MESSAGE_SIZE+1))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(request) > MAX_MESSAGE_SIZE {
+		log.Printf("message from %s is larger than %d bytes\n", conn.RemoteAddr(), MAX_MESSAGE_SIZE)
+		return
+	}
+	if len(request) < COMMAND_LENGTH {
+		log.Printf("message from %s is too short\n", conn.RemoteAddr())
+		return
+	}
+	command := bytesToCommand(request[:COMMAND_LENGTH])
+	decoder := gob.NewDecoder(bytes.NewReader(request[COMMAND_LENGTH:]))
+
+	switch command {
+	case "version":
+		var payload versionMsg
+		if err = decoder.Decode(&payload); err == nil {
+			n.handleVersion(payload)
+		}
+	case "getblocks":
+		var payload getBlocksMsg
+		if err = decoder.Decode(&payload); err == nil {
+			n.handleGetBlocks(payload)
+		}
+	case "inv":
+		var payload invMsg
+		if err = decoder.Decode(&payload); err == nil {
+			n.handleInv(payload)
+		}
+	case "getdata":
+		var payload getDataMsg
+		if err = decoder.Decode(&payload); err == nil {
+			n.handleGetData(payload)
+		}
+	case "block":
+		var payload blockMsg
+		if err = decoder.Decode(&payload); err == nil {
+			n.handleBlock(payload)
+		}
+	case "tx":
+		var payload txMsg
+		if err = decoder.Decode(&payload); err == nil {
+			var hash []byte
+			tx, err := DeserializeTransaction(payload.Transaction)
+			if err == nil {
+				hash = tx.ID
+				err = n.handleTx(payload.AddrFrom, tx)
+			}
+			if err != nil {
+				log.Printf("rejected transaction %x: %s\n", hash, err)
+			}
+			reply(conn, replyMsg{Hash: hash}, err)
+		}
+	case "mine":
+		var payload mineMsg
+		if err = decoder.Decode(&payload); err == nil {
+			var hash []byte
+			block, err := n.handleMine(conn, payload)
+			if err == nil {
+				hash = block.Hash
+			}
+			reply(conn, replyMsg{Hash: hash}, err)
+		}
+	case "estimatefee":
+		var payload estimateFeeMsg
+		if err = decoder.Decode(&payload); err == nil {
+			rate, err := n.estimateFee(payload.Blocks)
+			reply(conn, replyMsg{FeeRate: float64(rate)}, err)
+		}
+	case "mempool":
+		var payload mempoolMsg
+		if err = decoder.Decode(&payload); err == nil {
+			txs, err := n.mempoolTransactions()
+			reply(conn, replyMsg{Transactions: txs}, err)
+		}
+	default:
+		log.Printf("unknown command %q\n", command)
+	}
+	if err != nil {
+		log.Printf("unable to decode %s message: %s\n", command, err)
+	}
+}
+
+func reply(conn net.Conn, msg replyMsg, err error) {
+	if err != nil {
+		msg.Error = err.Error()
+	}
+	// peers relaying with sendMessage don't wait for the reply
+	_ = gob.NewEncoder(conn).Encode(msg)
+}
+
+func (n *Node) handleVersion(payload versionMsg) {
+	if payload.Version != PROTOCOL_VERSION {
+		log.Printf("%s speaks protocol version %d, expected %d\n", payload.AddrFrom, payload.Version, PROTOCOL_VERSION)
+		return
+	}
+	n.addPeer(payload.AddrFrom)
+
+	myBestHeight := n.bc.BestHeight()
+	if myBestHeight < payload.BestHeight {
+		n.sendGetBlocks(payload.AddrFrom)
+	} else if myBestHeight > payload.BestHeight {
+		n.sendVersion(payload.AddrFrom)
+	}
+}
+
+func (n *Node) handleGetBlocks(payload getBlocksMsg) {
+	n.sendInv(payload.AddrFrom, "block", n.bc.BlockHashes())
+}
+
+func (n *Node) handleInv(payload invMsg) {
+	n.addPeer(payload.AddrFrom)
+
+	switch payload.Type {
+	case "block":
+		// inventories list the tip first, download from the oldest missing block
+		var missing [][]byte
+		for i := len(payload.Items) - 1; i >= 0; i-- {
+			if !n.bc.HasBlock(payload.Items[i]) {
+				missing = append(missing, payload.Items[i])
+			}
+		}
+		if len(missing) == 0 {
+			return
+		}
+		n.mu.Lock()
+		n.blocksInTransit = missing[1:]
+		n.mu.Unlock()
+		n.sendGetData(payload.AddrFrom, "block", missing[0])
+	case "tx":
+		for _, txID := range payload.Items {
+			if !n.mempool.Has(txID) {
+				n.sendGetData(payload.AddrFrom, "tx", txID)
+			}
+		}
+	}
+}
+
+func (n *Node) handleGetData(payload getDataMsg) {
+	switch payload.Type {
+	case "block":
+		block, err := n.bc.BlockByHash(payload.ID)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		n.sendBlock(payload.AddrFrom, block)
+	case "tx":
+		if tx, ok := n.mempool.Get(payload.ID); ok {
+			n.sendTx(payload.AddrFrom, tx)
+		}
+	}
+}
+
+func (n *Node) handleBlock(payload blockMsg) {
+	block, err := DeserializeBlock(payload.Block)
+	if err != nil {
+		log.Printf("unable to decode block from %s: %s\n", payload.AddrFrom, err)
+		return
+	}
+
+	if n.bc.HasBlock(block.Hash) {
+		return
+	}
+	if len(block.PrevBlockHash) != 0 && !n.bc.HasBlock(block.PrevBlockHash) {
+		// we are missing its ancestors, ask for the sender's whole chain
+		n.sendGetBlocks(payload.AddrFrom)
+		return
+	}
+	n.chainMu.Lock()
+	err = n.bc.ReceiveBlock(block)
+	isTip := bytes.Equal(n.bc.Tip(), block.Hash)
+	n.chainMu.Unlock()
+	if err != nil {
+		log.Printf("rejected block %x from %s: %s\n", block.Hash, payload.AddrFrom, err)
+		return
+	}
+	if isTip {
+		log.Printf("added block %x at height %d\n", block.Hash, block.Height)
+	} else {
+		log.Printf("stored block %x at height %d on a side branch\n", block.Hash, block.Height)
+	}
+
+	n.mu.Lock()
+	var next []byte
+	syncing := len(n.blocksInTransit) > 0
+	if syncing {
+		next = n.blocksInTransit[0]
+		n.blocksInTransit = n.blocksInTransit[1:]
+	}
+	n.mu.Unlock()
+
+	if syncing {
+		n.sendGetData(payload.AddrFrom, "block", next)
+		return
+	}
+	for _, peer := range n.peers(payload.AddrFrom) {
+		n.sendInv(peer, "block", [][]byte{block.Hash})
+	}
+}
+
+func (n *Node) handleTx(addrFrom string, tx *Transaction) error {
+	entry, err := n.mempool.Add(tx, n.bc)
+	if errors.Is(err, ErrMempoolKnown) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("added transaction %x to the mempool, fee rate %.3f\n", tx.ID, entry.FeeRate())
+
+	for _, peer := range n.peers(addrFrom) {
+		n.sendInv(peer, "tx", [][]byte{tx.ID})
+	}
+
+	if n.minerAddress != "" {
+		n.mineInBackground()
+	}
+	return nil
+}
+
+// mineInBackground mines a block from the mempool without keeping the
+// caller waiting. Asking while a block is being mined mines one more block
+// afterwards, so the transactions added meanwhile aren't left behind.
+func (n *Node) mineInBackground() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.mining {
+		n.mineAgain = true
+		return
+	}
+	n.mining = true
+	go func() {
+		for {
+			if _, err := n.mine(n.minerAddress, MAX_BLOCK_TXS); err != nil {
+				log.Println(err)
+			}
+			n.mu.Lock()
+			again := n.mineAgain
+			n.mineAgain = false
+			n.mining = again
+			n.mu.Unlock()
+			if !again {
+				return
+			}
+		}
+	}()
+}
+
+func (n *Node) mempoolTransactions() ([][]byte, error) {
+	var txs [][]byte
+	for _, entry := range n.mempool.Sorted() {
+		bTx, err := entry.Tx.Serialize()
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, bTx)
+	}
+	return txs, nil
+}
+
+func (n *Node) estimateFee(blocks int) (FeeRate, error) {
+	estimator, err := NewFeeEstimator(n.bc, n.mempool)
+	if err != nil {
+		return 0, err
+	}
+	return estimator.EstimateFee(blocks)
+}
+
+func (n *Node) handleMine(conn net.Conn, payload mineMsg) (*Block, error) {
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok || !addr.IP.IsLoopback() {
+		return nil, fmt.Errorf("mining can only be requested from the local machine")
+	}
+	if payload.MaxTxs <= 0 {
+		payload.MaxTxs = MAX_BLOCK_TXS
+	}
+
+	return n.mine(payload.MinerAddress, payload.MaxTxs)
+}
+
+// mine builds a block from the best mempool transactions, mines it on top of
+// the tip and announces it to every peer.
+func (n *Node) mine(minerAddress string, maxTxs int) (*Block, error) {
+	n.chainMu.Lock()
+	defer n.chainMu.Unlock()
+
+	txs, err := n.mempool.BlockTemplate(n.bc, minerAddress, maxTxs)
+	if err != nil {
+		return nil, err
+	}
+	block := n.bc.AddBlock(txs)
+	if block == nil {
+		return nil, fmt.Errorf("unable to mine a block from the mempool")
+	}
+	log.Printf("mined block %x at height %d with %d transactions\n", block.Hash, block.Height, len(block.TXs))
+
+	for _, peer := range n.peers("") {
+		n.sendInv(peer, "block", [][]byte{block.Hash})
+	}
+	return block, nil
+}
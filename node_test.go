@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func freeAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "localhost:0")
+	assert.Nil(t, err)
+	defer ln.Close()
+	return fmt.Sprintf("localhost:%d", ln.Addr().(*net.TCPAddr).Port)
+}
+
+func TestEncodeMessage(t *testing.T) {
+	msg, err := encodeMessage("version", versionMsg{Version: PROTOCOL_VERSION, BestHeight: 7, AddrFrom: "localhost:3000"})
+	assert.Nil(t, err)
+	assert.Equal(t, "version", bytesToCommand(msg[:COMMAND_LENGTH]))
+
+	var payload versionMsg
+	assert.Nil(t, gob.NewDecoder(bytes.NewReader(msg[COMMAND_LENGTH:])).Decode(&payload))
+	assert.Equal(t, 7, payload.BestHeight)
+}
+
+func TestNodeSync(t *testing.T) {
+	useTestGenesisBits(t)
+
+	genesis := mineTestBlock(nil, newTestCoinbase(testAddress("alice"), "genesis", 0, 0))
+	second := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0))
+	seed := newTestBlockchain(t, genesis, second)
+	seedNode := NewNode(freeAddress(t), "", seed, nil)
+	go seedNode.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	bc := OpenBlockchain(filepath.Join(t.TempDir(), "node.db"))
+	defer bc.db.Close()
+	assert.Equal(t, -1, bc.BestHeight())
+	node := NewNode(freeAddress(t), "", bc, []string{seedNode.address})
+	go node.Start()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for bc.BestHeight() < 1 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(t, 1, bc.BestHeight())
+	assert.Equal(t, seed.BlockHashes(), bc.BlockHashes())
+}
+
+func TestNodeMinesMempool(t *testing.T) {
+	bc, alice, split := newTestMempoolChain(t)
+	node := NewNode(freeAddress(t), "", bc, nil)
+	go node.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	tx := newSignedTestTx(alice, split, 0, []TxOutput{{Value: 9}})
+	assert.Nil(t, SendTransaction(node.address, tx))
+	assert.NotNil(t, SendTransaction(node.address, newSignedTestTx(alice, split, 0, []TxOutput{{Value: 8}})))
+	assert.Equal(t, 1, node.mempool.Count())
+	pending, err := RequestMempool(node.address)
+	assert.Nil(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, tx.ID, pending[0].ID)
+
+	hash, err := RequestMining(node.address, testAddress("miner"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, bc.lastBlockHash, hash)
+	assert.Equal(t, 2, bc.BestHeight())
+	assert.Equal(t, 0, node.mempool.Count())
+
+	// two confirmed transactions aren't enough to go by
+	_, err = RequestFeeEstimate(node.address, 1)
+	assert.EqualError(t, err, ErrNoFeeEstimate.Error())
+}
+
+func TestNodeMinesInBackground(t *testing.T) {
+	bc, alice, split := newTestMempoolChain(t)
+	node := NewNode(freeAddress(t), testAddress("miner"), bc, nil)
+	go node.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	for vout := 0; vout < 2; vout++ {
+		tx := newSignedTestTx(alice, split, vout, []TxOutput{{Value: 9}})
+		assert.Nil(t, SendTransaction(node.address, tx))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for node.mempool.Count() > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(t, 0, node.mempool.Count())
+	assert.GreaterOrEqual(t, bc.BestHeight(), 2)
+}
+
+func TestNodeRejectsOversizedMessages(t *testing.T) {
+	bc, _, _ := newTestMempoolChain(t)
+	node := NewNode(freeAddress(t), "", bc, nil)
+	go node.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	msg, err := encodeMessage("tx", txMsg{Transaction: make([]byte, MAX_MESSAGE_SIZE)})
+	assert.Nil(t, err)
+	_, err = requestMessage(node.address, msg)
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, node.mempool.Count())
+}
@@ -14,8 +14,7 @@ type PoorfOfWork struct {
 }
 
 func NewProofOfWork(b *Block) *PoorfOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-TARGET_BITS))
+	target := CompactToBig(b.Bits)
 
 	pow := &PoorfOfWork{
 		block:  b,
@@ -27,28 +26,33 @@ func NewProofOfWork(b *Block) *PoorfOfWork {
 
 func (pow *PoorfOfWork) prepareData(nonce int) []byte {
 	data := bytes.Join([][]byte{
-		pow.block.HashTransactions(),
+		pow.block.MerkleRoot,
 		pow.block.PrevBlockHash,
 		IntToHex(pow.block.Timestamp),
-		IntToHex(int64(TARGET_BITS)),
+		IntToHex(int64(pow.block.Bits)),
 		IntToHex(int64(nonce)),
 	}, []byte{})
 
 	return data
 }
 
+// hash is the header hash of the block with the given nonce.
+func (pow *PoorfOfWork) hash(nonce int) []byte {
+	hash := sha256.Sum256(pow.prepareData(nonce))
+	return hash[:]
+}
+
 // (nonce , hash)
 func (pow *PoorfOfWork) Run() (int, []byte) {
 	var hashInt big.Int
-	var hash [32]byte
+	var hash []byte
 	nonce := 0
 	maxNonce := math.MaxInt64
 
 	fmt.Printf("Mining the block which contains \"%d\" transactions\n", len(pow.block.TXs))
 	for nonce < maxNonce {
-		data := pow.prepareData(nonce)
-		hash = sha256.Sum256(data)
-		hashInt.SetBytes(hash[:])
+		hash = pow.hash(nonce)
+		hashInt.SetBytes(hash)
 		if hashInt.Cmp(pow.target) == -1 {
 			break
 		} else {
@@ -56,14 +60,21 @@ func (pow *PoorfOfWork) Run() (int, []byte) {
 		}
 	}
 	fmt.Println()
-	return nonce, hash[:]
+	return nonce, hash
 }
 
-func (pow *PoorfOfWork) IsValid() bool {
+// IsValid checks that the block carries the bits it should have had at its
+// height and that its hash meets the target those bits encode.
+func (pow *PoorfOfWork) IsValid(expectedBits uint32) bool {
+	if pow.block.Bits != expectedBits {
+		return false
+	}
+	if pow.target.Sign() <= 0 || pow.target.Cmp(powLimit) > 0 {
+		return false
+	}
+
 	var hash big.Int
-	data := pow.prepareData(pow.block.Nonce)
-	rawHash := sha256.Sum256(data)
-	hash.SetBytes(rawHash[:])
+	hash.SetBytes(pow.hash(pow.block.Nonce))
 
 	return hash.Cmp(pow.target) == -1
 }
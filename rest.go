@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// transactions /address/{addr}/history returns without ?count
+	REST_HISTORY_PAGE_SIZE = 50
+	REST_MAX_PAGE_SIZE     = 1000
+)
+
+// HTTPError is an error with the status code it is served with.
+type HTTPError struct {
+	Status  int
+	Message string
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &HTTPError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// ChainTip is the main chain block everything else builds on.
+type ChainTip struct {
+	Hash      string `json:"hash"`
+	Height    int    `json:"height"`
+	Time      int64  `json:"time"`
+	Bits      string `json:"bits"`
+	ChainWork string `json:"chainwork"`
+}
+
+// UTXOInfo is an unspent output and the outpoint spending it refers to.
+type UTXOInfo struct {
+	TxID    string `json:"txid"`
+	Vout    int    `json:"vout"`
+	Value   int    `json:"value"`
+	Address string `json:"address"`
+}
+
+type AddressUTXOs struct {
+	Address string     `json:"address"`
+	Balance int        `json:"balance"`
+	UTXOs   []UTXOInfo `json:"utxos"`
+}
+
+// RESTServer serves read-only JSON views of the chain:
+//
+//	GET /chain/tip
+//	GET /blocks/{hash}
+//	GET /blocks/height/{n}
+//	GET /tx/{id}
+//	GET /address/{addr}/utxos
+//	GET /address/{addr}/history?skip=0&count=50
+//
+// History needs the address index, see reindex -addrindex.
+type RESTServer struct {
+	bc *Blockchain
+}
+
+func NewRESTServer(bc *Blockchain) *RESTServer {
+	return &RESTServer{bc: bc}
+}
+
+func (s *RESTServer) Start(address string) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("REST API is listening on %s\n", address)
+	return server.ListenAndServe()
+}
+
+func (s *RESTServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, &HTTPError{Status: http.StatusMethodNotAllowed, Message: "the API is read-only"})
+		return
+	}
+	// the data is public, let explorer frontends on other origins read it
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	result, err := s.route(r)
+	if err != nil {
+		writeJSONError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *RESTServer) route(r *http.Request) (interface{}, error) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "chain" && parts[1] == "tip":
+		return s.chainTip()
+	case len(parts) == 3 && parts[0] == "blocks" && parts[1] == "height":
+		height, err := strconv.Atoi(parts[2])
+		if err != nil || height < 0 {
+			return nil, badRequest("invalid block height %q", parts[2])
+		}
+		return s.blockByHeight(height)
+	case len(parts) == 2 && parts[0] == "blocks":
+		return s.blockByHash(parts[1])
+	case len(parts) == 2 && parts[0] == "tx":
+		return s.transaction(parts[1])
+	case len(parts) == 3 && parts[0] == "address" && parts[2] == "utxos":
+		return s.addressUTXOs(parts[1])
+	case len(parts) == 3 && parts[0] == "address" && parts[2] == "history":
+		return s.addressHistory(parts[1], r.URL.Query())
+	}
+	return nil, &HTTPError{Status: http.StatusNotFound, Message: fmt.Sprintf("no such resource %s", r.URL.Path)}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println(err)
+	}
+}
+
+// errorStatus is the status code err is served with.
+func errorStatus(err error) int {
+	var httpErr *HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr.Status
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrNoAddrIndex):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSONError(w http.ResponseWriter, err error) {
+	writeJSON(w, errorStatus(err), map[string]string{"error": err.Error()})
+}
+
+func (s *RESTServer) chainTip() (*ChainTip, error) {
+	hash := s.bc.Tip()
+	if hash == nil {
+		return nil, fmt.Errorf("the chain tip is %w, the chain is empty", ErrNotFound)
+	}
+	block, err := s.bc.BlockByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := s.bc.BlockIndex(hash)
+	if err != nil {
+		return nil, err
+	}
+	return &ChainTip{
+		Hash:      hex.EncodeToString(block.Hash),
+		Height:    block.Height,
+		Time:      block.Timestamp,
+		Bits:      fmt.Sprintf("%08x", block.Bits),
+		ChainWork: fmt.Sprintf("%064x", entry.ChainWork),
+	}, nil
+}
+
+func (s *RESTServer) blockByHash(hexHash string) (*BlockInfo, error) {
+	hash, err := hex.DecodeString(hexHash)
+	if err != nil || len(hash) == 0 {
+		return nil, badRequest("invalid block hash %q", hexHash)
+	}
+	block, err := s.bc.BlockByHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	return s.bc.BlockInfo(block)
+}
+
+func (s *RESTServer) blockByHeight(height int) (*BlockInfo, error) {
+	block, err := s.bc.BlockByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	return s.bc.BlockInfo(block)
+}
+
+func (s *RESTServer) transaction(txID string) (*ConfirmedTxInfo, error) {
+	id, err := hex.DecodeString(txID)
+	if err != nil || len(id) == 0 {
+		return nil, badRequest("invalid transaction id %q", txID)
+	}
+	return s.bc.TransactionInfo(id)
+}
+
+func (s *RESTServer) addressUTXOs(address string) (*AddressUTXOs, error) {
+	pubKeyHash, err := AddressPubKeyHash(address)
+	if err != nil {
+		return nil, badRequest("%s", err)
+	}
+	coins, err := NewUTXOSet(s.bc).SpendableCoins(pubKeyHash)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &AddressUTXOs{Address: address, UTXOs: []UTXOInfo{}}
+	for _, coin := range coins {
+		info.Balance += coin.Output.Value
+		info.UTXOs = append(info.UTXOs, UTXOInfo{
+			TxID:    hex.EncodeToString(coin.TxID),
+			Vout:    coin.Vout,
+			Value:   coin.Output.Value,
+			Address: string(pubKeyHashAddress(coin.Output.PubKeyHash)),
+		})
+	}
+	return info, nil
+}
+
+func (s *RESTServer) addressHistory(address string, query map[string][]string) (*AddressHistoryPage, error) {
+	pubKeyHash, err := AddressPubKeyHash(address)
+	if err != nil {
+		return nil, badRequest("%s", err)
+	}
+	skip, err := queryInt(query, "skip", 0)
+	if err != nil {
+		return nil, err
+	}
+	count, err := queryInt(query, "count", REST_HISTORY_PAGE_SIZE)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || count > REST_MAX_PAGE_SIZE {
+		return nil, badRequest("count has to be between 1 and %d", REST_MAX_PAGE_SIZE)
+	}
+
+	history, total, err := s.bc.AddressHistory(pubKeyHash, skip, count)
+	if err != nil {
+		return nil, err
+	}
+	return &AddressHistoryPage{Address: address, Total: total, Skip: skip, Transactions: history}, nil
+}
+
+// queryInt reads a non-negative integer query parameter.
+func queryInt(query map[string][]string, name string, fallback int) (int, error) {
+	values := query[name]
+	if len(values) == 0 || values[0] == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(values[0])
+	if err != nil || n < 0 {
+		return 0, badRequest("invalid %s %q", name, values[0])
+	}
+	return n, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getREST fetches path and decodes the JSON body into v.
+func getREST(t *testing.T, server *httptest.Server, path string, v interface{}) int {
+	resp, err := http.Get(server.URL + path)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(v))
+	return resp.StatusCode
+}
+
+func TestRESTServer(t *testing.T) {
+	bc, alice, split := newTestMempoolChain(t)
+	server := httptest.NewServer(NewRESTServer(bc))
+	defer server.Close()
+	tipHash := hex.EncodeToString(bc.lastBlockHash)
+
+	var tip ChainTip
+	assert.Equal(t, http.StatusOK, getREST(t, server, "/chain/tip", &tip))
+	assert.Equal(t, tipHash, tip.Hash)
+	assert.Equal(t, 1, tip.Height)
+
+	var block BlockInfo
+	assert.Equal(t, http.StatusOK, getREST(t, server, "/blocks/"+tipHash, &block))
+	assert.Equal(t, 2, len(block.Transactions))
+	assert.Equal(t, http.StatusOK, getREST(t, server, "/blocks/height/0", &block))
+	assert.Equal(t, tipHash, block.NextBlockHash)
+
+	var tx ConfirmedTxInfo
+	assert.Equal(t, http.StatusOK, getREST(t, server, "/tx/"+hex.EncodeToString(split.ID), &tx))
+	assert.Equal(t, tipHash, tx.BlockHash)
+	assert.Len(t, tx.Outputs, 3)
+
+	address := string(alice.GetAddress())
+	var utxos AddressUTXOs
+	assert.Equal(t, http.StatusOK, getREST(t, server, "/address/"+address+"/utxos", &utxos))
+	assert.Equal(t, 30, utxos.Balance)
+	assert.Len(t, utxos.UTXOs, 3)
+	assert.Equal(t, hex.EncodeToString(split.ID), utxos.UTXOs[0].TxID)
+
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusNotImplemented, getREST(t, server, "/address/"+address+"/history", &apiErr))
+	_, err := bc.ReindexAddresses()
+	assert.Nil(t, err)
+	var history AddressHistoryPage
+	assert.Equal(t, http.StatusOK, getREST(t, server, "/address/"+address+"/history?skip=1&count=1", &history))
+	assert.Equal(t, 2, history.Total)
+	assert.Len(t, history.Transactions, 1)
+	assert.Equal(t, 30, history.Transactions[0].Balance)
+
+	for _, c := range []struct {
+		path   string
+		status int
+	}{
+		{"/blocks/height/7", http.StatusNotFound},
+		{"/blocks/xyz", http.StatusBadRequest},
+		{"/tx/" + hex.EncodeToString([]byte("nope")), http.StatusNotFound},
+		{"/address/nonsense/utxos", http.StatusBadRequest},
+		{"/address/" + address + "/history?count=-1", http.StatusBadRequest},
+		{"/nowhere", http.StatusNotFound},
+	} {
+		apiErr = nil
+		assert.Equal(t, c.status, getREST(t, server, c.path, &apiErr), c.path)
+		assert.NotEmpty(t, apiErr["error"], c.path)
+	}
+
+	resp, err := http.Post(server.URL+"/chain/tip", "application/json", nil)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
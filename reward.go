@@ -1,5 +1,157 @@
 package main
 
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
 const (
+	// subsidy paid to the miner of the genesis block
 	REWARD = 50
+	// number of blocks after which the subsidy is cut in half, unless the
+	// chain was created with another interval
+	HALVING_INTERVAL = 210
+	// once the subsidy has been halved this many times miners only collect fees
+	MAX_HALVINGS = 32
+	// no output, and no sum of outputs or inputs, may be worth more than this
+	MAX_MONEY = 21000000
+)
+
+type SubsidySchedule struct {
+	InitialReward   int
+	HalvingInterval int
+	MaxHalvings     int
+}
+
+var (
+	// consensus parameters chosen when the chain is created
+	chainParamsBucket  = "chainparams"
+	halvingIntervalKey = []byte("halvinginterval")
+
+	defaultSubsidySchedule = SubsidySchedule{
+		InitialReward:   REWARD,
+		HalvingInterval: HALVING_INTERVAL,
+		MaxHalvings:     MAX_HALVINGS,
+	}
 )
+
+// Subsidy returns the newly minted coins a block at the given height may pay
+// to its miner, on top of the fees of the transactions it includes.
+func (s SubsidySchedule) Subsidy(height int) int {
+	if s.HalvingInterval <= 0 {
+		return s.InitialReward
+	}
+	halvings := height / s.HalvingInterval
+	if halvings >= s.MaxHalvings || halvings >= 63 {
+		return 0
+	}
+
+	return s.InitialReward >> uint(halvings)
+}
+
+// readSubsidySchedule returns the schedule of the chain, the default one for
+// chains created before the halving interval could be chosen.
+func readSubsidySchedule(tx *bolt.Tx) (SubsidySchedule, error) {
+	s := defaultSubsidySchedule
+	b := tx.Bucket([]byte(chainParamsBucket))
+	if b == nil {
+		return s, nil
+	}
+	if v := b.Get(halvingIntervalKey); v != nil {
+		if len(v) != 8 {
+			return s, fmt.Errorf("halving interval %x is malformed", v)
+		}
+		s.HalvingInterval = int(binary.BigEndian.Uint64(v))
+	}
+	return s, nil
+}
+
+func writeHalvingInterval(tx *bolt.Tx, interval int) error {
+	if interval <= 0 {
+		return fmt.Errorf("halving interval must be positive, not %d", interval)
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(chainParamsBucket))
+	if err != nil {
+		return err
+	}
+	return b.Put(halvingIntervalKey, binary.BigEndian.AppendUint64(nil, uint64(interval)))
+}
+
+func (bc *Blockchain) SubsidySchedule() SubsidySchedule {
+	var s SubsidySchedule
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		var err error
+		s, err = readSubsidySchedule(tx)
+		return err
+	})
+	must(err)
+
+	return s
+}
+
+// SetHalvingInterval chooses the halving interval of a chain without blocks,
+// e.g. one a node is about to download from peers that use that interval.
+func (bc *Blockchain) SetHalvingInterval(interval int) error {
+	return bc.db.Update(func(tx *bolt.Tx) error {
+		s, err := readSubsidySchedule(tx)
+		if err != nil {
+			return err
+		}
+		if s.HalvingInterval == interval {
+			return nil
+		}
+		if blocks := tx.Bucket([]byte(blocksBucket)); blocks != nil && blocks.Get([]byte("l")) != nil {
+			return fmt.Errorf("the chain already halves its subsidy every %d blocks", s.HalvingInterval)
+		}
+		return writeHalvingInterval(tx, interval)
+	})
+}
+
+func moneyRange(value int) bool {
+	return value >= 0 && value <= MAX_MONEY
+}
+
+// checkOutputValues makes sure every output of tx and their sum are within
+// the money range and returns the sum. Each addend is in range before it is
+// added, so the sum can't overflow.
+func checkOutputValues(tx *Transaction) (int, error) {
+	total := 0
+	for i, out := range tx.VOut {
+		if !moneyRange(out.Value) {
+			return 0, fmt.Errorf("output %d of transaction %x is worth %d, out of range", i, tx.ID, out.Value)
+		}
+		total += out.Value
+		if !moneyRange(total) {
+			return 0, fmt.Errorf("outputs of transaction %x are worth more than %d", tx.ID, MAX_MONEY)
+		}
+	}
+	return total, nil
+}
+
+// checkCoinbase makes sure the block starts with its only coinbase and that
+// the coinbase doesn't pay out more than the subsidy plus the collected fees.
+func checkCoinbase(block *Block, fees int, schedule SubsidySchedule) error {
+	if len(block.TXs) == 0 || !block.TXs[0].IsCoinBase() {
+		return errors.New("first transaction of the block is not a coinbase")
+	}
+	for _, tx := range block.TXs[1:] {
+		if tx.IsCoinBase() {
+			return fmt.Errorf("block contains more than one coinbase, %x", tx.ID)
+		}
+	}
+
+	paid, err := checkOutputValues(block.TXs[0])
+	if err != nil {
+		return err
+	}
+	allowed := schedule.Subsidy(block.Height) + fees
+	if paid > allowed {
+		return fmt.Errorf("coinbase pays %d but only %d is allowed at height %d", paid, allowed, block.Height)
+	}
+
+	return nil
+}
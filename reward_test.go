@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubsidy(t *testing.T) {
+	schedule := SubsidySchedule{InitialReward: 50, HalvingInterval: 10, MaxHalvings: 3}
+
+	assert.Equal(t, 50, schedule.Subsidy(0))
+	assert.Equal(t, 50, schedule.Subsidy(9))
+	assert.Equal(t, 25, schedule.Subsidy(10))
+	assert.Equal(t, 12, schedule.Subsidy(20))
+	assert.Equal(t, 0, schedule.Subsidy(30))
+	assert.Equal(t, 0, schedule.Subsidy(1000))
+
+	assert.Equal(t, REWARD, defaultSubsidySchedule.Subsidy(0))
+	assert.Equal(t, REWARD/2, defaultSubsidySchedule.Subsidy(HALVING_INTERVAL))
+}
+
+func TestChainHalvingInterval(t *testing.T) {
+	useTestGenesisBits(t)
+	miner := testAddress("miner")
+
+	bc := CreateBlockchain(miner, filepath.Join(t.TempDir(), "BTC"), 2)
+	defer bc.db.Close()
+	assert.Equal(t, 2, bc.SubsidySchedule().HalvingInterval)
+	assert.Nil(t, bc.SetHalvingInterval(2))
+	assert.NotNil(t, bc.SetHalvingInterval(HALVING_INTERVAL))
+
+	genesis, err := bc.BlockByHeight(0)
+	assert.Nil(t, err)
+	first := bc.MineBlock(miner, nil)
+	assert.NotNil(t, first)
+	second := bc.MineBlock(miner, nil)
+	assert.NotNil(t, second)
+	assert.Equal(t, 2, second.Height)
+	assert.Equal(t, REWARD/2, second.TXs[0].VOut[0].Value)
+
+	// a chain without blocks takes the interval of the peers it syncs from
+	empty := OpenBlockchain(filepath.Join(t.TempDir(), "BTC"))
+	defer empty.db.Close()
+	assert.Equal(t, HALVING_INTERVAL, empty.SubsidySchedule().HalvingInterval)
+	assert.NotNil(t, empty.SetHalvingInterval(0))
+	assert.Nil(t, empty.SetHalvingInterval(2))
+	assert.Equal(t, 2, empty.SubsidySchedule().HalvingInterval)
+	for _, block := range []*Block{genesis, first, second} {
+		assert.Nil(t, empty.ReceiveBlock(block))
+	}
+	assert.Equal(t, second.Hash, empty.Tip())
+}
+
+func TestCheckCoinbase(t *testing.T) {
+	height := HALVING_INTERVAL
+	coinbase := newTestCoinbase(testAddress("miner"), "", height, 7)
+	assert.Equal(t, defaultSubsidySchedule.Subsidy(height)+7, coinbase.VOut[0].Value)
+
+	block := &Block{Height: height, TXs: []*Transaction{coinbase}}
+	assert.Nil(t, checkCoinbase(block, 7, defaultSubsidySchedule))
+	assert.NotNil(t, checkCoinbase(block, 6, defaultSubsidySchedule))
+
+	assert.NotNil(t, checkCoinbase(&Block{Height: height, TXs: []*Transaction{}}, 0, defaultSubsidySchedule))
+	second := newTestCoinbase(testAddress("miner"), "", height, 0)
+	assert.NotNil(t, checkCoinbase(&Block{Height: height, TXs: []*Transaction{coinbase, second}}, 7, defaultSubsidySchedule))
+}
@@ -0,0 +1,543 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// JSON-RPC 2.0 error codes, RPC_SERVER_ERROR is for requests that were
+	// understood but failed, like an unknown transaction or too few coins
+	RPC_PARSE_ERROR      = -32700
+	RPC_INVALID_REQUEST  = -32600
+	RPC_METHOD_NOT_FOUND = -32601
+	RPC_INVALID_PARAMS   = -32602
+	RPC_SERVER_ERROR     = -32000
+
+	RPC_MAX_REQUEST_SIZE = 4 << 20
+	// longest walletpassphrase timeout in seconds, Bitcoin Core's limit
+	RPC_MAX_UNLOCK_TIMEOUT = 100000000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+func invalidParams(format string, args ...interface{}) error {
+	return &RPCError{Code: RPC_INVALID_PARAMS, Message: fmt.Sprintf(format, args...)}
+}
+
+// MempoolInfo is what getmempoolinfo returns.
+type MempoolInfo struct {
+	Size  int `json:"size"`
+	Bytes int `json:"bytes"`
+	Fees  int `json:"fees"`
+}
+
+// RPCServer answers JSON-RPC 2.0 requests over HTTP with basic auth. It
+// works on the chain and mempool of a running node and on the wallet file of
+// the node's chain. Params are positional.
+type RPCServer struct {
+	node           *Node
+	blockchainName string
+	user           string
+	password       string
+
+	// serializes loading, changing and saving the wallet file
+	walletMu sync.Mutex
+	// the wallet store outlives requests so walletpassphrase can leave it
+	// unlocked, it's read again once the file changes on disk
+	wallets       *Wallets
+	walletModTime time.Time
+}
+
+func NewRPCServer(node *Node, blockchainName, user, password string) *RPCServer {
+	return &RPCServer{
+		node:           node,
+		blockchainName: blockchainName,
+		user:           user,
+		password:       password,
+	}
+}
+
+// Start serves requests on address, which should be a loopback one.
+func (s *RPCServer) Start(address string) error {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("JSON-RPC server is listening on %s\n", address)
+	return server.ListenAndServe()
+}
+
+func (s *RPCServer) authorized(r *http.Request) bool {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	userOK := subtle.ConstantTimeCompare([]byte(user), []byte(s.user)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+	return userOK && passwordOK
+}
+
+func (s *RPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests have to be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="jsonrpc"`)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, RPC_MAX_REQUEST_SIZE))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var response interface{}
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		response = errorResponse(nil, &RPCError{Code: RPC_PARSE_ERROR, Message: "parse error"})
+	} else if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			response = errorResponse(nil, &RPCError{Code: RPC_INVALID_REQUEST, Message: "invalid request"})
+		} else {
+			var responses []*rpcResponse
+			for _, raw := range batch {
+				if resp := s.handle(raw); resp != nil {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) > 0 {
+				response = responses
+			}
+		}
+	} else if resp := s.handle(body); resp != nil {
+		response = resp
+	}
+
+	// nothing is written back for notifications
+	if response == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Println(err)
+	}
+}
+
+func errorResponse(id json.RawMessage, err *RPCError) *rpcResponse {
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: err}
+}
+
+// handle answers a single request, or returns nil for a notification.
+func (s *RPCServer) handle(raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(nil, &RPCError{Code: RPC_INVALID_REQUEST, Message: "invalid request"})
+	}
+
+	result, err := s.call(req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: RPC_SERVER_ERROR, Message: err.Error()}
+		}
+		return errorResponse(req.ID, rpcErr)
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func (s *RPCServer) call(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "getblockcount":
+		if err := decodeParams(params, 0); err != nil {
+			return nil, err
+		}
+		return s.getBlockCount()
+	case "getblock":
+		var hashOrHeight interface{}
+		if err := decodeParams(params, 1, &hashOrHeight); err != nil {
+			return nil, err
+		}
+		return s.getBlock(hashOrHeight)
+	case "gettransaction":
+		var txID string
+		if err := decodeParams(params, 1, &txID); err != nil {
+			return nil, err
+		}
+		return s.getTransaction(txID)
+	case "getbalance":
+		var address string
+		if err := decodeParams(params, 0, &address); err != nil {
+			return nil, err
+		}
+		return s.getBalance(address)
+	case "sendtoaddress":
+		var from, to, passphrase string
+		var amount int
+		if err := decodeParams(params, 3, &from, &to, &amount, &passphrase); err != nil {
+			return nil, err
+		}
+		return s.sendToAddress(from, to, amount, passphrase)
+	case "getnewaddress":
+		var passphrase string
+		if err := decodeParams(params, 0, &passphrase); err != nil {
+			return nil, err
+		}
+		return s.getNewAddress(passphrase)
+	case "walletpassphrase":
+		var passphrase string
+		var timeout int
+		if err := decodeParams(params, 2, &passphrase, &timeout); err != nil {
+			return nil, err
+		}
+		return s.walletPassphrase(passphrase, timeout)
+	case "walletlock":
+		if err := decodeParams(params, 0); err != nil {
+			return nil, err
+		}
+		return s.walletLock()
+	case "getmempoolinfo":
+		if err := decodeParams(params, 0); err != nil {
+			return nil, err
+		}
+		return s.getMempoolInfo(), nil
+	case "submitblock":
+		var hexBlock string
+		if err := decodeParams(params, 1, &hexBlock); err != nil {
+			return nil, err
+		}
+		return s.submitBlock(hexBlock)
+	}
+	return nil, &RPCError{Code: RPC_METHOD_NOT_FOUND, Message: fmt.Sprintf("method %q not found", method)}
+}
+
+// decodeParams decodes positional params into args, the ones after the
+// first required are optional.
+func decodeParams(params json.RawMessage, required int, args ...interface{}) error {
+	var values []json.RawMessage
+	if len(params) > 0 && !bytes.Equal(params, []byte("null")) {
+		if err := json.Unmarshal(params, &values); err != nil {
+			return invalidParams("params have to be an array")
+		}
+	}
+	if len(values) < required || len(values) > len(args) {
+		return invalidParams("expected %d to %d params, got %d", required, len(args), len(values))
+	}
+	for i, value := range values {
+		if err := json.Unmarshal(value, args[i]); err != nil {
+			return invalidParams("param %d: %s", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *RPCServer) getBlockCount() (int, error) {
+	height := s.node.bc.BestHeight()
+	if height < 0 {
+		return 0, errors.New("the chain is empty")
+	}
+	return height, nil
+}
+
+// getBlock takes a hex encoded hash or a main chain height.
+func (s *RPCServer) getBlock(hashOrHeight interface{}) (*BlockInfo, error) {
+	var block *Block
+	var err error
+	switch v := hashOrHeight.(type) {
+	case string:
+		hash, decodeErr := hex.DecodeString(v)
+		if decodeErr != nil || len(hash) == 0 {
+			return nil, invalidParams("invalid block hash %q", v)
+		}
+		block, err = s.node.bc.BlockByHash(hash)
+	case float64:
+		if v != float64(int(v)) || v < 0 {
+			return nil, invalidParams("invalid block height %v", v)
+		}
+		block, err = s.node.bc.BlockByHeight(int(v))
+	default:
+		return nil, invalidParams("expected a block hash or height")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.node.bc.BlockInfo(block)
+}
+
+func (s *RPCServer) getTransaction(txID string) (*ConfirmedTxInfo, error) {
+	id, err := hex.DecodeString(txID)
+	if err != nil || len(id) == 0 {
+		return nil, invalidParams("invalid transaction id %q", txID)
+	}
+	return s.node.bc.TransactionInfo(id)
+}
+
+// getBalance returns the confirmed balance of address, or of every address
+// of the wallet when it's empty.
+func (s *RPCServer) getBalance(address string) (int, error) {
+	addresses := []string{address}
+	if address == "" {
+		s.walletMu.Lock()
+		wallets, err := s.loadWallets()
+		s.walletMu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		addresses = wallets.GetAddresses()
+	}
+
+	UTXOSet := NewUTXOSet(s.node.bc)
+	balance := 0
+	for _, address := range addresses {
+		pubKeyHash, err := AddressPubKeyHash(address)
+		if err != nil {
+			return 0, invalidParams("%s", err)
+		}
+		for _, out := range UTXOSet.FindUTXOs(pubKeyHash) {
+			balance += out.Value
+		}
+	}
+	return balance, nil
+}
+
+// sendToAddress pays amount from a wallet address to another address at the
+// estimated fee rate and submits the transaction to the node's mempool. It
+// returns the hex encoded transaction id.
+func (s *RPCServer) sendToAddress(from, to string, amount int, passphrase string) (string, error) {
+	for _, address := range []string{from, to} {
+		if err := ValidateAddress(address); err != nil {
+			return "", invalidParams("%s", err)
+		}
+	}
+	if amount <= 0 {
+		return "", invalidParams("amount has to be positive")
+	}
+
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+	wallets, err := s.loadWallets()
+	if err != nil {
+		return "", err
+	}
+	relock, err := unlockForRequest(wallets, passphrase)
+	if err != nil {
+		return "", err
+	}
+	defer relock()
+	wallet, err := wallets.GetWallet(from)
+	if err != nil {
+		return "", err
+	}
+
+	rate, err := s.node.estimateFee(DEFAULT_CONFIRM_TARGET)
+	if err != nil {
+		rate = DEFAULT_FEE_RATE
+	}
+	// coins the mempool already spends would make a conflicting transaction
+	tx, err := NewUTXOTransaction(wallet, to, amount, rate, BranchAndBound{}, NewUTXOSet(s.node.bc), s.node.mempool.SpentOutpoints())
+	if err != nil {
+		return "", err
+	}
+	if err := s.node.handleTx("", tx); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(tx.ID), nil
+}
+
+func (s *RPCServer) getNewAddress(passphrase string) (string, error) {
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+	wallets, err := s.loadWallets()
+	if err != nil {
+		return "", err
+	}
+	relock, err := unlockForRequest(wallets, passphrase)
+	if err != nil {
+		return "", err
+	}
+	defer relock()
+
+	address, err := wallets.CreateWallet()
+	if err != nil {
+		return "", err
+	}
+	return address, s.saveWallets(wallets)
+}
+
+// walletPassphrase unlocks the wallet for timeout seconds, so later requests
+// can sign without a passphrase, and returns the unix time it locks again.
+func (s *RPCServer) walletPassphrase(passphrase string, timeout int) (int64, error) {
+	if timeout <= 0 || timeout > RPC_MAX_UNLOCK_TIMEOUT {
+		return 0, invalidParams("timeout has to be between 1 and %d seconds", RPC_MAX_UNLOCK_TIMEOUT)
+	}
+
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+	wallets, err := s.loadWallets()
+	if err != nil {
+		return 0, err
+	}
+	duration := time.Duration(timeout) * time.Second
+	if err := wallets.Unlock(passphrase, duration); err != nil {
+		return 0, err
+	}
+	return time.Now().Add(duration).Unix(), nil
+}
+
+func (s *RPCServer) walletLock() (bool, error) {
+	s.walletMu.Lock()
+	defer s.walletMu.Unlock()
+	wallets, err := s.loadWallets()
+	if err != nil {
+		return false, err
+	}
+	if !wallets.IsEncrypted() {
+		return false, ErrWalletNotEncrypted
+	}
+	wallets.Lock()
+	return true, nil
+}
+
+// loadWallets returns the wallet store, reading it again if the wallet file
+// changed since, which locks it. The caller holds walletMu.
+func (s *RPCServer) loadWallets() (*Wallets, error) {
+	modTime, err := s.walletFileModTime()
+	if err != nil {
+		return nil, err
+	}
+	if s.wallets != nil && modTime.Equal(s.walletModTime) {
+		return s.wallets, nil
+	}
+
+	wallets, err := NewWallets(s.blockchainName)
+	if err != nil {
+		return nil, err
+	}
+	if s.wallets != nil {
+		s.wallets.Lock()
+	}
+	s.wallets = wallets
+	s.walletModTime = modTime
+	return wallets, nil
+}
+
+// saveWallets saves the store loadWallets returned without it being read
+// again afterwards. The caller holds walletMu.
+func (s *RPCServer) saveWallets(wallets *Wallets) error {
+	if err := wallets.SaveToFile(); err != nil {
+		return err
+	}
+	modTime, err := s.walletFileModTime()
+	if err != nil {
+		return err
+	}
+	s.walletModTime = modTime
+	return nil
+}
+
+// walletFileModTime is the zero time while there is no wallet file.
+func (s *RPCServer) walletFileModTime() (time.Time, error) {
+	info, err := os.Stat(walletFileName(s.blockchainName))
+	if errors.Is(err, os.ErrNotExist) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// unlockForRequest unlocks a locked wallet with passphrase for a single
+// request and returns what locks it again. A wallet walletpassphrase
+// unlocked is left as it is.
+func unlockForRequest(wallets *Wallets, passphrase string) (func(), error) {
+	if !wallets.IsLocked() {
+		return func() {}, nil
+	}
+	if passphrase == "" {
+		return nil, fmt.Errorf("%w, call walletpassphrase or pass the passphrase", ErrWalletLocked)
+	}
+	if err := wallets.Unlock(passphrase, WALLET_UNLOCK_TIMEOUT); err != nil {
+		return nil, err
+	}
+	return wallets.Lock, nil
+}
+
+func (s *RPCServer) getMempoolInfo() *MempoolInfo {
+	info := &MempoolInfo{}
+	for _, entry := range s.node.mempool.Sorted() {
+		info.Size++
+		info.Bytes += entry.Size
+		info.Fees += entry.Fee
+	}
+	return info
+}
+
+// submitBlock receives a block in the binary format of serialize.go, hex
+// encoded, as if a peer sent it and returns its hash.
+func (s *RPCServer) submitBlock(hexBlock string) (string, error) {
+	raw, err := hex.DecodeString(hexBlock)
+	if err != nil {
+		return "", invalidParams("block isn't hex encoded")
+	}
+	block, err := DeserializeBlock(raw)
+	if err != nil {
+		return "", invalidParams("%s", err)
+	}
+	if s.node.bc.HasBlock(block.Hash) {
+		return "", fmt.Errorf("block %x is already known", block.Hash)
+	}
+
+	s.node.chainMu.Lock()
+	err = s.node.bc.ReceiveBlock(block)
+	s.node.chainMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	log.Printf("received block %x at height %d over JSON-RPC\n", block.Hash, block.Height)
+
+	for _, peer := range s.node.peers("") {
+		s.node.sendInv(peer, "block", [][]byte{block.Hash})
+	}
+	return hex.EncodeToString(block.Hash), nil
+}
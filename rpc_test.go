@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRPCServer(t *testing.T) (*httptest.Server, *Node, *Wallet, *Transaction) {
+	bc, alice, split := newTestMempoolChain(t)
+	node := NewNode(freeAddress(t), "", bc, nil)
+
+	name := filepath.Join(t.TempDir(), "rpc")
+	wallets, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.Nil(t, wallets.addWallet(string(alice.GetAddress()), alice, nil))
+	assert.Nil(t, wallets.SaveToFile())
+
+	server := httptest.NewServer(NewRPCServer(node, name, "user", "secret"))
+	t.Cleanup(server.Close)
+	return server, node, alice, split
+}
+
+func postRPC(t *testing.T, url, body string) (int, string) {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	assert.Nil(t, err)
+	req.SetBasicAuth("user", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+
+	out, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp.StatusCode, string(out)
+}
+
+// callRPC makes a request with id 1 and decodes the response.
+func callRPC(t *testing.T, url, method string, params ...interface{}) (json.RawMessage, *RPCError) {
+	body, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	assert.Nil(t, err)
+	status, raw := postRPC(t, url, string(body))
+	assert.Equal(t, http.StatusOK, status)
+
+	var resp struct {
+		ID     int             `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	assert.Nil(t, json.Unmarshal([]byte(raw), &resp))
+	assert.Equal(t, 1, resp.ID)
+	return resp.Result, resp.Error
+}
+
+func TestRPCAuth(t *testing.T) {
+	server, _, _, _ := newTestRPCServer(t)
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"getblockcount"}`))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = http.Get(server.URL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestRPCProtocol(t *testing.T) {
+	server, _, _, _ := newTestRPCServer(t)
+
+	_, body := postRPC(t, server.URL, `{"jsonrpc":"2.0","id":1,"method":`)
+	assert.Contains(t, body, `"code":-32700`)
+	_, body = postRPC(t, server.URL, `{"id":1,"method":"getblockcount"}`)
+	assert.Contains(t, body, `"code":-32600`)
+
+	_, rpcErr := callRPC(t, server.URL, "nosuchmethod")
+	assert.Equal(t, RPC_METHOD_NOT_FOUND, rpcErr.Code)
+	_, rpcErr = callRPC(t, server.URL, "getblockcount", 1)
+	assert.Equal(t, RPC_INVALID_PARAMS, rpcErr.Code)
+	_, rpcErr = callRPC(t, server.URL, "gettransaction", "00")
+	assert.Equal(t, RPC_SERVER_ERROR, rpcErr.Code)
+
+	// notifications get no response, batches one per request
+	status, _ := postRPC(t, server.URL, `{"jsonrpc":"2.0","method":"getblockcount"}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	_, body = postRPC(t, server.URL, `[{"jsonrpc":"2.0","id":1,"method":"getblockcount"},{"jsonrpc":"2.0","method":"getblockcount"},{"jsonrpc":"2.0","id":"b","method":"getblock","params":[0]}]`)
+	var batch []rpcResponse
+	assert.Nil(t, json.Unmarshal([]byte(body), &batch))
+	assert.Len(t, batch, 2)
+	assert.Equal(t, json.RawMessage(`"b"`), batch[1].ID)
+}
+
+func TestRPCChainMethods(t *testing.T) {
+	server, node, _, split := newTestRPCServer(t)
+
+	result, rpcErr := callRPC(t, server.URL, "getblockcount")
+	assert.Nil(t, rpcErr)
+	assert.Equal(t, "1", string(result))
+
+	tipHash := hex.EncodeToString(node.bc.lastBlockHash)
+	for _, param := range []interface{}{1, tipHash} {
+		result, rpcErr = callRPC(t, server.URL, "getblock", param)
+		assert.Nil(t, rpcErr)
+		var info BlockInfo
+		assert.Nil(t, json.Unmarshal(result, &info))
+		assert.Equal(t, tipHash, info.Hash)
+	}
+
+	result, rpcErr = callRPC(t, server.URL, "gettransaction", hex.EncodeToString(split.ID))
+	assert.Nil(t, rpcErr)
+	var txInfo ConfirmedTxInfo
+	assert.Nil(t, json.Unmarshal(result, &txInfo))
+	assert.Equal(t, 1, txInfo.Height)
+
+	tip, err := node.bc.BlockByHash(node.bc.lastBlockHash)
+	assert.Nil(t, err)
+	block := mineTestBlock(tip, newTestCoinbase(testAddress("miner"), "", 2, 0))
+	raw, err := block.Serialize()
+	assert.Nil(t, err)
+	result, rpcErr = callRPC(t, server.URL, "submitblock", hex.EncodeToString(raw))
+	assert.Nil(t, rpcErr)
+	assert.Equal(t, `"`+hex.EncodeToString(block.Hash)+`"`, string(result))
+	assert.Equal(t, 2, node.bc.BestHeight())
+	_, rpcErr = callRPC(t, server.URL, "submitblock", hex.EncodeToString(raw))
+	assert.NotNil(t, rpcErr)
+}
+
+func TestRPCWalletMethods(t *testing.T) {
+	server, node, alice, _ := newTestRPCServer(t)
+
+	result, rpcErr := callRPC(t, server.URL, "getbalance")
+	assert.Nil(t, rpcErr)
+	assert.Equal(t, "30", string(result))
+
+	result, rpcErr = callRPC(t, server.URL, "getnewaddress")
+	assert.Nil(t, rpcErr)
+	var bob string
+	assert.Nil(t, json.Unmarshal(result, &bob))
+	assert.Nil(t, ValidateAddress(bob))
+
+	result, rpcErr = callRPC(t, server.URL, "sendtoaddress", string(alice.GetAddress()), bob, 5)
+	assert.Nil(t, rpcErr)
+	var txID string
+	assert.Nil(t, json.Unmarshal(result, &txID))
+	id, err := hex.DecodeString(txID)
+	assert.Nil(t, err)
+	assert.True(t, node.mempool.Has(id))
+
+	// the coin the first payment spends is left for the mempool
+	_, rpcErr = callRPC(t, server.URL, "sendtoaddress", string(alice.GetAddress()), bob, 5)
+	assert.Nil(t, rpcErr)
+
+	result, rpcErr = callRPC(t, server.URL, "getmempoolinfo")
+	assert.Nil(t, rpcErr)
+	var info MempoolInfo
+	assert.Nil(t, json.Unmarshal(result, &info))
+	assert.Equal(t, 2, info.Size)
+	assert.True(t, info.Fees > 0)
+
+	_, rpcErr = callRPC(t, server.URL, "sendtoaddress", string(alice.GetAddress()), bob, 0)
+	assert.Equal(t, RPC_INVALID_PARAMS, rpcErr.Code)
+	_, rpcErr = callRPC(t, server.URL, "getbalance", "nonsense")
+	assert.Equal(t, RPC_INVALID_PARAMS, rpcErr.Code)
+}
+
+func TestRPCWalletPassphrase(t *testing.T) {
+	bc, alice, _ := newTestMempoolChain(t)
+	node := NewNode(freeAddress(t), "", bc, nil)
+	name := filepath.Join(t.TempDir(), "rpc")
+	wallets, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.Nil(t, wallets.addWallet(string(alice.GetAddress()), alice, nil))
+	assert.Nil(t, wallets.EncryptWallet("secret"))
+	assert.Nil(t, wallets.SaveToFile())
+	server := httptest.NewServer(NewRPCServer(node, name, "user", "secret"))
+	t.Cleanup(server.Close)
+
+	_, rpcErr := callRPC(t, server.URL, "getnewaddress")
+	assert.Contains(t, rpcErr.Message, "walletpassphrase")
+	_, rpcErr = callRPC(t, server.URL, "walletpassphrase", "wrong", 60)
+	assert.Equal(t, ErrWrongPassphrase.Error(), rpcErr.Message)
+	_, rpcErr = callRPC(t, server.URL, "walletpassphrase", "secret", 0)
+	assert.Equal(t, RPC_INVALID_PARAMS, rpcErr.Code)
+
+	result, rpcErr := callRPC(t, server.URL, "walletpassphrase", "secret", 60)
+	assert.Nil(t, rpcErr)
+	var until int64
+	assert.Nil(t, json.Unmarshal(result, &until))
+	assert.True(t, until > time.Now().Unix())
+
+	// saving the new address doesn't lock the wallet
+	result, rpcErr = callRPC(t, server.URL, "getnewaddress")
+	assert.Nil(t, rpcErr)
+	var bob string
+	assert.Nil(t, json.Unmarshal(result, &bob))
+	_, rpcErr = callRPC(t, server.URL, "sendtoaddress", string(alice.GetAddress()), bob, 5)
+	assert.Nil(t, rpcErr)
+
+	_, rpcErr = callRPC(t, server.URL, "walletlock")
+	assert.Nil(t, rpcErr)
+	_, rpcErr = callRPC(t, server.URL, "sendtoaddress", string(alice.GetAddress()), bob, 5)
+	assert.Contains(t, rpcErr.Message, ErrWalletLocked.Error())
+
+	// a passphrase unlocks the wallet for that request only
+	_, rpcErr = callRPC(t, server.URL, "sendtoaddress", string(alice.GetAddress()), bob, 5, "secret")
+	assert.Nil(t, rpcErr)
+	_, rpcErr = callRPC(t, server.URL, "getnewaddress")
+	assert.NotNil(t, rpcErr)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Blocks, transactions and UTXO entries are stored and sent in a versioned
+// binary format. Every encoding starts with its format version byte, numbers
+// are fixed size little endian, counts and byte strings are prefixed with
+// their length as a minimal unsigned varint. The same value always encodes
+// to the same bytes, so hashes can be computed over the encoding.
+//
+//	Block       version u8 | Timestamp i64 | PrevBlockHash bytes | Hash bytes |
+//	            Version f64 | Nonce i64 | Height i64 | Bits u32 |
+//	            MerkleRoot bytes | count varint | Transaction bytes...
+//	Transaction version u8 | ID bytes | count varint | TxInput... |
+//	            count varint | TxOutput...
+//	TxInput     Txid bytes | Vout i64 | Signature bytes | PubKey bytes
+//	TxOutput    Value i64 | PubKeyHash bytes
+//	TxOutputs   version u8 | count varint | (index varint | TxOutput)...
+//	            sorted by index
+const (
+	SERIALIZATION_VERSION = 1
+)
+
+var (
+	ErrSerialization = errors.New("malformed encoding")
+)
+
+type serialWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *serialWriter) writeUint8(v uint8) {
+	w.buf.WriteByte(v)
+}
+
+func (w *serialWriter) writeUint32(v uint32) {
+	w.buf.Write(binary.LittleEndian.AppendUint32(nil, v))
+}
+
+func (w *serialWriter) writeInt64(v int64) {
+	w.buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+}
+
+func (w *serialWriter) writeFloat64(v float64) {
+	w.buf.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(v)))
+}
+
+func (w *serialWriter) writeVarInt(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *serialWriter) writeBytes(b []byte) {
+	w.writeVarInt(uint64(len(b)))
+	w.buf.Write(b)
+}
+
+func (w *serialWriter) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+// serialReader keeps the first error, so a decoder can read every field and
+// check err once at the end.
+type serialReader struct {
+	data []byte
+	err  error
+}
+
+func (r *serialReader) fail(format string, args ...interface{}) {
+	if r.err == nil {
+		r.err = fmt.Errorf("%w: %s", ErrSerialization, fmt.Sprintf(format, args...))
+	}
+}
+
+func (r *serialReader) next(n int, field string) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.fail("%s needs %d bytes, %d left", field, n, len(r.data))
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *serialReader) readUint8(field string) uint8 {
+	b := r.next(1, field)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *serialReader) readUint32(field string) uint32 {
+	b := r.next(4, field)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (r *serialReader) readInt64(field string) int64 {
+	b := r.next(8, field)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.LittleEndian.Uint64(b))
+}
+
+func (r *serialReader) readFloat64(field string) float64 {
+	b := r.next(8, field)
+	if b == nil {
+		return 0
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b))
+}
+
+// readVarInt rejects varints that aren't minimally encoded, which would
+// give a second encoding of the same value.
+func (r *serialReader) readVarInt(field string) uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.fail("%s is not a valid varint", field)
+		return 0
+	}
+	if n != len(binary.AppendUvarint(nil, v)) {
+		r.fail("%s is not minimally encoded", field)
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// readCount reads a length that must fit in the remaining data, assuming
+// every item takes at least minSize bytes.
+func (r *serialReader) readCount(field string, minSize int) int {
+	n := r.readVarInt(field)
+	if r.err == nil && n > uint64(len(r.data)/minSize) {
+		r.fail("%s of %d doesn't fit in %d bytes", field, n, len(r.data))
+		return 0
+	}
+	return int(n)
+}
+
+// readBytes decodes an empty byte string as nil, like gob did.
+func (r *serialReader) readBytes(field string) []byte {
+	n := r.readCount(field, 1)
+	b := r.next(n, field)
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func (r *serialReader) readVersion(what string) {
+	if version := r.readUint8(what + " version"); r.err == nil && version != SERIALIZATION_VERSION {
+		r.fail("%s has unsupported format version %d", what, version)
+	}
+}
+
+// finish fails if bytes are left over, every value has a single encoding.
+func (r *serialReader) finish(what string) error {
+	if r.err == nil && len(r.data) > 0 {
+		r.fail("%d trailing bytes after %s", len(r.data), what)
+	}
+	return r.err
+}
+
+func (b *Block) encode(w *serialWriter) {
+	w.writeUint8(SERIALIZATION_VERSION)
+	w.writeInt64(b.Timestamp)
+	w.writeBytes(b.PrevBlockHash)
+	w.writeBytes(b.Hash)
+	w.writeFloat64(b.Version)
+	w.writeInt64(int64(b.Nonce))
+	w.writeInt64(int64(b.Height))
+	w.writeUint32(b.Bits)
+	w.writeBytes(b.MerkleRoot)
+	w.writeVarInt(uint64(len(b.TXs)))
+	for _, tx := range b.TXs {
+		txw := &serialWriter{}
+		tx.encode(txw)
+		w.writeBytes(txw.Bytes())
+	}
+}
+
+func decodeBlock(r *serialReader) *Block {
+	r.readVersion("block")
+	block := &Block{
+		Timestamp:     r.readInt64("timestamp"),
+		PrevBlockHash: r.readBytes("previous block hash"),
+		Hash:          r.readBytes("hash"),
+		Version:       r.readFloat64("version"),
+		Nonce:         int(r.readInt64("nonce")),
+		Height:        int(r.readInt64("height")),
+		Bits:          r.readUint32("bits"),
+		MerkleRoot:    r.readBytes("merkle root"),
+	}
+	count := r.readCount("transaction count", 1)
+	block.TXs = make([]*Transaction, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		txr := &serialReader{data: r.readBytes("transaction")}
+		tx := decodeTransaction(txr)
+		if err := txr.finish("transaction"); err != nil {
+			r.err = err
+			break
+		}
+		block.TXs = append(block.TXs, tx)
+	}
+	return block
+}
+
+func (tx *Transaction) encode(w *serialWriter) {
+	w.writeUint8(SERIALIZATION_VERSION)
+	w.writeBytes(tx.ID)
+	w.writeVarInt(uint64(len(tx.VIn)))
+	for _, in := range tx.VIn {
+		w.writeBytes(in.Txid)
+		w.writeInt64(int64(in.Vout))
+		w.writeBytes(in.Signature)
+		w.writeBytes(in.PubKey)
+	}
+	w.writeVarInt(uint64(len(tx.VOut)))
+	for _, out := range tx.VOut {
+		out.encode(w)
+	}
+}
+
+func decodeTransaction(r *serialReader) *Transaction {
+	r.readVersion("transaction")
+	tx := &Transaction{ID: r.readBytes("transaction id")}
+
+	// an input takes at least 11 bytes, an output 9
+	count := r.readCount("input count", 11)
+	tx.VIn = make([]TxInput, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		tx.VIn = append(tx.VIn, TxInput{
+			Txid:      r.readBytes("input txid"),
+			Vout:      int(r.readInt64("input vout")),
+			Signature: r.readBytes("input signature"),
+			PubKey:    r.readBytes("input public key"),
+		})
+	}
+	count = r.readCount("output count", 9)
+	tx.VOut = make([]TxOutput, 0, count)
+	for i := 0; i < count && r.err == nil; i++ {
+		tx.VOut = append(tx.VOut, decodeTxOutput(r))
+	}
+	return tx
+}
+
+func (out *TxOutput) encode(w *serialWriter) {
+	w.writeInt64(int64(out.Value))
+	w.writeBytes(out.PubKeyHash)
+}
+
+func decodeTxOutput(r *serialReader) TxOutput {
+	return TxOutput{
+		Value:      int(r.readInt64("output value")),
+		PubKeyHash: r.readBytes("output public key hash"),
+	}
+}
+
+func (outs TxOutputs) encode(w *serialWriter) {
+	indexes := make([]int, 0, len(outs.Outputs))
+	for index := range outs.Outputs {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	w.writeUint8(SERIALIZATION_VERSION)
+	w.writeVarInt(uint64(len(indexes)))
+	for _, index := range indexes {
+		out := outs.Outputs[index]
+		w.writeVarInt(uint64(index))
+		out.encode(w)
+	}
+}
+
+func decodeTxOutputs(r *serialReader) TxOutputs {
+	r.readVersion("outputs")
+	count := r.readCount("output count", 10)
+	outs := TxOutputs{Outputs: make(map[int]TxOutput, count)}
+	last := -1
+	for i := 0; i < count && r.err == nil; i++ {
+		index := r.readVarInt("output index")
+		if r.err == nil && (index > math.MaxInt32 || int(index) <= last) {
+			r.fail("output index %d is out of order", index)
+			break
+		}
+		last = int(index)
+		outs.Outputs[last] = decodeTxOutput(r)
+	}
+	return outs
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestSerializeBlock() *Block {
+	coinbase := newTestCoinbase(testAddress("miner"), "", 1, 0)
+	spend := newTestTx(
+		[]TxInput{{Txid: coinbase.ID, Vout: 0, Signature: []byte("sig"), PubKey: []byte("alice")}},
+		[]TxOutput{{Value: 20, PubKeyHash: testPubKeyHash("bob")}, {Value: 30, PubKeyHash: testPubKeyHash("alice")}},
+	)
+	block := &Block{
+		Timestamp:     1700000000,
+		PrevBlockHash: []byte("prev"),
+		Hash:          []byte("hash"),
+		Version:       VERSION,
+		Nonce:         42,
+		Height:        1,
+		Bits:          testBits,
+		TXs:           []*Transaction{coinbase, spend},
+	}
+	block.MerkleRoot = block.HashTransactions()
+	return block
+}
+
+func TestSerializeRoundTrip(t *testing.T) {
+	block := newTestSerializeBlock()
+
+	bBlock, err := block.Serialize()
+	assert.Nil(t, err)
+	decoded, err := DeserializeBlock(bBlock)
+	assert.Nil(t, err)
+	// empty byte strings come back as nil, compare the encodings instead
+	again, err := decoded.Serialize()
+	assert.Nil(t, err)
+	assert.Equal(t, bBlock, again)
+	assert.Equal(t, block.TXs[1], decoded.TXs[1])
+
+	bTx, err := block.TXs[1].Serialize()
+	assert.Nil(t, err)
+	tx, err := DeserializeTransaction(bTx)
+	assert.Nil(t, err)
+	assert.Equal(t, block.TXs[1], tx)
+
+	outs := TxOutputs{Outputs: map[int]TxOutput{3: tx.VOut[0], 0: tx.VOut[1]}}
+	bOuts, err := outs.Serialize()
+	assert.Nil(t, err)
+	decodedOuts, err := DeserializeOutputs(bOuts)
+	assert.Nil(t, err)
+	assert.Equal(t, outs, decodedOuts)
+}
+
+func TestSerializeIsDeterministic(t *testing.T) {
+	tx := &Transaction{
+		ID:   []byte{0xab},
+		VIn:  []TxInput{{Txid: []byte{0x01, 0x02}, Vout: 1, Signature: []byte{}, PubKey: []byte{0xff}}},
+		VOut: []TxOutput{{Value: 300, PubKeyHash: []byte{0x0a}}},
+	}
+	bTx, err := tx.Serialize()
+	assert.Nil(t, err)
+	assert.Equal(t, "01"+"01ab"+"01"+"020102"+"0100000000000000"+"00"+"01ff"+"01"+"2c01000000000000"+"010a", hex.EncodeToString(bTx))
+
+	// map iteration order must not leak into the encoding
+	outs := TxOutputs{Outputs: map[int]TxOutput{}}
+	for i := 0; i < 20; i++ {
+		outs.Outputs[i] = TxOutput{Value: i}
+	}
+	first, _ := outs.Serialize()
+	for i := 0; i < 10; i++ {
+		again, _ := outs.Serialize()
+		assert.Equal(t, first, again)
+	}
+}
+
+func TestDeserializeRejectsMalformed(t *testing.T) {
+	bBlock, err := newTestSerializeBlock().Serialize()
+	assert.Nil(t, err)
+
+	for name, data := range map[string][]byte{
+		"empty":     {},
+		"truncated": bBlock[:len(bBlock)-1],
+		"trailing":  append(append([]byte{}, bBlock...), 0),
+		"version":   append([]byte{2}, bBlock[1:]...),
+	} {
+		_, err := DeserializeBlock(data)
+		assert.True(t, errors.Is(err, ErrSerialization), name)
+	}
+
+	// a length of 1 encoded in two bytes
+	_, err = DeserializeTransaction([]byte{1, 0x81, 0x00, 0xab, 0, 0})
+	assert.True(t, errors.Is(err, ErrSerialization))
+	// a huge count doesn't allocate before failing
+	_, err = DeserializeTransaction([]byte{1, 0, 0xff, 0xff, 0xff, 0xff, 0x0f})
+	assert.True(t, errors.Is(err, ErrSerialization))
+	// output indexes must be increasing
+	_, err = DeserializeOutputs([]byte{1, 2, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	assert.True(t, errors.Is(err, ErrSerialization))
+}
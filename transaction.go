@@ -5,10 +5,8 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"log"
 	"math/big"
 )
 
@@ -30,72 +28,97 @@ type TxOutput struct {
 	PubKeyHash []byte
 }
 
-func NewCoinbaseTx(to, data string) *Transaction {
+// NewCoinbaseTx pays reward, the block subsidy at height plus the fees
+// collected from the block's other transactions, to the miner. The height is
+// part of the input so coinbases of different blocks never share an ID.
+func NewCoinbaseTx(to, data string, height, reward int) (*Transaction, error) {
 	if data == "" {
 		data = fmt.Sprintf("Reward to %s", to)
 	}
 	txin := TxInput{
 		Txid:   []byte{},
 		Vout:   -1,
-		PubKey: []byte{},
+		PubKey: []byte(fmt.Sprintf("%d %s", height, data)),
 	}
-	txout := TxOutput{
-		Value:      REWARD,
-		PubKeyHash: []byte{},
+	txout, err := NewTxOutput(reward, to)
+	if err != nil {
+		return nil, err
 	}
-	return &Transaction{
+	tx := &Transaction{
 		ID:   nil,
 		VIn:  []TxInput{txin},
-		VOut: []TxOutput{txout},
+		VOut: []TxOutput{*txout},
 	}
+	tx.SetID()
+
+	return tx, nil
 }
 
-func (txin *TxInput) CanUnlockOutput(unlockScript []byte) bool {
-	return bytes.Compare(txin.PubKey, unlockScript) == 0
+func (tx Transaction) Serialize() ([]byte, error) {
+	w := &serialWriter{}
+	tx.encode(w)
+
+	return w.Bytes(), nil
 }
 
-func (txout *TxOutput) CanBeUnlockedWith(unlockScript []byte) bool {
-	return bytes.Compare(txout.PubKeyHash, unlockScript) == 0
+func DeserializeTransaction(d []byte) (*Transaction, error) {
+	r := &serialReader{data: d}
+	tx := decodeTransaction(r)
+	if err := r.finish("transaction"); err != nil {
+		return nil, err
+	}
+	return tx, nil
 }
 
 func (tx *Transaction) IsCoinBase() bool {
-	return len(tx.VIn) == 0
+	return len(tx.VIn) == 1 && len(tx.VIn[0].Txid) == 0 && tx.VIn[0].Vout == -1
 }
 
-func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *Transaction {
+// NewUTXOTransaction builds a transaction paying amount from the wallet's
+// address to another address and signs it with the wallet's key. selector
+// picks the coins paying amount and the fee, the change goes back to the
+// wallet's address. Coins whose outpoint is in exclude, e.g. the ones
+// mempool transactions already spend, aren't picked.
+func NewUTXOTransaction(wallet *Wallet, to string, amount int, fees FeePolicy, selector CoinSelector, UTXOSet *UTXOSet, exclude map[string]bool) (*Transaction, error) {
 	var inputs []TxInput
 	var outputs []TxOutput
 
-	accu, validTxs := bc.FindSpendableUTXOs(from, amount)
-
-	if accu < amount {
-		log.Panic("ERROR: Not enough balance")
+	if err := ValidateAddress(to); err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, fmt.Errorf("amount must be positive, not %d", amount)
+	}
+	from := string(wallet.GetAddress())
+	coins, err := UTXOSet.SpendableCoins(HashPubKey(wallet.PublicKey))
+	if err != nil {
+		return nil, err
+	}
+	coins = excludeCoins(coins, exclude)
+	selection, err := selector.Select(coins, amount, fees)
+	if err != nil {
+		return nil, err
 	}
 
-	for txID, tx := range validTxs {
-		id, err := hex.DecodeString(txID)
-		if err != nil {
-			log.Panic("ERRRO: unable to decode transaction id")
-		}
-		for _, outIdx := range tx {
-			inputs = append(inputs, TxInput{
-				Txid:   id,
-				Vout:   outIdx,
-				PubKey: []byte{},
-			})
-		}
+	for _, coin := range selection.Coins {
+		inputs = append(inputs, TxInput{
+			Txid:   coin.TxID,
+			Vout:   coin.Vout,
+			PubKey: wallet.PublicKey,
+		})
 	}
 
-	outTo := TxOutput{
-		Value:      amount,
-		PubKeyHash: []byte{},
+	out, err := NewTxOutput(amount, to)
+	if err != nil {
+		return nil, err
 	}
-	outputs = append(outputs, outTo)
-	if accu > amount {
-		outputs = append(outputs, TxOutput{
-			Value:      accu - amount,
-			PubKeyHash: []byte{},
-		})
+	outputs = append(outputs, *out)
+	if selection.Change > 0 {
+		change, err := NewTxOutput(selection.Change, from)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, *change)
 	}
 
 	tx := Transaction{
@@ -105,32 +128,30 @@ func NewUTXOTransaction(from, to string, amount int, bc *Blockchain) *Transactio
 	}
 
 	tx.SetID()
+	if err := UTXOSet.bc.SignTransaction(&tx, wallet.PrivateKey); err != nil {
+		return nil, err
+	}
 
-	return &tx
+	return &tx, nil
 }
 
-func (tx *Transaction) SetID() {
-	var inOut [][]byte
-	for _, in := range tx.VIn {
-		inb := bytes.Join([][]byte{
-			in.Txid,
-			IntToHex(in.Vout),
-			[]byte(in.PubKey),
-		}, []byte{})
-		inOut = append(inOut, inb)
-	}
-	for _, out := range tx.VOut {
-		outb := bytes.Join([][]byte{
-			IntToHex(out.Value),
-			[]byte(out.PubKeyHash),
-		}, []byte{})
-		inOut = append(inOut, outb)
+// Hash is the double SHA-256 of the transaction's serialization without its
+// ID and signatures. It is the transaction's ID, and with the public key of
+// an input replaced by the key hash of the output it spends, the preimage
+// that input's signature signs. Leaving signatures out means signing doesn't
+// change the ID the inputs were signed with.
+func (tx Transaction) Hash() []byte {
+	txCopy := Transaction{VOut: tx.VOut}
+	for _, vin := range tx.VIn {
+		txCopy.VIn = append(txCopy.VIn, TxInput{Txid: vin.Txid, Vout: vin.Vout, PubKey: vin.PubKey})
 	}
-	data := bytes.Join(inOut, []byte{})
+	bTx, _ := txCopy.Serialize()
 
-	hash := sha256.Sum256(data)
+	return doubleSHA256(bTx)
+}
 
-	tx.ID = hash[:]
+func (tx *Transaction) SetID() {
+	tx.ID = tx.Hash()
 }
 
 func (txin *TxInput) UsesKey(pubKeyHash []byte) bool {
@@ -139,16 +160,29 @@ func (txin *TxInput) UsesKey(pubKeyHash []byte) bool {
 	return bytes.Compare(lockingHash, pubKeyHash) == 0
 }
 
-func (txout *TxOutput) Lock(address []byte) {
-	pubKeyHash := Base58Decode(address)
-	pubKeyHash = pubKeyHash[1 : len(pubKeyHash)-8]
+// Lock makes the output spendable only by the owner of address.
+func (txout *TxOutput) Lock(address []byte) error {
+	pubKeyHash, err := AddressPubKeyHash(string(address))
+	if err != nil {
+		return err
+	}
 	txout.PubKeyHash = pubKeyHash
+	return nil
 }
 
 func (txout *TxOutput) IsLockedWith(pubKeyHash []byte) bool {
 	return bytes.Compare(pubKeyHash, txout.PubKeyHash) == 0
 }
 
+func NewTxOutput(value int, address string) (*TxOutput, error) {
+	txout := &TxOutput{Value: value}
+	if err := txout.Lock([]byte(address)); err != nil {
+		return nil, err
+	}
+
+	return txout, nil
+}
+
 func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transaction) {
 	if tx.IsCoinBase() {
 		return
@@ -164,7 +198,11 @@ func (tx *Transaction) Sign(privKey ecdsa.PrivateKey, prevTXs map[string]Transac
 		txCopy.VIn[inID].PubKey = nil
 
 		r, s, _ := ecdsa.Sign(rand.Reader, &privKey, txCopy.ID)
-		signature := append(r.Bytes(), s.Bytes()...)
+		// pad both halves so Verify can split the signature in the middle
+		size := (privKey.Curve.Params().BitSize + 7) / 8
+		signature := make([]byte, 2*size)
+		r.FillBytes(signature[:size])
+		s.FillBytes(signature[size:])
 
 		tx.VIn[inID].Signature = signature
 	}
@@ -187,11 +225,21 @@ func (tx *Transaction) TrimmedCopy() Transaction {
 	return txCopy
 }
 func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
+	if tx.IsCoinBase() {
+		return true
+	}
+
 	txCopy := tx.TrimmedCopy()
 	curve := elliptic.P256()
 
 	for inID, vin := range tx.VIn {
-		prevTx := prevTXs[hex.EncodeToString(vin.Txid)]
+		prevTx, ok := prevTXs[hex.EncodeToString(vin.Txid)]
+		if !ok || vin.Vout < 0 || vin.Vout >= len(prevTx.VOut) {
+			return false
+		}
+		if !vin.UsesKey(prevTx.VOut[vin.Vout].PubKeyHash) {
+			return false
+		}
 		txCopy.VIn[inID].Signature = nil
 		txCopy.VIn[inID].PubKey = prevTx.VOut[vin.Vout].PubKeyHash
 		txCopy.ID = txCopy.Hash()
@@ -209,7 +257,7 @@ func (tx *Transaction) Verify(prevTXs map[string]Transaction) bool {
 		x.SetBytes(vin.PubKey[:(keyLen / 2)])
 		y.SetBytes(vin.PubKey[(keyLen / 2):])
 
-		rawPubKey := ecdsa.PublicKey{curve, &x, &y}
+		rawPubKey := ecdsa.PublicKey{Curve: curve, X: &x, Y: &y}
 		if ecdsa.Verify(&rawPubKey, txCopy.ID, &r, &s) == false {
 			return false
 		}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewUTXOTransaction(t *testing.T) {
+	alice := NewWallet()
+	aliceHash := HashPubKey(alice.PublicKey)
+	bob := NewWallet()
+	bobHash := HashPubKey(bob.PublicKey)
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	assert.Equal(t, aliceHash, coinbase.VOut[0].PubKeyHash)
+	genesis := &Block{Hash: []byte("genesis"), PrevBlockHash: []byte{}, TXs: []*Transaction{coinbase}}
+	bc := newTestBlockchain(t, genesis)
+	UTXOSet := NewUTXOSet(bc)
+
+	tx, err := NewUTXOTransaction(alice, string(bob.GetAddress()), 20, FlatFee(0), LargestFirst{}, UTXOSet, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []TxOutput{{Value: 20, PubKeyHash: bobHash}, {Value: 30, PubKeyHash: aliceHash}}, tx.VOut)
+	assert.Equal(t, alice.PublicKey, tx.VIn[0].PubKey)
+	assert.True(t, bc.VerifyTransaction(tx))
+
+	// bob can't spend alice's outputs with his own key
+	stolen := *tx
+	stolen.VIn = []TxInput{{Txid: coinbase.ID, Vout: 0, PubKey: bob.PublicKey}}
+	assert.Nil(t, bc.SignTransaction(&stolen, bob.PrivateKey))
+	assert.False(t, bc.VerifyTransaction(&stolen))
+
+	block := &Block{Height: 1, Hash: []byte("second"), PrevBlockHash: genesis.Hash, TXs: []*Transaction{newTestCoinbase(testAddress("miner"), "", 1, 0), tx}}
+	bc = newTestBlockchain(t, genesis, block)
+	UTXOSet = NewUTXOSet(bc)
+	assert.Equal(t, []TxOutput{{Value: 20, PubKeyHash: bobHash}}, UTXOSet.FindUTXOs(bobHash))
+	assert.Equal(t, []TxOutput{{Value: 30, PubKeyHash: aliceHash}}, UTXOSet.FindUTXOs(aliceHash))
+
+	_, err = NewUTXOTransaction(alice, "bob", 10, FlatFee(0), LargestFirst{}, UTXOSet, nil)
+	assert.NotNil(t, err)
+	_, err = NewUTXOTransaction(bob, string(alice.GetAddress()), 21, FlatFee(0), LargestFirst{}, UTXOSet, nil)
+	assert.NotNil(t, err)
+}
+
+func TestNewUTXOTransactionPaysFee(t *testing.T) {
+	alice := NewWallet()
+	aliceHash := HashPubKey(alice.PublicKey)
+	bob := NewWallet()
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := &Block{Hash: []byte("genesis"), PrevBlockHash: []byte{}, TXs: []*Transaction{coinbase}}
+	bc := newTestBlockchain(t, genesis)
+	UTXOSet := NewUTXOSet(bc)
+
+	tx, err := NewUTXOTransaction(alice, string(bob.GetAddress()), 20, FeeRate(0.02), BranchAndBound{}, UTXOSet, nil)
+	assert.Nil(t, err)
+	bTx, err := tx.Serialize()
+	assert.Nil(t, err)
+	assert.Equal(t, EstimateTxSize(1, 2), len(bTx))
+	fee, err := UTXOSet.BlockFees([]*Transaction{tx})
+	assert.Nil(t, err)
+	assert.Equal(t, FeeRate(0.02).Fee(len(bTx)), fee)
+	assert.Equal(t, TxOutput{Value: 30 - fee, PubKeyHash: aliceHash}, tx.VOut[1])
+
+	// change that would be dust goes to the miner
+	tx, err = NewUTXOTransaction(alice, string(bob.GetAddress()), 49, FlatFee(0), LargestFirst{}, UTXOSet, nil)
+	assert.Nil(t, err)
+	assert.Len(t, tx.VOut, 1)
+
+	_, err = NewUTXOTransaction(alice, string(bob.GetAddress()), 48, FlatFee(3), LargestFirst{}, UTXOSet, nil)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+}
+
+func TestInvalidAddressesAreNotLocked(t *testing.T) {
+	_, err := NewTxOutput(10, "bob")
+	assert.NotNil(t, err)
+	_, err = NewCoinbaseTx("bob", "", 1, 0)
+	assert.NotNil(t, err)
+}
+
+func TestTransactionHashVectors(t *testing.T) {
+	cases := []struct {
+		tx   *Transaction
+		hash string
+	}{
+		{
+			&Transaction{},
+			"41f758f2e5cc078d3795b4fc0cb60c2d735fa92cc020572bdc982dd2d564d11b",
+		},
+		{
+			&Transaction{
+				VIn:  []TxInput{{Txid: []byte{}, Vout: -1, PubKey: []byte("0 genesis")}},
+				VOut: []TxOutput{{Value: 50, PubKeyHash: make([]byte, 20)}},
+			},
+			"28752cbf361893c02c1e52bd668797dcd2de36216befcabd227891ba2bc30a3a",
+		},
+		{
+			&Transaction{
+				VIn:  []TxInput{{Txid: []byte{0x01, 0x02}, Vout: 1, PubKey: []byte{0xff}}},
+				VOut: []TxOutput{{Value: 300, PubKeyHash: []byte{0x0a}}},
+			},
+			"e763456442d50883baf3f61f451acfb0b99c004671a44193ca3f524b30881d5a",
+		},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.hash, hex.EncodeToString(c.tx.Hash()))
+
+		// neither the ID nor the signatures are part of the preimage
+		c.tx.SetID()
+		for i := range c.tx.VIn {
+			c.tx.VIn[i].Signature = []byte("signature")
+		}
+		assert.Equal(t, c.hash, hex.EncodeToString(c.tx.ID))
+		assert.Equal(t, c.hash, hex.EncodeToString(c.tx.Hash()))
+	}
+}
+
+func TestTransactionHashIsUnambiguous(t *testing.T) {
+	// joined without lengths these pairs used to hash the same "1aa2bb" and "ab1c"
+	first := newTestTx(nil, []TxOutput{{Value: 1, PubKeyHash: []byte("aa2bb")}})
+	second := newTestTx(nil, []TxOutput{{Value: 1, PubKeyHash: []byte("aa")}, {Value: 2, PubKeyHash: []byte("bb")}})
+	assert.NotEqual(t, first.ID, second.ID)
+
+	moved := newTestTx([]TxInput{{Txid: []byte("ab"), Vout: 1, PubKey: []byte("c")}}, nil)
+	other := newTestTx([]TxInput{{Txid: []byte("a"), Vout: 0xb, PubKey: []byte("1c")}}, nil)
+	assert.NotEqual(t, moved.ID, other.ID)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	// txid => location of the transaction on the main chain, only kept once
+	// reindex -txindex created the bucket
+	txIndexBucket = "txindex"
+)
+
+// TxLocation is the block confirming a transaction and its position there.
+type TxLocation struct {
+	BlockHash []byte
+	Index     int
+}
+
+func (l *TxLocation) Serialize() []byte {
+	w := &serialWriter{}
+	w.writeUint8(SERIALIZATION_VERSION)
+	w.writeBytes(l.BlockHash)
+	w.writeVarInt(uint64(l.Index))
+	return w.Bytes()
+}
+
+func DeserializeTxLocation(d []byte) (*TxLocation, error) {
+	r := &serialReader{data: d}
+	r.readVersion("transaction location")
+	l := &TxLocation{
+		BlockHash: r.readBytes("block hash"),
+		Index:     int(r.readVarInt("transaction index")),
+	}
+	if err := r.finish("transaction location"); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func indexTransactions(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil
+	}
+	for i, t := range block.TXs {
+		location := &TxLocation{BlockHash: block.Hash, Index: i}
+		if err := b.Put(t.ID, location.Serialize()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func unindexTransactions(tx *bolt.Tx, block *Block) error {
+	b := tx.Bucket([]byte(txIndexBucket))
+	if b == nil {
+		return nil
+	}
+	for _, t := range block.TXs {
+		raw := b.Get(t.ID)
+		if raw == nil {
+			continue
+		}
+		location, err := DeserializeTxLocation(raw)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(location.BlockHash, block.Hash) {
+			continue
+		}
+		if err := b.Delete(t.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bc *Blockchain) HasTxIndex() bool {
+	var found bool
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		found = tx.Bucket([]byte(txIndexBucket)) != nil
+		return nil
+	})
+	must(err)
+
+	return found
+}
+
+// ReindexTransactions builds the transaction index from scratch, which also
+// turns it on, and returns the number of transactions indexed.
+func (bc *Blockchain) ReindexTransactions() (int, error) {
+	count := 0
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(txIndexBucket)) != nil {
+			if err := tx.DeleteBucket([]byte(txIndexBucket)); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.CreateBucket([]byte(txIndexBucket)); err != nil {
+			return err
+		}
+
+		// the tip as of this transaction, so no block connected meanwhile is missed
+		blocks := tx.Bucket([]byte(blocksBucket))
+		for hash := blocks.Get([]byte("l")); len(hash) != 0; {
+			block, err := DeserializeBlock(blocks.Get(hash))
+			if err != nil {
+				return err
+			}
+			if err := indexTransactions(tx, block); err != nil {
+				return err
+			}
+			count += len(block.TXs)
+			hash = block.PrevBlockHash
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// LocateTransaction finds a main chain transaction and the block confirming
+// it, through the transaction index when there is one.
+func (bc *Blockchain) LocateTransaction(ID []byte) (*Transaction, *Block, error) {
+	var location *TxLocation
+	indexed := false
+
+	err := bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(txIndexBucket))
+		if b == nil {
+			return nil
+		}
+		indexed = true
+		if raw := b.Get(ID); raw != nil {
+			var err error
+			location, err = DeserializeTxLocation(raw)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if indexed {
+		if location == nil {
+			return nil, nil, fmt.Errorf("transaction %x is %w", ID, ErrNotFound)
+		}
+		block, err := bc.BlockByHash(location.BlockHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		if location.Index >= len(block.TXs) || !bytes.Equal(block.TXs[location.Index].ID, ID) {
+			return nil, nil, fmt.Errorf("transaction index entry of %x is stale, run reindex -txindex", ID)
+		}
+		return block.TXs[location.Index], block, nil
+	}
+
+	bci := bc.Iterator()
+	if bci.currentHash == nil {
+		return nil, nil, fmt.Errorf("transaction %x is %w", ID, ErrNotFound)
+	}
+	for {
+		block := bci.Next()
+		if block == nil {
+			return nil, nil, fmt.Errorf("unable to read the chain")
+		}
+		for _, tx := range block.TXs {
+			if bytes.Equal(tx.ID, ID) {
+				return tx, block, nil
+			}
+		}
+		if len(block.PrevBlockHash) == 0 {
+			return nil, nil, fmt.Errorf("transaction %x is %w", ID, ErrNotFound)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTxLocationSerialization(t *testing.T) {
+	location := &TxLocation{BlockHash: []byte("block"), Index: 300}
+	decoded, err := DeserializeTxLocation(location.Serialize())
+	assert.Nil(t, err)
+	assert.Equal(t, location, decoded)
+}
+
+func TestTxIndex(t *testing.T) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	spend := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 50, PubKeyHash: testPubKeyHash("bob")}})
+	second := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0), spend)
+	bc := newTestBlockchain(t, genesis, second)
+
+	// without the index the chain is scanned
+	assert.False(t, bc.HasTxIndex())
+	tx, block, err := bc.LocateTransaction(spend.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, spend.ID, tx.ID)
+	assert.Equal(t, second.Hash, block.Hash)
+
+	count, err := bc.ReindexTransactions()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	assert.True(t, bc.HasTxIndex())
+	tx, block, err = bc.LocateTransaction(coinbase.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, coinbase.ID, tx.ID)
+	assert.Equal(t, genesis.Hash, block.Hash)
+
+	// connected blocks are indexed as they come, disconnected ones removed
+	third := mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 0))
+	assert.Nil(t, bc.connectTip(third, true))
+	info, err := bc.TransactionInfo(spend.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, info.Height)
+	assert.Equal(t, 2, info.Confirmations)
+	_, block, err = bc.LocateTransaction(third.TXs[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, third.Hash, block.Hash)
+
+	_, err = bc.DisconnectBlock()
+	assert.Nil(t, err)
+	_, _, err = bc.LocateTransaction(third.TXs[0].ID)
+	assert.NotNil(t, err)
+	_, err = bc.FindTransaction(spend.ID)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	undoBucket = "undo"
+)
+
+// BlockUndo holds the outputs a block spent, in the order of its inputs, so
+// the block can be disconnected without searching the chain for them.
+type BlockUndo struct {
+	Spent []TxOutput
+}
+
+func (u *BlockUndo) Serialize() []byte {
+	w := &serialWriter{}
+	w.writeUint8(SERIALIZATION_VERSION)
+	w.writeVarInt(uint64(len(u.Spent)))
+	for _, out := range u.Spent {
+		out.encode(w)
+	}
+	return w.Bytes()
+}
+
+func DeserializeBlockUndo(d []byte) (*BlockUndo, error) {
+	r := &serialReader{data: d}
+	r.readVersion("undo record")
+	count := r.readCount("spent output count", 9)
+	u := &BlockUndo{Spent: make([]TxOutput, 0, count)}
+	for i := 0; i < count && r.err == nil; i++ {
+		u.Spent = append(u.Spent, decodeTxOutput(r))
+	}
+	if err := r.finish("undo record"); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// writeBlockUndo records the outputs block is about to spend from the
+// chainstate, or from earlier in the block, and returns the record. It has
+// to run before the block is applied to the chainstate.
+func writeBlockUndo(tx *bolt.Tx, block *Block) (*BlockUndo, error) {
+	utxos, err := tx.CreateBucketIfNotExists([]byte(utxoBucket))
+	if err != nil {
+		return nil, err
+	}
+
+	undo := &BlockUndo{}
+	created := make(map[string][]TxOutput)
+	for _, t := range block.TXs {
+		if !t.IsCoinBase() {
+			for _, vin := range t.VIn {
+				if outs, ok := created[hex.EncodeToString(vin.Txid)]; ok {
+					if vin.Vout < 0 || vin.Vout >= len(outs) {
+						return nil, fmt.Errorf("input %x:%d references unknown output", vin.Txid, vin.Vout)
+					}
+					undo.Spent = append(undo.Spent, outs[vin.Vout])
+					continue
+				}
+				rawOuts := utxos.Get(vin.Txid)
+				if rawOuts == nil {
+					return nil, fmt.Errorf("input %x:%d references unknown output", vin.Txid, vin.Vout)
+				}
+				outs, err := DeserializeOutputs(rawOuts)
+				if err != nil {
+					return nil, err
+				}
+				out, ok := outs.Outputs[vin.Vout]
+				if !ok {
+					return nil, fmt.Errorf("input %x:%d references spent output", vin.Txid, vin.Vout)
+				}
+				undo.Spent = append(undo.Spent, out)
+			}
+		}
+		created[hex.EncodeToString(t.ID)] = t.VOut
+	}
+
+	b, err := tx.CreateBucketIfNotExists([]byte(undoBucket))
+	if err != nil {
+		return nil, err
+	}
+	return undo, b.Put(block.Hash, undo.Serialize())
+}
+
+// readBlockUndo returns the undo record of block. Blocks connected before
+// undo records existed have none, their spent outputs are looked up in the
+// transactions of the chain below them instead.
+func readBlockUndo(tx *bolt.Tx, block *Block) (*BlockUndo, error) {
+	if b := tx.Bucket([]byte(undoBucket)); b != nil {
+		if raw := b.Get(block.Hash); raw != nil {
+			return DeserializeBlockUndo(raw)
+		}
+	}
+
+	undo := &BlockUndo{}
+	for _, t := range block.TXs {
+		if t.IsCoinBase() {
+			continue
+		}
+		for _, vin := range t.VIn {
+			prevTX, err := findChainTransaction(tx, block.Hash, vin.Txid)
+			if err != nil {
+				return nil, err
+			}
+			if vin.Vout < 0 || vin.Vout >= len(prevTX.VOut) {
+				return nil, fmt.Errorf("input %x:%d references unknown output", vin.Txid, vin.Vout)
+			}
+			undo.Spent = append(undo.Spent, prevTX.VOut[vin.Vout])
+		}
+	}
+	return undo, nil
+}
+
+// findChainTransaction looks for a transaction in the block hash and its
+// ancestors.
+func findChainTransaction(tx *bolt.Tx, hash, txID []byte) (*Transaction, error) {
+	b := tx.Bucket([]byte(blocksBucket))
+	for len(hash) != 0 {
+		block, err := DeserializeBlock(b.Get(hash))
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range block.TXs {
+			if bytes.Equal(t.ID, txID) {
+				return t, nil
+			}
+		}
+		hash = block.PrevBlockHash
+	}
+	return nil, fmt.Errorf("transaction %x is not found", txID)
+}
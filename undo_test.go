@@ -0,0 +1,170 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlockUndoSerialization(t *testing.T) {
+	undo := &BlockUndo{Spent: []TxOutput{{Value: 50, PubKeyHash: testPubKeyHash("alice")}, {Value: 1}}}
+	decoded, err := DeserializeBlockUndo(undo.Serialize())
+	assert.Nil(t, err)
+	assert.Equal(t, undo, decoded)
+
+	_, err = DeserializeBlockUndo(append(undo.Serialize(), 0))
+	assert.ErrorIs(t, err, ErrSerialization)
+}
+
+type testCoin struct {
+	tx     *Transaction
+	vout   int
+	wallet *Wallet
+}
+
+// randomTestBlock spends random coins to random wallets, sometimes spending
+// an output created earlier in the same block, and updates coins to what is
+// left unspent afterwards.
+func randomTestBlock(rng *rand.Rand, prev *Block, wallets []*Wallet, coins map[string]testCoin) *Block {
+	keys := make([]string, 0, len(coins))
+	for key := range coins {
+		keys = append(keys, key)
+	}
+	// map order is random, the rng has to see the same order on every run
+	sort.Strings(keys)
+	rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+	var txs []*Transaction
+	fees := 0
+	spend := func(coin testCoin) *Transaction {
+		value := coin.tx.VOut[coin.vout].Value
+		fee := rng.Intn(2)
+		if fee >= value {
+			fee = 0
+		}
+		var outs []TxOutput
+		for _, part := range []int{(value - fee) / 2, value - fee - (value-fee)/2} {
+			if part > 0 {
+				to := wallets[rng.Intn(len(wallets))]
+				outs = append(outs, TxOutput{Value: part, PubKeyHash: HashPubKey(to.PublicKey)})
+			}
+		}
+		fees += fee
+		return newSignedTestTx(coin.wallet, coin.tx, coin.vout, outs)
+	}
+	owner := func(tx *Transaction, vout int) *Wallet {
+		for _, w := range wallets {
+			if string(HashPubKey(w.PublicKey)) == string(tx.VOut[vout].PubKeyHash) {
+				return w
+			}
+		}
+		return nil
+	}
+
+	add := func(tx *Transaction) {
+		txs = append(txs, tx)
+		for vout := range tx.VOut {
+			coins[outpoint(tx.ID, vout)] = testCoin{tx: tx, vout: vout, wallet: owner(tx, vout)}
+		}
+	}
+
+	for _, key := range keys[:rng.Intn(len(keys)/2+1)] {
+		coin := coins[key]
+		delete(coins, key)
+		tx := spend(coin)
+		add(tx)
+		if len(tx.VOut) > 0 && rng.Intn(3) == 0 {
+			child := coins[outpoint(tx.ID, 0)]
+			delete(coins, outpoint(tx.ID, 0))
+			add(spend(child))
+		}
+	}
+
+	miner := wallets[rng.Intn(len(wallets))]
+	coinbase := newTestCoinbase(string(miner.GetAddress()), "", prev.Height+1, fees)
+	coins[outpoint(coinbase.ID, 0)] = testCoin{tx: coinbase, vout: 0, wallet: miner}
+	return mineTestBlock(prev, append([]*Transaction{coinbase}, txs...)...)
+}
+
+func copyTestCoins(coins map[string]testCoin) map[string]testCoin {
+	copied := make(map[string]testCoin, len(coins))
+	for key, coin := range coins {
+		copied[key] = coin
+	}
+	return copied
+}
+
+func TestConnectDisconnectRandomChains(t *testing.T) {
+	useTestGenesisBits(t)
+	rng := rand.New(rand.NewSource(1))
+	wallets := []*Wallet{NewWallet(), NewWallet(), NewWallet()}
+
+	coinbase := newTestCoinbase(string(wallets[0].GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	bc := newTestBlockchain(t, genesis)
+
+	coins := map[string]testCoin{outpoint(coinbase.ID, 0): {tx: coinbase, vout: 0, wallet: wallets[0]}}
+	snapshots := []map[string]TxOutputs{utxoSnapshot(t, bc)}
+	states := []map[string]testCoin{copyTestCoins(coins)}
+	tip := genesis
+
+	for round := 0; round < 8; round++ {
+		// mineTestBlock doesn't retarget, stay below the first adjustment
+		for i := rng.Intn(4) + 1; i > 0 && tip.Height+1 < RETARGET_INTERVAL; i-- {
+			block := randomTestBlock(rng, tip, wallets, coins)
+			assert.Nil(t, bc.connectTip(block, true))
+			tip = block
+			snapshots = append(snapshots, utxoSnapshot(t, bc))
+			states = append(states, copyTestCoins(coins))
+		}
+		assert.Equal(t, bc.FindUTXO(), snapshots[len(snapshots)-1])
+
+		for i := rng.Intn(len(snapshots) - 1); i > 0; i-- {
+			block, err := bc.DisconnectBlock()
+			assert.Nil(t, err)
+			assert.Equal(t, tip.Hash, block.Hash)
+			snapshots, states = snapshots[:len(snapshots)-1], states[:len(states)-1]
+			assert.Equal(t, snapshots[len(snapshots)-1], utxoSnapshot(t, bc))
+
+			tip, err = bc.BlockByHash(bc.lastBlockHash)
+			assert.Nil(t, err)
+		}
+		coins = copyTestCoins(states[len(states)-1])
+	}
+
+	for len(snapshots) > 1 {
+		_, err := bc.DisconnectBlock()
+		assert.Nil(t, err)
+		snapshots = snapshots[:len(snapshots)-1]
+		assert.Equal(t, snapshots[len(snapshots)-1], utxoSnapshot(t, bc))
+	}
+	_, err := bc.DisconnectBlock()
+	assert.NotNil(t, err)
+}
+
+func TestDisconnectBlockWithoutUndoRecord(t *testing.T) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	spend := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 50, PubKeyHash: testPubKeyHash("bob")}})
+	second := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0), spend)
+	bc := newTestBlockchain(t, genesis)
+	before := utxoSnapshot(t, bc)
+	assert.Nil(t, bc.connectTip(second, true))
+
+	// chains connected before undo records existed fall back to the blocks
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(undoBucket))
+	})
+	assert.Nil(t, err)
+
+	block, err := bc.DisconnectBlock()
+	assert.Nil(t, err)
+	assert.Equal(t, second.Hash, block.Hash)
+	assert.Equal(t, before, utxoSnapshot(t, bc))
+}
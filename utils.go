@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
 	"log"
+	"math/big"
 
 	"github.com/itchyny/base58-go"
 )
@@ -11,28 +14,58 @@ func IntToHex[I int32 | int64 | int](n I) []byte {
 	return []byte(fmt.Sprintf("%x", n))
 }
 
+func doubleSHA256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
 func must(err error) {
 	if err != nil {
 		panic(err)
 	}
 }
 
+// the base58 library works on decimal numbers, so the bytes go through a
+// big.Int and leading zero bytes are kept as leading '1's like Bitcoin does
 func Base58Encode(text []byte) []byte {
 	encoding := base58.BitcoinEncoding
-	encoded, err := encoding.Encode(text)
+	zeros := 0
+	for zeros < len(text) && text[zeros] == 0 {
+		zeros++
+	}
+	encoded := bytes.Repeat([]byte{'1'}, zeros)
+	if zeros == len(text) {
+		return encoded
+	}
+
+	n := new(big.Int).SetBytes(text[zeros:])
+	rest, err := encoding.Encode([]byte(n.String()))
 	if err != nil {
 		log.Println(err)
 		return []byte{}
 	}
-	return encoded
+	return append(encoded, rest...)
 }
 
-func Base58Decode(text []byte) []byte {
+func Base58Decode(text []byte) ([]byte, error) {
 	encoding := base58.BitcoinEncoding
-	decoded, err := encoding.Decode(text)
+	ones := 0
+	for ones < len(text) && text[ones] == '1' {
+		ones++
+	}
+	decoded := make([]byte, ones)
+	if ones == len(text) {
+		return decoded, nil
+	}
+
+	number, err := encoding.Decode(text[ones:])
 	if err != nil {
-		log.Println(err)
-		return []byte{}
+		return nil, err
+	}
+	n, ok := new(big.Int).SetString(string(number), 10)
+	if !ok {
+		return nil, fmt.Errorf("unable to decode %s", text)
 	}
-	return decoded
+	return append(decoded, n.Bytes()...), nil
 }
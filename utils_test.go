@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/hex"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -13,3 +14,26 @@ func TestIntToHex(t *testing.T) {
 	h := IntToHex(n)
 	assert.Equal(t, hex, h)
 }
+
+func TestBase58(t *testing.T) {
+	// vectors from Bitcoin's base58_encode_decode.json
+	cases := map[string]string{
+		"":                     "",
+		"61":                   "2g",
+		"626262":               "a3gV",
+		"00000000000000000000": "1111111111",
+		"00eb15231dfceb60925886b67d065299925915aeb172c06647": "1NS17iag9jJgTHD1VXjvLCEnZuQ3rJDE9L",
+		"572e4794": "3EFU7m",
+	}
+	for h, encoded := range cases {
+		raw, err := hex.DecodeString(h)
+		assert.Nil(t, err)
+		assert.Equal(t, encoded, string(Base58Encode(raw)))
+		decoded, err := Base58Decode([]byte(encoded))
+		assert.Nil(t, err)
+		assert.Equal(t, raw, decoded)
+	}
+
+	_, err := Base58Decode([]byte("0OIl"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	utxoBucket = "chainstate"
+)
+
+// TxOutputs holds the unspent outputs of a single transaction keyed by their
+// index in the transaction's VOut, so spent outputs can be removed without
+// shifting the others.
+type TxOutputs struct {
+	Outputs map[int]TxOutput
+}
+
+type UTXOSet struct {
+	bc *Blockchain
+}
+
+func NewUTXOSet(bc *Blockchain) *UTXOSet {
+	return &UTXOSet{
+		bc: bc,
+	}
+}
+
+func (outs TxOutputs) Serialize() ([]byte, error) {
+	w := &serialWriter{}
+	outs.encode(w)
+
+	return w.Bytes(), nil
+}
+
+func DeserializeOutputs(d []byte) (TxOutputs, error) {
+	r := &serialReader{data: d}
+	outs := decodeTxOutputs(r)
+	if err := r.finish("outputs"); err != nil {
+		return TxOutputs{}, err
+	}
+	return outs, nil
+}
+
+// Reindex drops the chainstate bucket and rebuilds it by walking the whole chain.
+func (u *UTXOSet) Reindex() error {
+	UTXOs := u.bc.FindUTXO()
+
+	return u.bc.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(utxoBucket)) != nil {
+			if err := tx.DeleteBucket([]byte(utxoBucket)); err != nil {
+				return err
+			}
+		}
+		b, err := tx.CreateBucket([]byte(utxoBucket))
+		if err != nil {
+			return err
+		}
+		for txID, outs := range UTXOs {
+			key, err := hex.DecodeString(txID)
+			if err != nil {
+				return err
+			}
+			bOuts, err := outs.Serialize()
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key, bOuts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// FindUTXOs returns the unspent outputs locked to pubKeyHash.
+func (u *UTXOSet) FindUTXOs(pubKeyHash []byte) []TxOutput {
+	var txOuts []TxOutput
+
+	err := u.bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return fmt.Errorf("utxo bucket %s not exists", utxoBucket)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			for _, out := range outs.Outputs {
+				if out.IsLockedWith(pubKeyHash) {
+					txOuts = append(txOuts, out)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return txOuts
+}
+
+// SpendableCoins returns the unspent outputs locked to pubKeyHash, ordered by
+// outpoint.
+func (u *UTXOSet) SpendableCoins(pubKeyHash []byte) ([]Coin, error) {
+	var coins []Coin
+
+	err := u.bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return fmt.Errorf("utxo bucket %s not exists", utxoBucket)
+		}
+		return b.ForEach(func(k, v []byte) error {
+			outs, err := DeserializeOutputs(v)
+			if err != nil {
+				return err
+			}
+			var indexes []int
+			for outIdx, out := range outs.Outputs {
+				if out.IsLockedWith(pubKeyHash) {
+					indexes = append(indexes, outIdx)
+				}
+			}
+			sort.Ints(indexes)
+			for _, outIdx := range indexes {
+				coins = append(coins, Coin{TxID: append([]byte{}, k...), Vout: outIdx, Output: outs.Outputs[outIdx]})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return coins, nil
+}
+
+// UnspentOutputs returns the outputs of transaction txID that are still
+// unspent, none for a fully spent or unknown transaction.
+func (u *UTXOSet) UnspentOutputs(txID []byte) (TxOutputs, error) {
+	outs := TxOutputs{Outputs: make(map[int]TxOutput)}
+
+	err := u.bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return fmt.Errorf("utxo bucket %s not exists", utxoBucket)
+		}
+		if raw := b.Get(txID); raw != nil {
+			var err error
+			outs, err = DeserializeOutputs(raw)
+			return err
+		}
+		return nil
+	})
+
+	return outs, err
+}
+
+func (u *UTXOSet) CountTransactions() int {
+	counter := 0
+
+	err := u.bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return fmt.Errorf("utxo bucket %s not exists", utxoBucket)
+		}
+		counter = b.Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		log.Println(err)
+	}
+
+	return counter
+}
+
+// BlockFees returns the sum of the fees paid by txs, the coinbase excluded.
+func (u *UTXOSet) BlockFees(txs []*Transaction) (int, error) {
+	var fees int
+
+	err := u.bc.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(utxoBucket))
+		if b == nil {
+			return fmt.Errorf("utxo bucket %s not exists", utxoBucket)
+		}
+		var err error
+		fees, err = blockFees(b, txs)
+		return err
+	})
+
+	return fees, err
+}
+
+// blockFees sums what every non coinbase transaction leaves between its
+// inputs and outputs. Inputs may spend outputs created earlier in txs.
+func blockFees(b *bolt.Bucket, txs []*Transaction) (int, error) {
+	fees, err := txFees(b, txs)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, fee := range fees {
+		total += fee
+	}
+	return total, nil
+}
+
+// txFees returns the fee of each of txs, 0 for the coinbase. Every connect
+// path goes through it, so it also range checks the values of txs.
+func txFees(b *bolt.Bucket, txs []*Transaction) ([]int, error) {
+	created := make(map[string][]TxOutput)
+	fees := make([]int, len(txs))
+
+	for i, tx := range txs {
+		out, err := checkOutputValues(tx)
+		if err != nil {
+			return nil, err
+		}
+		if tx.IsCoinBase() {
+			created[hex.EncodeToString(tx.ID)] = tx.VOut
+			continue
+		}
+
+		in := 0
+		for _, vin := range tx.VIn {
+			if outs, ok := created[hex.EncodeToString(vin.Txid)]; ok {
+				if vin.Vout < 0 || vin.Vout >= len(outs) {
+					return nil, fmt.Errorf("input %x:%d references unknown output", vin.Txid, vin.Vout)
+				}
+				in += outs[vin.Vout].Value
+				if !moneyRange(in) {
+					return nil, fmt.Errorf("inputs of transaction %x are worth more than %d", tx.ID, MAX_MONEY)
+				}
+				continue
+			}
+			rawOuts := b.Get(vin.Txid)
+			if rawOuts == nil {
+				return nil, fmt.Errorf("input %x:%d references unknown output", vin.Txid, vin.Vout)
+			}
+			outs, err := DeserializeOutputs(rawOuts)
+			if err != nil {
+				return nil, err
+			}
+			out, ok := outs.Outputs[vin.Vout]
+			if !ok {
+				return nil, fmt.Errorf("input %x:%d references spent output", vin.Txid, vin.Vout)
+			}
+			in += out.Value
+			if !moneyRange(in) {
+				return nil, fmt.Errorf("inputs of transaction %x are worth more than %d", tx.ID, MAX_MONEY)
+			}
+		}
+
+		if out > in {
+			return nil, fmt.Errorf("transaction %x spends %d but its inputs are only worth %d", tx.ID, out, in)
+		}
+
+		fees[i] = in - out
+		created[hex.EncodeToString(tx.ID)] = tx.VOut
+	}
+
+	return fees, nil
+}
+
+// updateUTXOs applies a block to the chainstate bucket: outputs spent by its
+// inputs are removed and its new outputs are added. It runs inside the
+// caller's bolt transaction so the block and the index are written together.
+func updateUTXOs(tx *bolt.Tx, block *Block) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(utxoBucket))
+	if err != nil {
+		return err
+	}
+
+	fees, err := blockFees(b, block.TXs)
+	if err != nil {
+		return err
+	}
+	schedule, err := readSubsidySchedule(tx)
+	if err != nil {
+		return err
+	}
+	if err := checkCoinbase(block, fees, schedule); err != nil {
+		return err
+	}
+
+	for _, t := range block.TXs {
+		if !t.IsCoinBase() {
+			for _, vin := range t.VIn {
+				rawOuts := b.Get(vin.Txid)
+				if rawOuts == nil {
+					return fmt.Errorf("input %x:%d references unknown output", vin.Txid, vin.Vout)
+				}
+				outs, err := DeserializeOutputs(rawOuts)
+				if err != nil {
+					return err
+				}
+				if _, ok := outs.Outputs[vin.Vout]; !ok {
+					return fmt.Errorf("input %x:%d references spent output", vin.Txid, vin.Vout)
+				}
+				delete(outs.Outputs, vin.Vout)
+
+				if len(outs.Outputs) == 0 {
+					err = b.Delete(vin.Txid)
+				} else {
+					rawOuts, err = outs.Serialize()
+					if err != nil {
+						return err
+					}
+					err = b.Put(vin.Txid, rawOuts)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		newOuts := TxOutputs{Outputs: make(map[int]TxOutput)}
+		for outIdx, out := range t.VOut {
+			newOuts.Outputs[outIdx] = out
+		}
+		rawOuts, err := newOuts.Serialize()
+		if err != nil {
+			return err
+		}
+		if err := b.Put(t.ID, rawOuts); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreOutput puts back an output spent by a block being disconnected.
+func restoreOutput(b *bolt.Bucket, txID []byte, vout int, out TxOutput) error {
+	outs := TxOutputs{Outputs: make(map[int]TxOutput)}
+	if rawOuts := b.Get(txID); rawOuts != nil {
+		var err error
+		if outs, err = DeserializeOutputs(rawOuts); err != nil {
+			return err
+		}
+	}
+	outs.Outputs[vout] = out
+
+	rawOuts, err := outs.Serialize()
+	if err != nil {
+		return err
+	}
+	return b.Put(txID, rawOuts)
+}
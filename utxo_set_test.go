@@ -0,0 +1,161 @@
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBlockchain stores the given blocks without mining them, so the
+// chainstate logic can be exercised without paying for proof of work.
+func newTestBlockchain(t *testing.T, blocks ...*Block) *Blockchain {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	bc := &Blockchain{db: db}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucket([]byte(blocksBucket)); err != nil {
+			return err
+		}
+		for _, block := range blocks {
+			if err := connectBlock(tx, block, nil); err != nil {
+				return err
+			}
+			bc.lastBlockHash = block.Hash
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	return bc
+}
+
+// testPubKeyHash stands in for the key hash of a wallet called name.
+func testPubKeyHash(name string) []byte {
+	return HashPubKey([]byte(name))
+}
+
+func testAddress(name string) string {
+	return string(pubKeyHashAddress(testPubKeyHash(name)))
+}
+
+func newTestCoinbase(to, data string, height, fees int) *Transaction {
+	tx, err := NewCoinbaseTx(to, data, height, defaultSubsidySchedule.Subsidy(height)+fees)
+	must(err)
+	return tx
+}
+
+func newTestTx(ins []TxInput, outs []TxOutput) *Transaction {
+	tx := &Transaction{VIn: ins, VOut: outs}
+	tx.SetID()
+	return tx
+}
+
+func TestUTXOSetUpdate(t *testing.T) {
+	coinbase := newTestCoinbase(testAddress("alice"), "genesis", 0, 0)
+	genesis := &Block{Hash: []byte("genesis"), PrevBlockHash: []byte{}, TXs: []*Transaction{coinbase}}
+
+	spend := newTestTx(
+		[]TxInput{{Txid: coinbase.ID, Vout: 0}},
+		[]TxOutput{{Value: 20, PubKeyHash: testPubKeyHash("bob")}, {Value: 30, PubKeyHash: testPubKeyHash("alice")}},
+	)
+	block := &Block{Height: 1, Hash: []byte("second"), PrevBlockHash: genesis.Hash, TXs: []*Transaction{newTestCoinbase(testAddress("miner"), "", 1, 0), spend}}
+
+	bc := newTestBlockchain(t, genesis, block)
+	UTXOSet := NewUTXOSet(bc)
+
+	assert.Equal(t, []TxOutput{{Value: 20, PubKeyHash: testPubKeyHash("bob")}}, UTXOSet.FindUTXOs(testPubKeyHash("bob")))
+	assert.Equal(t, []TxOutput{{Value: 30, PubKeyHash: testPubKeyHash("alice")}}, UTXOSet.FindUTXOs(testPubKeyHash("alice")))
+	assert.Equal(t, 2, UTXOSet.CountTransactions())
+
+	coins, err := UTXOSet.SpendableCoins(testPubKeyHash("alice"))
+	assert.Nil(t, err)
+	assert.Equal(t, []Coin{{TxID: spend.ID, Vout: 1, Output: TxOutput{Value: 30, PubKeyHash: testPubKeyHash("alice")}}}, coins)
+}
+
+func TestUTXOSetReindex(t *testing.T) {
+	coinbase := newTestCoinbase(testAddress("alice"), "genesis", 0, 0)
+	genesis := &Block{Hash: []byte("genesis"), PrevBlockHash: []byte{}, TXs: []*Transaction{coinbase}}
+	spend := newTestTx(
+		[]TxInput{{Txid: coinbase.ID, Vout: 0}},
+		[]TxOutput{{Value: 50, PubKeyHash: testPubKeyHash("bob")}},
+	)
+	block := &Block{Height: 1, Hash: []byte("second"), PrevBlockHash: genesis.Hash, TXs: []*Transaction{newTestCoinbase(testAddress("miner"), "", 1, 0), spend}}
+
+	bc := newTestBlockchain(t, genesis, block)
+	UTXOSet := NewUTXOSet(bc)
+	before := UTXOSet.FindUTXOs(testPubKeyHash("bob"))
+
+	assert.Nil(t, UTXOSet.Reindex())
+	assert.Equal(t, before, UTXOSet.FindUTXOs(testPubKeyHash("bob")))
+	assert.Equal(t, 2, UTXOSet.CountTransactions())
+}
+
+func TestUTXOSetRejectsDoubleSpend(t *testing.T) {
+	coinbase := newTestCoinbase(testAddress("alice"), "genesis", 0, 0)
+	genesis := &Block{Hash: []byte("genesis"), PrevBlockHash: []byte{}, TXs: []*Transaction{coinbase}}
+	bc := newTestBlockchain(t, genesis)
+
+	spend := newTestTx([]TxInput{{Txid: coinbase.ID, Vout: 0}}, []TxOutput{{Value: 50}})
+	again := newTestTx([]TxInput{{Txid: coinbase.ID, Vout: 0}}, []TxOutput{{Value: 49}})
+	block := &Block{Height: 1, Hash: []byte("second"), PrevBlockHash: genesis.Hash, TXs: []*Transaction{newTestCoinbase(testAddress("miner"), "", 1, 0), spend, again}}
+
+	err := bc.db.Update(func(tx *bolt.Tx) error {
+		return updateUTXOs(tx, block)
+	})
+	assert.NotNil(t, err)
+}
+
+func TestUTXOSetCollectsFees(t *testing.T) {
+	coinbase := newTestCoinbase(testAddress("alice"), "genesis", 0, 0)
+	genesis := &Block{Hash: []byte("genesis"), PrevBlockHash: []byte{}, TXs: []*Transaction{coinbase}}
+	bc := newTestBlockchain(t, genesis)
+
+	spend := newTestTx([]TxInput{{Txid: coinbase.ID, Vout: 0}}, []TxOutput{{Value: 45}})
+	fees, err := NewUTXOSet(bc).BlockFees([]*Transaction{spend})
+	assert.Nil(t, err)
+	assert.Equal(t, 5, fees)
+
+	greedy := &Block{Height: 1, Hash: []byte("greedy"), PrevBlockHash: genesis.Hash, TXs: []*Transaction{newTestCoinbase(testAddress("miner"), "", 1, fees+1), spend}}
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return updateUTXOs(tx, greedy)
+	})
+	assert.NotNil(t, err)
+
+	block := &Block{Height: 1, Hash: []byte("second"), PrevBlockHash: genesis.Hash, TXs: []*Transaction{newTestCoinbase(testAddress("miner"), "", 1, fees), spend}}
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return updateUTXOs(tx, block)
+	})
+	assert.Nil(t, err)
+}
+
+func TestUTXOSetRejectsOutOfRangeValues(t *testing.T) {
+	coinbase := newTestCoinbase(testAddress("alice"), "genesis", 0, 0)
+	genesis := &Block{Hash: []byte("genesis"), PrevBlockHash: []byte{}, TXs: []*Transaction{coinbase}}
+	bc := newTestBlockchain(t, genesis)
+	UTXOSet := NewUTXOSet(bc)
+
+	// a negative output would make up for one worth more than the inputs
+	negative := newTestTx([]TxInput{{Txid: coinbase.ID, Vout: 0}}, []TxOutput{{Value: -1000}, {Value: 1050}})
+	_, err := UTXOSet.BlockFees([]*Transaction{negative})
+	assert.NotNil(t, err)
+
+	// so would outputs whose sum overflows
+	huge := newTestTx([]TxInput{{Txid: coinbase.ID, Vout: 0}}, []TxOutput{{Value: math.MaxInt}, {Value: math.MaxInt}, {Value: 52}})
+	_, err = UTXOSet.BlockFees([]*Transaction{huge})
+	assert.NotNil(t, err)
+
+	tooMuch := newTestTx([]TxInput{{Txid: coinbase.ID, Vout: 0}}, []TxOutput{{Value: MAX_MONEY + 1}})
+	_, err = UTXOSet.BlockFees([]*Transaction{tooMuch})
+	assert.NotNil(t, err)
+
+	block := &Block{Height: 1, Hash: []byte("second"), PrevBlockHash: genesis.Hash, TXs: []*Transaction{newTestCoinbase(testAddress("miner"), "", 1, 0), negative}}
+	err = bc.db.Update(func(tx *bolt.Tx) error {
+		return updateUTXOs(tx, block)
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// a block's timestamp can't be older than the median of this many
+	// previous blocks
+	MEDIAN_TIME_BLOCKS = 11
+	// nor can it be further than this many seconds in the future
+	MAX_FUTURE_BLOCK_TIME = 2 * 60 * 60
+)
+
+// BlockValidationError tells which block broke the chain and why.
+type BlockValidationError struct {
+	Height int
+	Hash   []byte
+	Reason string
+}
+
+func (e *BlockValidationError) Error() string {
+	return fmt.Sprintf("block %x at height %d is invalid: %s", e.Hash, e.Height, e.Reason)
+}
+
+type VerifyReport struct {
+	FromHeight    int
+	ToHeight      int
+	BlocksChecked int
+	// nil when every checked block is valid
+	Failure *BlockValidationError
+}
+
+// ChainValidator replays the chain from genesis keeping its own view of the
+// unspent outputs, so it doesn't trust the chainstate bucket it is checking.
+type ChainValidator struct {
+	subsidy SubsidySchedule
+	// where the ancestors of the checked blocks are read, bc.BlockByHash
+	// unless the blocks aren't stored yet
+	blockByHash func([]byte) (*Block, error)
+	prev        *Block
+	timestamps  []int64
+	utxos       map[string]map[int]TxOutput
+	txs         map[string]Transaction
+}
+
+func NewChainValidator(bc *Blockchain) *ChainValidator {
+	return &ChainValidator{
+		subsidy:     bc.SubsidySchedule(),
+		blockByHash: bc.BlockByHash,
+		utxos:       make(map[string]map[int]TxOutput),
+		txs:         make(map[string]Transaction),
+	}
+}
+
+// ConnectBlock checks block on top of the blocks connected so far and
+// applies it to the validator's state. With check false the block is only
+// applied, which is how blocks below -from-height are skipped.
+func (v *ChainValidator) ConnectBlock(block *Block, check bool) error {
+	fail := func(format string, a ...interface{}) error {
+		return &BlockValidationError{
+			Height: block.Height,
+			Hash:   block.Hash,
+			Reason: fmt.Sprintf(format, a...),
+		}
+	}
+
+	if check {
+		if err := v.checkHeader(block); err != nil {
+			return fail("%s", err)
+		}
+	}
+
+	fees := 0
+	spent := make(map[string]bool)
+	for _, tx := range block.TXs {
+		txID := hex.EncodeToString(tx.ID)
+		if _, ok := v.txs[txID]; ok && check {
+			return fail("transaction %s already exists in the chain", txID)
+		}
+		if check && !bytes.Equal(tx.ID, tx.Hash()) {
+			return fail("transaction %s doesn't hash to its ID", txID)
+		}
+
+		if !tx.IsCoinBase() {
+			in := 0
+			prevTXs := make(map[string]Transaction)
+			for _, vin := range tx.VIn {
+				inTxID := hex.EncodeToString(vin.Txid)
+				outpoint := fmt.Sprintf("%s:%d", inTxID, vin.Vout)
+				if spent[outpoint] {
+					return fail("transaction %s double spends %s within the block", txID, outpoint)
+				}
+				out, ok := v.utxos[inTxID][vin.Vout]
+				if !ok {
+					return fail("transaction %s spends %s which is not an unspent output", txID, outpoint)
+				}
+				spent[outpoint] = true
+				in += out.Value
+				prevTXs[inTxID] = v.txs[inTxID]
+			}
+
+			out, err := checkOutputValues(tx)
+			if err != nil {
+				return fail("%s", err)
+			}
+			if !moneyRange(in) {
+				return fail("inputs of transaction %s are worth more than %d", txID, MAX_MONEY)
+			}
+			if check && out > in {
+				return fail("transaction %s spends %d but its inputs are only worth %d", txID, out, in)
+			}
+			if check && !tx.Verify(prevTXs) {
+				return fail("transaction %s has an invalid signature", txID)
+			}
+			fees += in - out
+
+			for _, vin := range tx.VIn {
+				inTxID := hex.EncodeToString(vin.Txid)
+				delete(v.utxos[inTxID], vin.Vout)
+				if len(v.utxos[inTxID]) == 0 {
+					delete(v.utxos, inTxID)
+				}
+			}
+		}
+
+		outs := make(map[int]TxOutput)
+		for outIdx, out := range tx.VOut {
+			outs[outIdx] = out
+		}
+		v.utxos[txID] = outs
+		v.txs[txID] = *tx
+	}
+
+	if check {
+		if err := checkCoinbase(block, fees, v.subsidy); err != nil {
+			return fail("%s", err)
+		}
+	}
+
+	v.prev = block
+	v.timestamps = append(v.timestamps, block.Timestamp)
+	if len(v.timestamps) > MEDIAN_TIME_BLOCKS {
+		v.timestamps = v.timestamps[1:]
+	}
+
+	return nil
+}
+
+func (v *ChainValidator) checkHeader(block *Block) error {
+	if v.prev == nil {
+		if len(block.PrevBlockHash) != 0 || block.Height != 0 {
+			return fmt.Errorf("genesis block must have no parent and height 0")
+		}
+	} else {
+		if !bytes.Equal(block.PrevBlockHash, v.prev.Hash) {
+			return fmt.Errorf("previous block hash %x doesn't match %x", block.PrevBlockHash, v.prev.Hash)
+		}
+		if block.Height != v.prev.Height+1 {
+			return fmt.Errorf("height %d doesn't follow %d", block.Height, v.prev.Height)
+		}
+		if mtp := v.medianTimePast(); block.Timestamp < mtp {
+			return fmt.Errorf("timestamp %d is older than the median time past %d", block.Timestamp, mtp)
+		}
+	}
+	if block.Timestamp > time.Now().Unix()+MAX_FUTURE_BLOCK_TIME {
+		return fmt.Errorf("timestamp %d is too far in the future", block.Timestamp)
+	}
+
+	bits, err := expectedTargetBits(block, v.blockByHash)
+	if err != nil {
+		return err
+	}
+	pow := NewProofOfWork(block)
+	if hash := pow.hash(block.Nonce); !bytes.Equal(block.Hash, hash) {
+		return fmt.Errorf("hash doesn't match the header, which hashes to %x", hash)
+	}
+	if !pow.IsValid(bits) {
+		return fmt.Errorf("proof of work is invalid, expected bits %08x", bits)
+	}
+
+	if !bytes.Equal(block.MerkleRoot, block.HashTransactions()) {
+		return fmt.Errorf("merkle root %x doesn't match the transactions", block.MerkleRoot)
+	}
+	var txIDs [][]byte
+	for _, tx := range block.TXs {
+		txIDs = append(txIDs, tx.ID)
+	}
+	if txID := duplicateLeaf(txIDs); txID != nil {
+		return fmt.Errorf("transaction %x appears more than once", txID)
+	}
+
+	return nil
+}
+
+func (v *ChainValidator) medianTimePast() int64 {
+	timestamps := make([]int64, len(v.timestamps))
+	copy(timestamps, v.timestamps)
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	return timestamps[len(timestamps)/2]
+}
+
+// ValidateHeader checks block against its parent, which may be on a side
+// branch: the link, the timestamps, the proof of work and the merkle root.
+func (bc *Blockchain) ValidateHeader(block *Block) error {
+	v := NewChainValidator(bc)
+
+	if len(block.PrevBlockHash) != 0 {
+		var recent []*Block
+		hash := block.PrevBlockHash
+		for len(recent) < MEDIAN_TIME_BLOCKS && len(hash) != 0 {
+			prev, err := bc.BlockByHash(hash)
+			if err != nil {
+				return err
+			}
+			recent = append(recent, prev)
+			hash = prev.PrevBlockHash
+		}
+		v.prev = recent[0]
+		for i := len(recent) - 1; i >= 0; i-- {
+			v.timestamps = append(v.timestamps, recent[i].Timestamp)
+		}
+	}
+
+	if err := v.checkHeader(block); err != nil {
+		return &BlockValidationError{Height: block.Height, Hash: block.Hash, Reason: err.Error()}
+	}
+	return nil
+}
+
+// ValidateBlock checks a block that is about to be connected on top of its
+// parent, which has to be the tip. Spends and the coinbase are checked
+// against the chainstate when the block is connected.
+func (bc *Blockchain) ValidateBlock(block *Block) error {
+	if err := bc.ValidateHeader(block); err != nil {
+		return err
+	}
+
+	inBlock := make(map[string]Transaction)
+	for _, tx := range block.TXs {
+		if !bytes.Equal(tx.ID, tx.Hash()) {
+			return &BlockValidationError{
+				Height: block.Height,
+				Hash:   block.Hash,
+				Reason: fmt.Sprintf("transaction %x doesn't hash to its ID", tx.ID),
+			}
+		}
+		if _, err := checkOutputValues(tx); err != nil {
+			return &BlockValidationError{Height: block.Height, Hash: block.Hash, Reason: err.Error()}
+		}
+		inBlock[hex.EncodeToString(tx.ID)] = *tx
+	}
+	for _, tx := range block.TXs {
+		prevTXs := make(map[string]Transaction)
+		for _, vin := range tx.VIn {
+			if tx.IsCoinBase() {
+				break
+			}
+			inTxID := hex.EncodeToString(vin.Txid)
+			prevTX, ok := inBlock[inTxID]
+			if !ok {
+				prevTX, _ = bc.FindTransaction(vin.Txid)
+			}
+			prevTXs[inTxID] = prevTX
+		}
+		if !tx.Verify(prevTXs) {
+			return &BlockValidationError{
+				Height: block.Height,
+				Hash:   block.Hash,
+				Reason: fmt.Sprintf("transaction %x has an invalid signature", tx.ID),
+			}
+		}
+	}
+
+	return nil
+}
+
+// VerifyChain validates every block from fromHeight up to the tip and stops
+// at the first invalid one.
+func (bc *Blockchain) VerifyChain(fromHeight int) (*VerifyReport, error) {
+	var hashes [][]byte
+	bci := bc.Iterator()
+	for {
+		block := bci.Next()
+		if block == nil {
+			return nil, fmt.Errorf("unable to read the chain")
+		}
+		hashes = append(hashes, block.Hash)
+		if len(block.PrevBlockHash) == 0 {
+			break
+		}
+	}
+
+	report := &VerifyReport{
+		FromHeight: fromHeight,
+		ToHeight:   len(hashes) - 1,
+	}
+	v := NewChainValidator(bc)
+	for i := len(hashes) - 1; i >= 0; i-- {
+		block, err := bc.BlockByHash(hashes[i])
+		if err != nil {
+			return nil, err
+		}
+		check := block.Height >= fromHeight
+		if err := v.ConnectBlock(block, check); err != nil {
+			if verr, ok := err.(*BlockValidationError); ok {
+				report.Failure = verr
+				return report, nil
+			}
+			return nil, err
+		}
+		if check {
+			report.BlocksChecked++
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useTestGenesisBits lets the test chains be mined at the easiest target.
+func useTestGenesisBits(t *testing.T) {
+	bits := genesisBits
+	genesisBits = testBits
+	t.Cleanup(func() { genesisBits = bits })
+}
+
+func mineTestBlock(prev *Block, txs ...*Transaction) *Block {
+	if prev == nil {
+		return NewBlock(txs, []byte{}, 0, genesisBits)
+	}
+	return NewBlock(txs, prev.Hash, prev.Height+1, prev.Bits)
+}
+
+func newSignedTestTx(w *Wallet, prev *Transaction, vout int, outs []TxOutput) *Transaction {
+	tx := newTestTx([]TxInput{{Txid: prev.ID, Vout: vout, PubKey: w.PublicKey}}, outs)
+	tx.Sign(w.PrivateKey, map[string]Transaction{hex.EncodeToString(prev.ID): *prev})
+	return tx
+}
+
+func TestVerifyChain(t *testing.T) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+
+	spend := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 40, PubKeyHash: testPubKeyHash("bob")}})
+	second := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 10), spend)
+
+	bc := newTestBlockchain(t, genesis, second)
+	report, err := bc.VerifyChain(0)
+	assert.Nil(t, err)
+	assert.Nil(t, report.Failure)
+	assert.Equal(t, 2, report.BlocksChecked)
+	assert.Equal(t, 1, report.ToHeight)
+
+	report, err = bc.VerifyChain(1)
+	assert.Nil(t, err)
+	assert.Nil(t, report.Failure)
+	assert.Equal(t, 1, report.BlocksChecked)
+}
+
+func TestVerifyChainFailures(t *testing.T) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+	aliceHash := HashPubKey(alice.PublicKey)
+	mallory := NewWallet()
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	spend := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 50, PubKeyHash: aliceHash}})
+	second := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0), spend)
+
+	cases := map[string]func() *Block{
+		"double spend across blocks": func() *Block {
+			again := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 49}})
+			return mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 1), again)
+		},
+		"double spend within block": func() *Block {
+			first := newSignedTestTx(alice, spend, 0, []TxOutput{{Value: 50}})
+			again := newSignedTestTx(alice, spend, 0, []TxOutput{{Value: 49}})
+			return mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 0), first, again)
+		},
+		"bad signature": func() *Block {
+			stolen := newSignedTestTx(mallory, spend, 0, []TxOutput{{Value: 50}})
+			return mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 0), stolen)
+		},
+		"transaction ID mismatch": func() *Block {
+			forged := newSignedTestTx(alice, spend, 0, []TxOutput{{Value: 50}})
+			forged.ID = coinbase.ID
+			return mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 0), forged)
+		},
+		"negative output": func() *Block {
+			negative := newSignedTestTx(alice, spend, 0, []TxOutput{{Value: -1000}, {Value: 1050}})
+			return mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 0), negative)
+		},
+		"overpaying coinbase": func() *Block {
+			return mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 1))
+		},
+		"wrong merkle root": func() *Block {
+			block := mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 0))
+			block.MerkleRoot = []byte("tampered")
+			return block
+		},
+		"hash not matching the header": func() *Block {
+			block := mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 0))
+			block.Hash = append([]byte{}, genesis.Hash...)
+			return block
+		},
+		"duplicated trailing transaction": func() *Block {
+			first := newSignedTestTx(alice, spend, 0, []TxOutput{{Value: 50}})
+			block := mineTestBlock(second, newTestCoinbase(testAddress("miner"), "", 2, 0), first)
+			block.TXs = append(block.TXs, first, first)
+			return block
+		},
+		"wrong previous hash": func() *Block {
+			return mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 2, 0))
+		},
+	}
+
+	for name, build := range cases {
+		t.Run(name, func(t *testing.T) {
+			v := NewChainValidator(newTestBlockchain(t, genesis, second))
+			assert.Nil(t, v.ConnectBlock(genesis, true))
+			assert.Nil(t, v.ConnectBlock(second, true))
+
+			err := v.ConnectBlock(build(), true)
+			assert.IsType(t, &BlockValidationError{}, err)
+		})
+	}
+}
+
+func TestValidateBlockBeforeConnecting(t *testing.T) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	bc := newTestBlockchain(t, genesis)
+
+	negative := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: -1000}, {Value: 1050}})
+	block := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0), negative)
+	assert.IsType(t, &BlockValidationError{}, bc.ValidateBlock(block))
+
+	// locally mined blocks are validated too
+	assert.Nil(t, bc.AddBlock([]*Transaction{newTestCoinbase(testAddress("miner"), "", 1, 0), negative}))
+	assert.Equal(t, genesis.Hash, bc.lastBlockHash)
+	assert.NotNil(t, bc.AddBlock([]*Transaction{newTestCoinbase(testAddress("miner"), "", 1, 0)}))
+	assert.Equal(t, 1, bc.BestHeight())
+}
+
+func TestValidateHeaderRejectsDuplicatedTrailingTx(t *testing.T) {
+	useTestGenesisBits(t)
+	alice := NewWallet()
+	aliceHash := HashPubKey(alice.PublicKey)
+
+	coinbase := newTestCoinbase(string(alice.GetAddress()), "genesis", 0, 0)
+	genesis := mineTestBlock(nil, coinbase)
+	bc := newTestBlockchain(t, genesis)
+
+	first := newSignedTestTx(alice, coinbase, 0, []TxOutput{{Value: 50, PubKeyHash: aliceHash}})
+	second := newSignedTestTx(alice, first, 0, []TxOutput{{Value: 50}})
+	block := mineTestBlock(genesis, newTestCoinbase(testAddress("miner"), "", 1, 0), first, second)
+	assert.Nil(t, bc.ValidateHeader(block))
+
+	// the odd last transaction pairs with itself, so repeating it keeps the
+	// merkle root and the header
+	twin := *block
+	twin.TXs = append(append([]*Transaction{}, block.TXs...), second)
+	assert.Equal(t, block.MerkleRoot, twin.HashTransactions())
+	assert.IsType(t, &BlockValidationError{}, bc.ValidateHeader(&twin))
+}
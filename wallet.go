@@ -19,10 +19,6 @@ type Wallet struct {
 	PublicKey  []byte
 }
 
-type Wallets struct {
-	Wallets map[string]*Wallet
-}
-
 func NewWallet() *Wallet {
 	private, public := newKeyPeir()
 	wallet := &Wallet{
@@ -39,21 +35,34 @@ func newKeyPeir() (*ecdsa.PrivateKey, []byte) {
 		log.Println(err)
 		return nil, []byte{}
 	}
-	pubKey := append(private.PublicKey.X.Bytes(), private.PublicKey.Y.Bytes()...)
+	return private, pubKeyBytes(private.PublicKey)
+}
 
-	return private, pubKey
+// pubKeyBytes concatenates the coordinates padded to the curve size, so the
+// key can always be split in half again when verifying signatures.
+func pubKeyBytes(pub ecdsa.PublicKey) []byte {
+	size := (pub.Curve.Params().BitSize + 7) / 8
+	pubKey := make([]byte, 2*size)
+	pub.X.FillBytes(pubKey[:size])
+	pub.Y.FillBytes(pubKey[size:])
+
+	return pubKey
 }
 
 func (w *Wallet) GetAddress() []byte {
-	pubKeyHash := HashPubKey(w.PublicKey)
-	versionedPayload := append([]byte{VERSION}, pubKeyHash...)
-	checksum := checksum(versionedPayload)
-
-	fullPayload := append(versionedPayload, checksum...)
+	return pubKeyHashAddress(HashPubKey(w.PublicKey))
+}
 
-	address := Base58Encode(fullPayload)
+// Address encodes the wallet's address on the active network in format.
+func (w *Wallet) Address(format AddressFormat) string {
+	address := NewAddress(HashPubKey(w.PublicKey), activeNetwork)
+	address.Format = format
+	return address.String()
+}
 
-	return address
+// pubKeyHashAddress encodes the address of pubKeyHash on the active network.
+func pubKeyHashAddress(pubKeyHash []byte) []byte {
+	return []byte(NewAddress(pubKeyHash, activeNetwork).String())
 }
 
 func HashPubKey(pubKey []byte) []byte {
@@ -72,9 +81,5 @@ func HashPubKey(pubKey []byte) []byte {
 }
 
 func checksum(payload []byte) []byte {
-	fHash := sha256.Sum256(payload)
-	sHash := sha256.Sum256(fHash[:])
-
-	return sHash[:addressChecksumLen]
+	return doubleSHA256(payload)[:addressChecksumLen]
 }
-
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt parameters used to turn a passphrase into the AES-256 key that seals
+// the wallet's private keys
+const (
+	SCRYPT_N       = 1 << 15
+	SCRYPT_R       = 8
+	SCRYPT_P       = 1
+	SCRYPT_KEY_LEN = 32
+	SALT_LEN       = 16
+)
+
+var (
+	ErrWrongPassphrase = errors.New("the passphrase is incorrect")
+
+	// sealed when a wallet is encrypted, so the passphrase can be checked
+	// even while the wallet has no keys
+	passphraseCheck = []byte("wallet passphrase check")
+)
+
+func newSalt() ([]byte, error) {
+	return randomBytes(SALT_LEN)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, SCRYPT_N, SCRYPT_R, SCRYPT_P, SCRYPT_KEY_LEN)
+}
+
+func sealKey(key []byte, private *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return seal(key, der)
+}
+
+func openKey(key, sealed []byte) (*ecdsa.PrivateKey, error) {
+	der, err := open(key, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseECPrivateKey(der)
+}
+
+// seal encrypts plaintext with AES-GCM, the random nonce is prepended to the
+// ciphertext.
+func seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("sealed data is too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
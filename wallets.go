@@ -0,0 +1,677 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	WALLET_FILE_VERSION = 2
+	// how long commands unlock a wallet for at most, they Lock it again as
+	// soon as they're done
+	WALLET_UNLOCK_TIMEOUT = time.Minute
+)
+
+var (
+	ErrWalletLocked       = errors.New("wallet is locked, unlock it with the passphrase first")
+	ErrWalletEncrypted    = errors.New("wallet is already encrypted")
+	ErrWalletNotEncrypted = errors.New("wallet is not encrypted")
+	ErrWalletHasSeed      = errors.New("wallet already has an HD seed")
+	ErrWalletNoSeed       = errors.New("wallet has no HD seed")
+)
+
+// Wallets is the wallet store of a chain, kept next to the chain's database.
+// Once encrypted, private keys only live in memory between Unlock and Lock,
+// and Unlock calls Lock by itself once its timeout runs out. A store with an
+// HD seed derives its keys from the seed, other keys are random and have to
+// be backed up one by one.
+type Wallets struct {
+	// guards the store against the timer of Unlock, which locks it from its
+	// own goroutine
+	mu sync.Mutex
+
+	Wallets map[string]*Wallet
+
+	// addresses in the order they were created, the first one is the default
+	addresses []string
+	file      string
+	// derivation path of every address derived from the seed
+	paths map[string]HDPath
+	seed  []byte
+
+	encrypted  bool
+	salt       []byte
+	sealed     map[string][]byte
+	sealedSeed []byte
+	// passphraseCheck sealed, nil in stores encrypted before it existed
+	sealedCheck []byte
+	// key derived from the passphrase, only set while unlocked
+	key []byte
+	// locks the store once the timeout of Unlock runs out
+	relock *time.Timer
+}
+
+// walletsFile is the on disk form of Wallets. Private keys are stored as
+// SEC 1 DER because gob can't encode the curve behind ecdsa.PrivateKey, and
+// only in sealed form once the wallet is encrypted.
+type walletsFile struct {
+	Version   int
+	Addresses []string
+	PubKeys   [][]byte
+	Keys      [][]byte
+
+	// empty for keys that weren't derived from the seed
+	Paths []string
+	Seed  []byte
+
+	Encrypted   bool
+	Salt        []byte
+	Sealed      [][]byte
+	SealedSeed  []byte
+	SealedCheck []byte
+}
+
+func walletFileName(blockchainName string) string {
+	return filepath.Join(filepath.Dir(blockchainName), fmt.Sprintf("wallet_%s.dat", filepath.Base(blockchainName)))
+}
+
+// NewWallets loads the wallet store of the named chain, or returns an empty
+// one if it doesn't exist yet.
+func NewWallets(blockchainName string) (*Wallets, error) {
+	ws := &Wallets{
+		Wallets: make(map[string]*Wallet),
+		sealed:  make(map[string][]byte),
+		paths:   make(map[string]HDPath),
+		file:    walletFileName(blockchainName),
+	}
+
+	err := ws.LoadFromFile()
+	if errors.Is(err, os.ErrNotExist) {
+		return ws, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// CreateWallet adds a new key to the store and returns its address. HD
+// stores derive the next receiving address of the first account, others
+// generate a random key. The store has to be saved for the key to survive.
+// Encrypted stores have to be unlocked so the new key can be sealed.
+func (ws *Wallets) CreateWallet() (string, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.isHD() {
+		return ws.deriveAddress(0, false)
+	}
+	if ws.isLocked() {
+		return "", ErrWalletLocked
+	}
+	wallet := NewWallet()
+	address := string(wallet.GetAddress())
+	if err := ws.addWallet(address, wallet, nil); err != nil {
+		return "", err
+	}
+
+	return address, nil
+}
+
+// SetSeed turns the store into an HD store, existing random keys are kept.
+func (ws *Wallets) SetSeed(seed []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.isHD() {
+		return ErrWalletHasSeed
+	}
+	if ws.isLocked() {
+		return ErrWalletLocked
+	}
+	if _, err := NewMasterKey(seed); err != nil {
+		return err
+	}
+	if ws.encrypted {
+		sealed, err := seal(ws.key, seed)
+		if err != nil {
+			return err
+		}
+		ws.sealedSeed = sealed
+	}
+	ws.seed = seed
+
+	return nil
+}
+
+func (ws *Wallets) IsHD() bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.isHD()
+}
+
+func (ws *Wallets) isHD() bool {
+	return ws.seed != nil || ws.sealedSeed != nil
+}
+
+// DeriveAddress derives the address following the last one of the account's
+// receiving or change chain.
+func (ws *Wallets) DeriveAddress(account uint32, change bool) (string, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.deriveAddress(account, change)
+}
+
+func (ws *Wallets) deriveAddress(account uint32, change bool) (string, error) {
+	if account >= HD_HARDENED {
+		return "", fmt.Errorf("account %d is out of range", account)
+	}
+	var next uint32
+	for _, path := range ws.paths {
+		a, c, index, ok := path.AddressParts()
+		if ok && a == account && c == change && index >= next {
+			next = index + 1
+		}
+	}
+	if next >= HD_HARDENED {
+		return "", fmt.Errorf("account %d has no addresses left", account)
+	}
+
+	path := NewAddressPath(account, change, next)
+	master, err := ws.masterKey()
+	if err != nil {
+		return "", err
+	}
+	key, err := master.Derive(path)
+	if err != nil {
+		return "", err
+	}
+	wallet := key.Wallet()
+	address := string(wallet.GetAddress())
+	if err := ws.addWallet(address, wallet, path); err != nil {
+		return "", err
+	}
+
+	return address, nil
+}
+
+// Path returns the derivation path of address, if it was derived from the
+// seed.
+func (ws *Wallets) Path(address string) (HDPath, bool) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	path, ok := ws.paths[storedAddress(address)]
+	return path, ok
+}
+
+// Rescan derives the addresses of every account and chain until gapLimit
+// addresses in a row were never used on bc, and adds the used ones to the
+// store. Accounts are scanned until one has no used address at all. It
+// returns the addresses that were added.
+func (ws *Wallets) Rescan(bc *Blockchain, gapLimit int) ([]string, error) {
+	return ws.rescan(bc.UsedPubKeyHashes(), gapLimit)
+}
+
+func (ws *Wallets) rescan(used map[string]bool, gapLimit int) ([]string, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if gapLimit <= 0 {
+		return nil, errors.New("gap limit must be positive")
+	}
+	master, err := ws.masterKey()
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for account := uint32(0); account < HD_HARDENED; account++ {
+		accountUsed := false
+		for _, change := range []bool{false, true} {
+			chainPath := NewAddressPath(account, change, 0)
+			chainPath = chainPath[:len(chainPath)-1]
+			chainKey, err := master.Derive(chainPath)
+			if err != nil {
+				return nil, err
+			}
+
+			for index, gap := uint32(0), 0; gap < gapLimit && index < HD_HARDENED; index++ {
+				key, err := chainKey.Child(index)
+				if err != nil {
+					return nil, err
+				}
+				wallet := key.Wallet()
+				if !used[hex.EncodeToString(HashPubKey(wallet.PublicKey))] {
+					gap++
+					continue
+				}
+				gap = 0
+				accountUsed = true
+
+				address := string(wallet.GetAddress())
+				if _, ok := ws.Wallets[address]; ok {
+					continue
+				}
+				if err := ws.addWallet(address, wallet, NewAddressPath(account, change, index)); err != nil {
+					return nil, err
+				}
+				added = append(added, address)
+			}
+		}
+		if !accountUsed {
+			break
+		}
+	}
+
+	return added, nil
+}
+
+// masterKey fails while the seed is sealed.
+func (ws *Wallets) masterKey() (*ExtendedKey, error) {
+	if !ws.isHD() {
+		return nil, ErrWalletNoSeed
+	}
+	if ws.isLocked() {
+		return nil, ErrWalletLocked
+	}
+	return NewMasterKey(ws.seed)
+}
+
+func (ws *Wallets) addWallet(address string, wallet *Wallet, path HDPath) error {
+	if ws.encrypted {
+		sealed, err := sealKey(ws.key, &wallet.PrivateKey)
+		if err != nil {
+			return err
+		}
+		ws.sealed[address] = sealed
+	}
+	ws.Wallets[address] = wallet
+	ws.addresses = append(ws.addresses, address)
+	if path != nil {
+		ws.paths[address] = path
+	}
+	return nil
+}
+
+func (ws *Wallets) GetAddresses() []string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	addresses := make([]string, len(ws.addresses))
+	copy(addresses, ws.addresses)
+	return addresses
+}
+
+// GetWallet returns the key pair of address, which fails while the store is
+// locked.
+func (ws *Wallets) GetWallet(address string) (*Wallet, error) {
+	address = storedAddress(address)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return nil, fmt.Errorf("address %s is not in the wallet", address)
+	}
+	if ws.isLocked() {
+		return nil, ErrWalletLocked
+	}
+	return wallet, nil
+}
+
+// PublicKey is available even while the store is locked.
+func (ws *Wallets) PublicKey(address string) ([]byte, error) {
+	address = storedAddress(address)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	wallet, ok := ws.Wallets[address]
+	if !ok {
+		return nil, fmt.Errorf("address %s is not in the wallet", address)
+	}
+	return wallet.PublicKey, nil
+}
+
+// storedAddress returns the Base58 form the store keys wallets by, so they
+// can be looked up with their Bech32 addresses too.
+func storedAddress(address string) string {
+	decoded, err := DecodeAddress(address)
+	if err != nil || decoded.Format == AddressBase58 {
+		return address
+	}
+	return NewAddress(decoded.PubKeyHash, decoded.Network).String()
+}
+
+func (ws *Wallets) IsEncrypted() bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.encrypted
+}
+
+// IsLocked reports whether private keys are unavailable.
+func (ws *Wallets) IsLocked() bool {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.isLocked()
+}
+
+func (ws *Wallets) isLocked() bool {
+	return ws.encrypted && ws.key == nil
+}
+
+// EncryptWallet seals every private key with a key derived from passphrase
+// and leaves the store locked. It has to be saved afterwards.
+func (ws *Wallets) EncryptWallet(passphrase string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.encrypted {
+		return ErrWalletEncrypted
+	}
+	if passphrase == "" {
+		return errors.New("passphrase can't be empty")
+	}
+
+	salt, err := newSalt()
+	if err != nil {
+		return err
+	}
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	sealed := make(map[string][]byte)
+	for _, address := range ws.addresses {
+		s, err := sealKey(key, &ws.Wallets[address].PrivateKey)
+		if err != nil {
+			return err
+		}
+		sealed[address] = s
+	}
+	var sealedSeed []byte
+	if ws.seed != nil {
+		if sealedSeed, err = seal(key, ws.seed); err != nil {
+			return err
+		}
+	}
+	sealedCheck, err := seal(key, passphraseCheck)
+	if err != nil {
+		return err
+	}
+
+	ws.encrypted = true
+	ws.salt = salt
+	ws.sealed = sealed
+	ws.sealedSeed = sealedSeed
+	ws.sealedCheck = sealedCheck
+	ws.lock()
+
+	return nil
+}
+
+// Unlock decrypts the private keys and locks the store again after timeout,
+// which replaces the timeout of an earlier Unlock. Lock can end it sooner.
+func (ws *Wallets) Unlock(passphrase string, timeout time.Duration) error {
+	if timeout <= 0 {
+		return errors.New("unlock timeout must be positive")
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if !ws.encrypted {
+		return ErrWalletNotEncrypted
+	}
+	key, err := deriveKey(passphrase, ws.salt)
+	if err != nil {
+		return err
+	}
+	if err := ws.checkKey(key); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*Wallet)
+	for _, address := range ws.addresses {
+		private, err := openKey(key, ws.sealed[address])
+		if err != nil {
+			return err
+		}
+		keys[address] = &Wallet{PrivateKey: *private, PublicKey: pubKeyBytes(private.PublicKey)}
+	}
+	var seed []byte
+	if ws.sealedSeed != nil {
+		if seed, err = open(key, ws.sealedSeed); err != nil {
+			return err
+		}
+	}
+
+	for address, wallet := range keys {
+		ws.Wallets[address] = wallet
+	}
+	ws.seed = seed
+	ws.key = key
+	if ws.sealedCheck == nil {
+		// the keys just opened vouch for the passphrase
+		if ws.sealedCheck, err = seal(key, passphraseCheck); err != nil {
+			return err
+		}
+	}
+
+	if ws.relock != nil {
+		ws.relock.Stop()
+	}
+	var relock *time.Timer
+	relock = time.AfterFunc(timeout, func() {
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		// a timer that fired while a later Unlock replaced it has nothing to lock
+		if ws.relock == relock {
+			ws.lock()
+		}
+	})
+	ws.relock = relock
+
+	return nil
+}
+
+// checkKey makes sure key was derived from the wallet's passphrase. Stores
+// encrypted before the check value existed are checked by opening their keys
+// and seed, and one without either can't be checked at all.
+func (ws *Wallets) checkKey(key []byte) error {
+	if ws.sealedCheck != nil {
+		_, err := open(key, ws.sealedCheck)
+		return err
+	}
+	if len(ws.sealed) == 0 && ws.sealedSeed == nil {
+		return errors.New("the wallet has nothing to check the passphrase against, encrypt a new one")
+	}
+	return nil
+}
+
+// Lock forgets the decrypted private keys, keeping the public keys around.
+func (ws *Wallets) Lock() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.lock()
+}
+
+func (ws *Wallets) lock() {
+	if ws.relock != nil {
+		ws.relock.Stop()
+		ws.relock = nil
+	}
+	if !ws.encrypted {
+		return
+	}
+	for address, wallet := range ws.Wallets {
+		ws.Wallets[address] = &Wallet{PublicKey: wallet.PublicKey}
+	}
+	ws.seed = nil
+	ws.key = nil
+}
+
+// ChangePassphrase re-seals every private key and the seed with a key
+// derived from the new passphrase. The store has to be saved afterwards.
+func (ws *Wallets) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if !ws.encrypted {
+		return ErrWalletNotEncrypted
+	}
+	if newPassphrase == "" {
+		return errors.New("passphrase can't be empty")
+	}
+	oldKey, err := deriveKey(oldPassphrase, ws.salt)
+	if err != nil {
+		return err
+	}
+	if err := ws.checkKey(oldKey); err != nil {
+		return err
+	}
+	salt, err := newSalt()
+	if err != nil {
+		return err
+	}
+	newKey, err := deriveKey(newPassphrase, salt)
+	if err != nil {
+		return err
+	}
+
+	sealed := make(map[string][]byte)
+	for _, address := range ws.addresses {
+		private, err := openKey(oldKey, ws.sealed[address])
+		if err != nil {
+			return err
+		}
+		s, err := sealKey(newKey, private)
+		if err != nil {
+			return err
+		}
+		sealed[address] = s
+	}
+	var sealedSeed []byte
+	if ws.sealedSeed != nil {
+		seed, err := open(oldKey, ws.sealedSeed)
+		if err != nil {
+			return err
+		}
+		if sealedSeed, err = seal(newKey, seed); err != nil {
+			return err
+		}
+	}
+	sealedCheck, err := seal(newKey, passphraseCheck)
+	if err != nil {
+		return err
+	}
+
+	ws.salt = salt
+	ws.sealed = sealed
+	ws.sealedSeed = sealedSeed
+	ws.sealedCheck = sealedCheck
+	if ws.key != nil {
+		ws.key = newKey
+	}
+
+	return nil
+}
+
+func (ws *Wallets) LoadFromFile() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	content, err := os.ReadFile(ws.file)
+	if err != nil {
+		return err
+	}
+
+	var wf walletsFile
+	decoder := gob.NewDecoder(bytes.NewReader(content))
+	if err := decoder.Decode(&wf); err != nil {
+		return fmt.Errorf("unable to decode wallet file %s: %w", ws.file, err)
+	}
+	if wf.Version > WALLET_FILE_VERSION {
+		return fmt.Errorf("wallet file %s has unsupported version %d", ws.file, wf.Version)
+	}
+
+	ws.encrypted = wf.Encrypted
+	ws.salt = wf.Salt
+	ws.seed = wf.Seed
+	ws.sealedSeed = wf.SealedSeed
+	ws.sealedCheck = wf.SealedCheck
+	for i, address := range wf.Addresses {
+		if i < len(wf.Paths) && wf.Paths[i] != "" {
+			path, err := ParseHDPath(wf.Paths[i])
+			if err != nil {
+				return fmt.Errorf("wallet file %s is corrupted: %w", ws.file, err)
+			}
+			ws.paths[address] = path
+		}
+		if wf.Encrypted {
+			if i >= len(wf.Sealed) || i >= len(wf.PubKeys) {
+				return fmt.Errorf("wallet file %s is corrupted", ws.file)
+			}
+			ws.sealed[address] = wf.Sealed[i]
+			ws.Wallets[address] = &Wallet{PublicKey: wf.PubKeys[i]}
+		} else {
+			if i >= len(wf.Keys) {
+				return fmt.Errorf("wallet file %s is corrupted", ws.file)
+			}
+			private, err := x509.ParseECPrivateKey(wf.Keys[i])
+			if err != nil {
+				return fmt.Errorf("unable to decode key of %s: %w", address, err)
+			}
+			ws.Wallets[address] = &Wallet{
+				PrivateKey: *private,
+				PublicKey:  pubKeyBytes(private.PublicKey),
+			}
+		}
+		ws.addresses = append(ws.addresses, address)
+	}
+
+	return nil
+}
+
+func (ws *Wallets) SaveToFile() error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	wf := walletsFile{
+		Version:     WALLET_FILE_VERSION,
+		Encrypted:   ws.encrypted,
+		Salt:        ws.salt,
+		SealedSeed:  ws.sealedSeed,
+		SealedCheck: ws.sealedCheck,
+	}
+	if !ws.encrypted {
+		wf.Seed = ws.seed
+	}
+	for _, address := range ws.addresses {
+		var path string
+		if p, ok := ws.paths[address]; ok {
+			path = p.String()
+		}
+		wf.Addresses = append(wf.Addresses, address)
+		wf.Paths = append(wf.Paths, path)
+		wf.PubKeys = append(wf.PubKeys, ws.Wallets[address].PublicKey)
+		if ws.encrypted {
+			wf.Sealed = append(wf.Sealed, ws.sealed[address])
+			continue
+		}
+		key, err := x509.MarshalECPrivateKey(&ws.Wallets[address].PrivateKey)
+		if err != nil {
+			return err
+		}
+		wf.Keys = append(wf.Keys, key)
+	}
+
+	var content bytes.Buffer
+	encoder := gob.NewEncoder(&content)
+	if err := encoder.Encode(wf); err != nil {
+		return err
+	}
+
+	// write to a temporary file first so a crash never leaves half a wallet
+	tmp := ws.file + ".tmp"
+	if err := os.WriteFile(tmp, content.Bytes(), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ws.file)
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalletsSaveAndLoad(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "BTC")
+
+	ws, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.Empty(t, ws.GetAddresses())
+
+	first, err := ws.CreateWallet()
+	assert.Nil(t, err)
+	second, err := ws.CreateWallet()
+	assert.Nil(t, err)
+	assert.NotEmpty(t, first)
+	assert.NotEqual(t, first, second)
+	assert.Nil(t, ws.SaveToFile())
+	assert.FileExists(t, filepath.Join(filepath.Dir(name), "wallet_BTC.dat"))
+
+	loaded, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{first, second}, loaded.GetAddresses())
+
+	wallet, err := loaded.GetWallet(first)
+	assert.Nil(t, err)
+	assert.Equal(t, ws.Wallets[first].PublicKey, wallet.PublicKey)
+	assert.Equal(t, first, string(wallet.GetAddress()))
+	assert.True(t, ws.Wallets[first].PrivateKey.Equal(&wallet.PrivateKey))
+
+	_, err = loaded.GetWallet("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestLoadedWalletSigns(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "BTC")
+	ws, err := NewWallets(name)
+	assert.Nil(t, err)
+	address, err := ws.CreateWallet()
+	assert.Nil(t, err)
+	assert.Nil(t, ws.SaveToFile())
+
+	loaded, err := NewWallets(name)
+	assert.Nil(t, err)
+	wallet, err := loaded.GetWallet(address)
+	assert.Nil(t, err)
+
+	prev := newTestCoinbase(address, "", 0, 0)
+	tx := newSignedTestTx(wallet, prev, 0, []TxOutput{{Value: 50}})
+
+	assert.True(t, tx.Verify(map[string]Transaction{hex.EncodeToString(prev.ID): *prev}))
+}
+
+func TestEncryptedWallets(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "BTC")
+	ws, err := NewWallets(name)
+	assert.Nil(t, err)
+	address, err := ws.CreateWallet()
+	assert.Nil(t, err)
+	original := ws.Wallets[address].PrivateKey
+
+	assert.Nil(t, ws.EncryptWallet("secret"))
+	assert.Equal(t, ErrWalletEncrypted, ws.EncryptWallet("again"))
+	assert.Nil(t, ws.SaveToFile())
+
+	content, err := os.ReadFile(walletFileName(name))
+	assert.Nil(t, err)
+	der, err := x509.MarshalECPrivateKey(&original)
+	assert.Nil(t, err)
+	assert.False(t, bytes.Contains(content, der))
+
+	loaded, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.True(t, loaded.IsLocked())
+	_, err = loaded.GetWallet(address)
+	assert.Equal(t, ErrWalletLocked, err)
+	_, err = loaded.CreateWallet()
+	assert.Equal(t, ErrWalletLocked, err)
+	pubKey, err := loaded.PublicKey(address)
+	assert.Nil(t, err)
+	assert.Equal(t, address, string((&Wallet{PublicKey: pubKey}).GetAddress()))
+
+	bc := &Blockchain{}
+	assert.Equal(t, ErrWalletLocked, bc.SignTransaction(&Transaction{}, loaded.Wallets[address].PrivateKey))
+
+	assert.Equal(t, ErrWrongPassphrase, loaded.Unlock("wrong", time.Minute))
+	assert.Nil(t, loaded.Unlock("secret", time.Minute))
+	wallet, err := loaded.GetWallet(address)
+	assert.Nil(t, err)
+	assert.True(t, original.Equal(&wallet.PrivateKey))
+
+	assert.False(t, loaded.IsLocked())
+	loaded.Lock()
+	assert.True(t, loaded.IsLocked())
+	_, err = loaded.GetWallet(address)
+	assert.Equal(t, ErrWalletLocked, err)
+}
+
+func TestWalletUnlockTimeout(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "BTC")
+	ws, err := NewWallets(name)
+	assert.Nil(t, err)
+	address, err := ws.CreateWallet()
+	assert.Nil(t, err)
+	assert.Nil(t, ws.EncryptWallet("secret"))
+	assert.NotNil(t, ws.Unlock("secret", 0))
+
+	// a later Unlock replaces the earlier timeout
+	assert.Nil(t, ws.Unlock("secret", 50*time.Millisecond))
+	assert.Nil(t, ws.Unlock("secret", time.Hour))
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, ws.IsLocked())
+
+	assert.Nil(t, ws.Unlock("secret", 50*time.Millisecond))
+	wallet, err := ws.GetWallet(address)
+	assert.Nil(t, err)
+	prev := newTestCoinbase(address, "", 0, 0)
+	tx := newSignedTestTx(wallet, prev, 0, []TxOutput{{Value: 50}})
+	assert.True(t, tx.Verify(map[string]Transaction{hex.EncodeToString(prev.ID): *prev}))
+
+	bc := &Blockchain{}
+	assert.Eventually(t, ws.IsLocked, time.Second, 10*time.Millisecond)
+	_, err = ws.GetWallet(address)
+	assert.Equal(t, ErrWalletLocked, err)
+	assert.Equal(t, ErrWalletLocked, bc.SignTransaction(&Transaction{}, ws.Wallets[address].PrivateKey))
+}
+
+func TestWalletPassphraseChange(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "BTC")
+	ws, err := NewWallets(name)
+	assert.Nil(t, err)
+	_, err = ws.CreateWallet()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrWalletNotEncrypted, ws.ChangePassphrase("old", "new"))
+
+	assert.Nil(t, ws.EncryptWallet("old"))
+	assert.Equal(t, ErrWrongPassphrase, ws.ChangePassphrase("wrong", "new"))
+	assert.Nil(t, ws.ChangePassphrase("old", "new"))
+	assert.Nil(t, ws.SaveToFile())
+
+	loaded, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrWrongPassphrase, loaded.Unlock("old", time.Minute))
+	assert.Nil(t, loaded.Unlock("new", time.Minute))
+
+	second, err := loaded.CreateWallet()
+	assert.Nil(t, err)
+	assert.Nil(t, loaded.SaveToFile())
+	reloaded, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.Nil(t, reloaded.Unlock("new", time.Minute))
+	_, err = reloaded.GetWallet(second)
+	assert.Nil(t, err)
+}
+
+func TestEmptyEncryptedWalletChecksPassphrase(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "BTC")
+	ws, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.Nil(t, ws.EncryptWallet("secret"))
+	assert.Nil(t, ws.SaveToFile())
+
+	loaded, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.Equal(t, ErrWrongPassphrase, loaded.Unlock("wrong", time.Minute))
+	assert.True(t, loaded.IsLocked())
+	assert.Equal(t, ErrWrongPassphrase, loaded.ChangePassphrase("wrong", "new"))
+
+	assert.Nil(t, loaded.Unlock("secret", time.Minute))
+	address, err := loaded.CreateWallet()
+	assert.Nil(t, err)
+	assert.Nil(t, loaded.SaveToFile())
+	reloaded, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.Nil(t, reloaded.Unlock("secret", time.Minute))
+	_, err = reloaded.GetWallet(address)
+	assert.Nil(t, err)
+}
+
+func newTestHDWallets(t *testing.T) (*Wallets, string) {
+	name := filepath.Join(t.TempDir(), "BTC")
+	ws, err := NewWallets(name)
+	assert.Nil(t, err)
+	seed, err := MnemonicSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	assert.Nil(t, err)
+	assert.Nil(t, ws.SetSeed(seed))
+	return ws, name
+}
+
+func TestHDWallets(t *testing.T) {
+	ws, name := newTestHDWallets(t)
+	assert.True(t, ws.IsHD())
+	assert.Equal(t, ErrWalletHasSeed, ws.SetSeed(make([]byte, 32)))
+
+	first, err := ws.CreateWallet()
+	assert.Nil(t, err)
+	second, err := ws.CreateWallet()
+	assert.Nil(t, err)
+	change, err := ws.DeriveAddress(0, true)
+	assert.Nil(t, err)
+	other, err := ws.DeriveAddress(1, false)
+	assert.Nil(t, err)
+	assert.Len(t, map[string]bool{first: true, second: true, change: true, other: true}, 4)
+
+	path, ok := ws.Path(second)
+	assert.True(t, ok)
+	assert.Equal(t, "m/44'/0'/0'/0/1", path.String())
+	path, _ = ws.Path(change)
+	assert.Equal(t, "m/44'/0'/0'/1/0", path.String())
+	path, _ = ws.Path(other)
+	assert.Equal(t, "m/44'/0'/1'/0/0", path.String())
+	assert.Nil(t, ws.SaveToFile())
+
+	// the same seed always derives the same addresses
+	restored, _ := newTestHDWallets(t)
+	again, err := restored.CreateWallet()
+	assert.Nil(t, err)
+	assert.Equal(t, first, again)
+
+	loaded, err := NewWallets(name)
+	assert.Nil(t, err)
+	assert.True(t, loaded.IsHD())
+	path, ok = loaded.Path(other)
+	assert.True(t, ok)
+	assert.Equal(t, "m/44'/0'/1'/0/0", path.String())
+	third, err := loaded.CreateWallet()
+	assert.Nil(t, err)
+	path, _ = loaded.Path(third)
+	assert.Equal(t, "m/44'/0'/0'/0/2", path.String())
+	wallet, err := loaded.GetWallet(third)
+	assert.Nil(t, err)
+	assert.Equal(t, third, string(wallet.GetAddress()))
+}
+
+func TestEncryptedHDWallets(t *testing.T) {
+	ws, name := newTestHDWallets(t)
+	first, err := ws.CreateWallet()
+	assert.Nil(t, err)
+	assert.Nil(t, ws.EncryptWallet("secret"))
+	assert.Nil(t, ws.SaveToFile())
+
+	content, err := os.ReadFile(walletFileName(name))
+	assert.Nil(t, err)
+	seed, _ := MnemonicSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	assert.False(t, bytes.Contains(content, seed))
+
+	loaded, err := NewWallets(name)
+	assert.Nil(t, err)
+	_, err = loaded.CreateWallet()
+	assert.Equal(t, ErrWalletLocked, err)
+	assert.Nil(t, loaded.ChangePassphrase("secret", "new"))
+	assert.Nil(t, loaded.Unlock("new", time.Minute))
+	second, err := loaded.CreateWallet()
+	assert.Nil(t, err)
+
+	restored, _ := newTestHDWallets(t)
+	expected, _ := restored.DeriveAddress(0, false)
+	assert.Equal(t, first, expected)
+	expected, _ = restored.DeriveAddress(0, false)
+	assert.Equal(t, second, expected)
+}
+
+func TestWalletsRescan(t *testing.T) {
+	source, _ := newTestHDWallets(t)
+	hashes := make(map[string]string)
+	for i := 0; i < 5; i++ {
+		address, err := source.DeriveAddress(0, false)
+		assert.Nil(t, err)
+		hashes[address] = hex.EncodeToString(HashPubKey(source.Wallets[address].PublicKey))
+	}
+	change, _ := source.DeriveAddress(0, true)
+	account, _ := source.DeriveAddress(1, false)
+	addresses := source.GetAddresses()
+
+	// receiving addresses 0 and 4 were used, 1 to 3 were handed out but never paid
+	used := map[string]bool{
+		hashes[addresses[0]]: true,
+		hashes[addresses[4]]: true,
+		hex.EncodeToString(HashPubKey(source.Wallets[change].PublicKey)):  true,
+		hex.EncodeToString(HashPubKey(source.Wallets[account].PublicKey)): true,
+	}
+
+	ws, _ := newTestHDWallets(t)
+	added, err := ws.rescan(used, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{addresses[0], addresses[4], change, account}, added)
+
+	added, err = ws.rescan(used, 4)
+	assert.Nil(t, err)
+	assert.Empty(t, added)
+
+	// a gap limit no larger than the unused run misses the later address
+	short, _ := newTestHDWallets(t)
+	added, err = short.rescan(used, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{addresses[0], change, account}, added)
+
+	next, err := ws.CreateWallet()
+	assert.Nil(t, err)
+	path, _ := ws.Path(next)
+	assert.Equal(t, "m/44'/0'/0'/0/5", path.String())
+}
+
+func TestWalletsLookupBech32(t *testing.T) {
+	ws, err := NewWallets(filepath.Join(t.TempDir(), "BTC"))
+	assert.Nil(t, err)
+	address, err := ws.CreateWallet()
+	assert.Nil(t, err)
+
+	bech32Address := ws.Wallets[address].Address(AddressBech32)
+	wallet, err := ws.GetWallet(bech32Address)
+	assert.Nil(t, err)
+	assert.Equal(t, address, string(wallet.GetAddress()))
+	pubKey, err := ws.PublicKey(bech32Address)
+	assert.Nil(t, err)
+	assert.Equal(t, wallet.PublicKey, pubKey)
+}